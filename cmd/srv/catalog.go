@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"srv.exe.dev/srv"
+)
+
+const commandUsage = `
+Commands, run instead of the server:
+  export FILE                     write the catalogue to FILE, .csv or .xlsx ("-" for CSV on stdout)
+  import [-dry-run] [-map H=F,...] FILE
+                                  add and update products from a CSV or XLSX sheet
+`
+
+// runCommand runs a command-line subcommand against the server's database.
+func runCommand(server *srv.Server, args []string) error {
+	ctx := context.Background()
+	switch args[0] {
+	case "export":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: export FILE")
+		}
+		return exportCatalog(ctx, server, args[1])
+	case "import":
+		return importCatalog(ctx, server, args[1:])
+	}
+	return fmt.Errorf("unknown command %q%s", args[0], commandUsage)
+}
+
+func exportCatalog(ctx context.Context, server *srv.Server, file string) error {
+	if file == "-" {
+		return server.ExportCatalog(ctx, os.Stdout, "csv")
+	}
+	var buf bytes.Buffer
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), ".")
+	if err := server.ExportCatalog(ctx, &buf, format); err != nil {
+		return err
+	}
+	return os.WriteFile(file, buf.Bytes(), 0o644)
+}
+
+func importCatalog(ctx context.Context, server *srv.Server, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "check the sheet and report what would change, without saving")
+	mapping := fs.String("map", "", `map sheet headers to fields, as "Header=field,Other=field"; map a header to nothing to ignore it`)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: import [-dry-run] [-map H=F,...] FILE")
+	}
+	opts := srv.CatalogImport{DryRun: *dryRun, Mapping: map[string]string{}}
+	for _, pair := range strings.Split(*mapping, ",") {
+		if pair == "" {
+			continue
+		}
+		header, field, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid -map %q: want Header=field", pair)
+		}
+		opts.Mapping[strings.TrimSpace(header)] = strings.TrimSpace(field)
+	}
+	var data []byte
+	var err error
+	if name := fs.Arg(0); name == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return err
+	}
+
+	report, err := server.ImportCatalog(ctx, data, opts)
+	if err != nil {
+		return err
+	}
+	for _, c := range report.Columns {
+		field := c.Field
+		if field == "" {
+			field = "(ignored)"
+		}
+		fmt.Printf("column %q -> %s\n", c.Header, field)
+	}
+	for _, row := range report.Rows {
+		if len(row.Errors) == 0 && len(row.Warnings) == 0 {
+			continue
+		}
+		for _, e := range row.Errors {
+			fmt.Printf("row %d (%s): error: %s\n", row.Row, row.Title, e)
+		}
+		for _, w := range row.Warnings {
+			fmt.Printf("row %d (%s): warning: %s\n", row.Row, row.Title, w)
+		}
+	}
+	verb := "Imported"
+	if report.DryRun {
+		verb = "Dry run, nothing saved. Would import"
+	}
+	fmt.Printf("%s %d new, updated %d, %d unchanged, %d failed\n", verb, report.Created, report.Updated, report.Unchanged, report.Failed)
+	if report.Failed > 0 {
+		return fmt.Errorf("%d rows failed", report.Failed)
+	}
+	return nil
+}
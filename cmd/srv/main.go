@@ -4,23 +4,38 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"srv.exe.dev/srv"
 )
 
 var (
 	flagListenAddr = flag.String("listen", ":8000", "address to listen on")
-	flagAdminPass  = flag.String("admin-password", "", "admin panel password (or ADMIN_PASSWORD env var)")
+	flagAdminPass  = flag.String("admin-password", "", "password for the initial \"admin\" owner account, created on first start when there are no accounts (or ADMIN_PASSWORD env var)")
 	flagDBPath     = flag.String("db", "db.sqlite3", "database file path (or DB_PATH env var)")
+	flagOutOfStock = flag.String("out-of-stock", srv.StockDemote, "how listings treat sold-out products: show, demote or hide")
+	flagProxy      = flag.String("proxy", srv.ProxyNone, "reverse proxy in front of the server, for client IPs: none, fly, render or xff (or PROXY env var)")
+	flagThemeDir   = flag.String("theme-dir", "", "directory of templates/ and static/ files that override the built-in ones (or THEME_DIR env var)")
+	flagDev        = flag.Bool("dev", false, "serve templates and static files from the source tree and reload them when they change")
+	flagImportJobs = flag.Int("import-workers", 2, "how many import jobs can run at once; more wait in the queue")
+	flagImageCache = flag.Int("image-cache-mb", 256, "disk space in MB for product images cached and resized by /img, kept in the uploads directory")
+	flagImageMem   = flag.Int("image-memory-mb", 96, "memory in MB for the one image being resized or uploaded at a time; bigger images are served unresized and refused as uploads (96 MB fits 12 megapixels)")
+	flagSyncEvery  = flag.Duration("sync-every", 0, "how often to re-scrape product listings for price changes and delistings, 0 for never (or SYNC_EVERY env var)")
 )
 
 func main() {
 	if err := run(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
 
 func run() error {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprint(flag.CommandLine.Output(), commandUsage)
+	}
 	flag.Parse()
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -34,9 +49,44 @@ func run() error {
 	if p := os.Getenv("DB_PATH"); p != "" {
 		dbPath = p
 	}
-	server, err := srv.New(dbPath, hostname, adminPass)
+	switch *flagOutOfStock {
+	case srv.StockShow, srv.StockDemote, srv.StockHide:
+	default:
+		return fmt.Errorf("invalid -out-of-stock %q: want show, demote or hide", *flagOutOfStock)
+	}
+	proxy := *flagProxy
+	if p := os.Getenv("PROXY"); p != "" {
+		proxy = p
+	}
+	switch proxy {
+	case srv.ProxyNone, srv.ProxyFly, srv.ProxyRender, srv.ProxyXFF:
+	default:
+		return fmt.Errorf("invalid -proxy %q: want none, fly, render or xff", proxy)
+	}
+	themeDir := *flagThemeDir
+	if d := os.Getenv("THEME_DIR"); d != "" {
+		themeDir = d
+	}
+	syncEvery := *flagSyncEvery
+	if v := os.Getenv("SYNC_EVERY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid SYNC_EVERY %q: %w", v, err)
+		}
+		syncEvery = d
+	}
+	server, err := srv.New(dbPath, hostname, adminPass, themeDir, *flagDev)
 	if err != nil {
 		return fmt.Errorf("create server: %w", err)
 	}
+	server.OutOfStock = *flagOutOfStock
+	server.Proxy = proxy
+	server.SyncEvery = syncEvery
+	server.ImportWorkers = *flagImportJobs
+	server.ImageCacheSize = int64(*flagImageCache) << 20
+	server.ImageMemory = int64(*flagImageMem) << 20
+	if flag.NArg() > 0 {
+		return runCommand(server, flag.Args())
+	}
 	return server.Serve(*flagListenAddr)
 }
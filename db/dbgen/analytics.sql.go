@@ -34,16 +34,17 @@ func (q *Queries) InsertPageView(ctx context.Context, arg InsertPageViewParams)
 }
 
 const insertWAClick = `-- name: InsertWAClick :exec
-INSERT INTO wa_clicks (product_id, click_type) VALUES (?, ?)
+INSERT INTO wa_clicks (product_id, click_type, variant_id) VALUES (?, ?, ?)
 `
 
 type InsertWAClickParams struct {
 	ProductID *int64 `json:"product_id"`
 	ClickType string `json:"click_type"`
+	VariantID *int64 `json:"variant_id"`
 }
 
 func (q *Queries) InsertWAClick(ctx context.Context, arg InsertWAClickParams) error {
-	_, err := q.db.ExecContext(ctx, insertWAClick, arg.ProductID, arg.ClickType)
+	_, err := q.db.ExecContext(ctx, insertWAClick, arg.ProductID, arg.ClickType, arg.VariantID)
 	return err
 }
 
@@ -8,6 +8,87 @@ import (
 	"time"
 )
 
+type AdminUser struct {
+	ID           int64      `json:"id"`
+	Username     string     `json:"username"`
+	Name         string     `json:"name"`
+	PasswordHash string     `json:"password_hash"`
+	Role         string     `json:"role"`
+	Disabled     int64      `json:"disabled"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastLoginAt  *time.Time `json:"last_login_at"`
+	TotpSecret   string     `json:"totp_secret"`
+	TotpEnabled  int64      `json:"totp_enabled"`
+	TotpLastStep int64      `json:"totp_last_step"`
+}
+
+type AuditLog struct {
+	ID         int64     `json:"id"`
+	UserID     *int64    `json:"user_id"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	ProductID  *int64    `json:"product_id"`
+	BeforeJson string    `json:"before_json"`
+	AfterJson  string    `json:"after_json"`
+	Diff       string    `json:"diff"`
+	Ip         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ImagePlaceholder struct {
+	Url       string    `json:"url"`
+	Data      string    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ImportJob struct {
+	ID         int64      `json:"id"`
+	Kind       string     `json:"kind"`
+	State      string     `json:"state"`
+	StoreUrl   string     `json:"store_url"`
+	Payload    string     `json:"payload"`
+	NextPage   int64      `json:"next_page"`
+	Total      int64      `json:"total"`
+	Seen       int64      `json:"seen"`
+	Imported   int64      `json:"imported"`
+	Updated    int64      `json:"updated"`
+	Skipped    int64      `json:"skipped"`
+	Failed     int64      `json:"failed"`
+	Message    string     `json:"message"`
+	UserID     *int64     `json:"user_id"`
+	Actor      string     `json:"actor"`
+	Ip         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Preview    int64      `json:"preview"`
+}
+
+type ImportJobItem struct {
+	ID        int64     `json:"id"`
+	JobID     int64     `json:"job_id"`
+	SourceID  string    `json:"source_id"`
+	Title     string    `json:"title"`
+	Url       string    `json:"url"`
+	Outcome   string    `json:"outcome"`
+	ProductID *int64    `json:"product_id"`
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+	Params    string    `json:"params"`
+	Decision  string    `json:"decision"`
+}
+
+type LoginAttempt struct {
+	ID        int64     `json:"id"`
+	Ip        string    `json:"ip"`
+	Username  string    `json:"username"`
+	Success   int64     `json:"success"`
+	Reason    string    `json:"reason"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type Migration struct {
 	MigrationNumber int64     `json:"migration_number"`
 	MigrationName   string    `json:"migration_name"`
@@ -24,22 +105,94 @@ type PageView struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+type PriceHistory struct {
+	ID                 int64     `json:"id"`
+	ProductID          int64     `json:"product_id"`
+	PricePaise         int64     `json:"price_paise"`
+	OriginalPricePaise int64     `json:"original_price_paise"`
+	RecordedAt         time.Time `json:"recorded_at"`
+}
+
 type Product struct {
-	ID              int64     `json:"id"`
-	Url             string    `json:"url"`
-	Platform        string    `json:"platform"`
-	Title           string    `json:"title"`
-	Price           string    `json:"price"`
-	OriginalPrice   string    `json:"original_price"`
-	ImageUrl        string    `json:"image_url"`
-	Description     string    `json:"description"`
-	Rating          string    `json:"rating"`
-	AddedAt         time.Time `json:"added_at"`
-	Category        string    `json:"category"`
-	Images          string    `json:"images"`
-	LongDescription string    `json:"long_description"`
-	IsNew           int64     `json:"is_new"`
-	IsBestseller    int64     `json:"is_bestseller"`
+	ID                 int64      `json:"id"`
+	Url                string     `json:"url"`
+	Platform           string     `json:"platform"`
+	Title              string     `json:"title"`
+	ImageUrl           string     `json:"image_url"`
+	Description        string     `json:"description"`
+	Rating             string     `json:"rating"`
+	AddedAt            time.Time  `json:"added_at"`
+	Category           string     `json:"category"`
+	Images             string     `json:"images"`
+	LongDescription    string     `json:"long_description"`
+	IsNew              int64      `json:"is_new"`
+	IsBestseller       int64      `json:"is_bestseller"`
+	PricePaise         int64      `json:"price_paise"`
+	OriginalPricePaise int64      `json:"original_price_paise"`
+	DiscountPct        int64      `json:"discount_pct"`
+	Stock              *int64     `json:"stock"`
+	SourcePlatform     string     `json:"source_platform"`
+	SourceID           string     `json:"source_id"`
+	SyncedAt           *time.Time `json:"synced_at"`
+	DelistedAt         *time.Time `json:"delisted_at"`
+	InStock            int64      `json:"in_stock"`
+}
+
+type ProductVariant struct {
+	ID                 int64     `json:"id"`
+	ProductID          int64     `json:"product_id"`
+	Size               string    `json:"size"`
+	Colour             string    `json:"colour"`
+	Pack               string    `json:"pack"`
+	PricePaise         int64     `json:"price_paise"`
+	OriginalPricePaise int64     `json:"original_price_paise"`
+	ImageUrl           string    `json:"image_url"`
+	SortOrder          int64     `json:"sort_order"`
+	CreatedAt          time.Time `json:"created_at"`
+	Stock              *int64    `json:"stock"`
+}
+
+type RecoveryCode struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	CodeHash  string     `json:"code_hash"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"user_id"`
+	UserAgent  string     `json:"user_agent"`
+	Ip         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CsrfToken  string     `json:"csrf_token"`
+	MfaPending int64      `json:"mfa_pending"`
+}
+
+type StockAdjustment struct {
+	ID         int64     `json:"id"`
+	ProductID  int64     `json:"product_id"`
+	VariantID  *int64    `json:"variant_id"`
+	Delta      int64     `json:"delta"`
+	StockAfter int64     `json:"stock_after"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type SyncRun struct {
+	ID         int64      `json:"id"`
+	Trigger    string     `json:"trigger"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Checked    int64      `json:"checked"`
+	Updated    int64      `json:"updated"`
+	Delisted   int64      `json:"delisted"`
+	Failed     int64      `json:"failed"`
+	Errors     string     `json:"errors"`
 }
 
 type Visitor struct {
@@ -54,4 +207,5 @@ type WaClick struct {
 	ProductID *int64    `json:"product_id"`
 	ClickType string    `json:"click_type"`
 	CreatedAt time.Time `json:"created_at"`
+	VariantID *int64    `json:"variant_id"`
 }
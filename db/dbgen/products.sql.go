@@ -19,7 +19,7 @@ func (q *Queries) DeleteProduct(ctx context.Context, id int64) error {
 }
 
 const getProduct = `-- name: GetProduct :one
-SELECT id, url, platform, title, price, original_price, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller FROM products WHERE id = ?
+SELECT id, url, platform, title, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller, price_paise, original_price_paise, discount_pct, stock, source_platform, source_id, synced_at, delisted_at, in_stock FROM products WHERE id = ?
 `
 
 func (q *Queries) GetProduct(ctx context.Context, id int64) (Product, error) {
@@ -30,8 +30,6 @@ func (q *Queries) GetProduct(ctx context.Context, id int64) (Product, error) {
 		&i.Url,
 		&i.Platform,
 		&i.Title,
-		&i.Price,
-		&i.OriginalPrice,
 		&i.ImageUrl,
 		&i.Description,
 		&i.Rating,
@@ -41,28 +39,157 @@ func (q *Queries) GetProduct(ctx context.Context, id int64) (Product, error) {
 		&i.LongDescription,
 		&i.IsNew,
 		&i.IsBestseller,
+		&i.PricePaise,
+		&i.OriginalPricePaise,
+		&i.DiscountPct,
+		&i.Stock,
+		&i.SourcePlatform,
+		&i.SourceID,
+		&i.SyncedAt,
+		&i.DelistedAt,
+		&i.InStock,
+	)
+	return i, err
+}
+
+const getProductBySource = `-- name: GetProductBySource :one
+SELECT id, url, platform, title, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller, price_paise, original_price_paise, discount_pct, stock, source_platform, source_id, synced_at, delisted_at, in_stock FROM products WHERE source_platform = ? AND source_id = ?
+`
+
+type GetProductBySourceParams struct {
+	SourcePlatform string `json:"source_platform"`
+	SourceID       string `json:"source_id"`
+}
+
+func (q *Queries) GetProductBySource(ctx context.Context, arg GetProductBySourceParams) (Product, error) {
+	row := q.db.QueryRowContext(ctx, getProductBySource, arg.SourcePlatform, arg.SourceID)
+	var i Product
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		&i.Platform,
+		&i.Title,
+		&i.ImageUrl,
+		&i.Description,
+		&i.Rating,
+		&i.AddedAt,
+		&i.Category,
+		&i.Images,
+		&i.LongDescription,
+		&i.IsNew,
+		&i.IsBestseller,
+		&i.PricePaise,
+		&i.OriginalPricePaise,
+		&i.DiscountPct,
+		&i.Stock,
+		&i.SourcePlatform,
+		&i.SourceID,
+		&i.SyncedAt,
+		&i.DelistedAt,
+		&i.InStock,
+	)
+	return i, err
+}
+
+const getProductByURL = `-- name: GetProductByURL :one
+SELECT id, url, platform, title, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller, price_paise, original_price_paise, discount_pct, stock, source_platform, source_id, synced_at, delisted_at, in_stock FROM products WHERE url = ? ORDER BY id LIMIT 1
+`
+
+// The oldest product with this listing URL, for matching spreadsheet rows.
+func (q *Queries) GetProductByURL(ctx context.Context, url string) (Product, error) {
+	row := q.db.QueryRowContext(ctx, getProductByURL, url)
+	var i Product
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		&i.Platform,
+		&i.Title,
+		&i.ImageUrl,
+		&i.Description,
+		&i.Rating,
+		&i.AddedAt,
+		&i.Category,
+		&i.Images,
+		&i.LongDescription,
+		&i.IsNew,
+		&i.IsBestseller,
+		&i.PricePaise,
+		&i.OriginalPricePaise,
+		&i.DiscountPct,
+		&i.Stock,
+		&i.SourcePlatform,
+		&i.SourceID,
+		&i.SyncedAt,
+		&i.DelistedAt,
+		&i.InStock,
+	)
+	return i, err
+}
+
+const getUnsourcedProductByURL = `-- name: GetUnsourcedProductByURL :one
+SELECT id, url, platform, title, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller, price_paise, original_price_paise, discount_pct, stock, source_platform, source_id, synced_at, delisted_at, in_stock FROM products
+WHERE platform = ? AND url = ? AND source_id = ''
+ORDER BY id
+LIMIT 1
+`
+
+type GetUnsourcedProductByURLParams struct {
+	Platform string `json:"platform"`
+	Url      string `json:"url"`
+}
+
+// A product imported before source IDs were recorded, matched by the
+// listing URL the importer built for it.
+func (q *Queries) GetUnsourcedProductByURL(ctx context.Context, arg GetUnsourcedProductByURLParams) (Product, error) {
+	row := q.db.QueryRowContext(ctx, getUnsourcedProductByURL, arg.Platform, arg.Url)
+	var i Product
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		&i.Platform,
+		&i.Title,
+		&i.ImageUrl,
+		&i.Description,
+		&i.Rating,
+		&i.AddedAt,
+		&i.Category,
+		&i.Images,
+		&i.LongDescription,
+		&i.IsNew,
+		&i.IsBestseller,
+		&i.PricePaise,
+		&i.OriginalPricePaise,
+		&i.DiscountPct,
+		&i.Stock,
+		&i.SourcePlatform,
+		&i.SourceID,
+		&i.SyncedAt,
+		&i.DelistedAt,
+		&i.InStock,
 	)
 	return i, err
 }
 
 const insertProduct = `-- name: InsertProduct :one
-INSERT INTO products (url, platform, title, price, original_price, image_url, description, rating, category, images, long_description)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-RETURNING id, url, platform, title, price, original_price, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller
+INSERT INTO products (url, platform, title, price_paise, original_price_paise, image_url, description, rating, category, images, long_description, source_platform, source_id)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, url, platform, title, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller, price_paise, original_price_paise, discount_pct, stock, source_platform, source_id, synced_at, delisted_at, in_stock
 `
 
 type InsertProductParams struct {
-	Url             string `json:"url"`
-	Platform        string `json:"platform"`
-	Title           string `json:"title"`
-	Price           string `json:"price"`
-	OriginalPrice   string `json:"original_price"`
-	ImageUrl        string `json:"image_url"`
-	Description     string `json:"description"`
-	Rating          string `json:"rating"`
-	Category        string `json:"category"`
-	Images          string `json:"images"`
-	LongDescription string `json:"long_description"`
+	Url                string `json:"url"`
+	Platform           string `json:"platform"`
+	Title              string `json:"title"`
+	PricePaise         int64  `json:"price_paise"`
+	OriginalPricePaise int64  `json:"original_price_paise"`
+	ImageUrl           string `json:"image_url"`
+	Description        string `json:"description"`
+	Rating             string `json:"rating"`
+	Category           string `json:"category"`
+	Images             string `json:"images"`
+	LongDescription    string `json:"long_description"`
+	SourcePlatform     string `json:"source_platform"`
+	SourceID           string `json:"source_id"`
 }
 
 func (q *Queries) InsertProduct(ctx context.Context, arg InsertProductParams) (Product, error) {
@@ -70,14 +197,16 @@ func (q *Queries) InsertProduct(ctx context.Context, arg InsertProductParams) (P
 		arg.Url,
 		arg.Platform,
 		arg.Title,
-		arg.Price,
-		arg.OriginalPrice,
+		arg.PricePaise,
+		arg.OriginalPricePaise,
 		arg.ImageUrl,
 		arg.Description,
 		arg.Rating,
 		arg.Category,
 		arg.Images,
 		arg.LongDescription,
+		arg.SourcePlatform,
+		arg.SourceID,
 	)
 	var i Product
 	err := row.Scan(
@@ -85,8 +214,6 @@ func (q *Queries) InsertProduct(ctx context.Context, arg InsertProductParams) (P
 		&i.Url,
 		&i.Platform,
 		&i.Title,
-		&i.Price,
-		&i.OriginalPrice,
 		&i.ImageUrl,
 		&i.Description,
 		&i.Rating,
@@ -96,12 +223,21 @@ func (q *Queries) InsertProduct(ctx context.Context, arg InsertProductParams) (P
 		&i.LongDescription,
 		&i.IsNew,
 		&i.IsBestseller,
+		&i.PricePaise,
+		&i.OriginalPricePaise,
+		&i.DiscountPct,
+		&i.Stock,
+		&i.SourcePlatform,
+		&i.SourceID,
+		&i.SyncedAt,
+		&i.DelistedAt,
+		&i.InStock,
 	)
 	return i, err
 }
 
 const listBestSellers = `-- name: ListBestSellers :many
-SELECT id, url, platform, title, price, original_price, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller FROM products WHERE is_bestseller = 1 ORDER BY added_at DESC
+SELECT id, url, platform, title, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller, price_paise, original_price_paise, discount_pct, stock, source_platform, source_id, synced_at, delisted_at, in_stock FROM products WHERE is_bestseller = 1 ORDER BY added_at DESC
 `
 
 func (q *Queries) ListBestSellers(ctx context.Context) ([]Product, error) {
@@ -118,8 +254,6 @@ func (q *Queries) ListBestSellers(ctx context.Context) ([]Product, error) {
 			&i.Url,
 			&i.Platform,
 			&i.Title,
-			&i.Price,
-			&i.OriginalPrice,
 			&i.ImageUrl,
 			&i.Description,
 			&i.Rating,
@@ -129,6 +263,15 @@ func (q *Queries) ListBestSellers(ctx context.Context) ([]Product, error) {
 			&i.LongDescription,
 			&i.IsNew,
 			&i.IsBestseller,
+			&i.PricePaise,
+			&i.OriginalPricePaise,
+			&i.DiscountPct,
+			&i.Stock,
+			&i.SourcePlatform,
+			&i.SourceID,
+			&i.SyncedAt,
+			&i.DelistedAt,
+			&i.InStock,
 		); err != nil {
 			return nil, err
 		}
@@ -171,7 +314,7 @@ func (q *Queries) ListCategories(ctx context.Context) ([]string, error) {
 }
 
 const listNewArrivals = `-- name: ListNewArrivals :many
-SELECT id, url, platform, title, price, original_price, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller FROM products WHERE is_new = 1 ORDER BY added_at DESC
+SELECT id, url, platform, title, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller, price_paise, original_price_paise, discount_pct, stock, source_platform, source_id, synced_at, delisted_at, in_stock FROM products WHERE is_new = 1 ORDER BY added_at DESC
 `
 
 func (q *Queries) ListNewArrivals(ctx context.Context) ([]Product, error) {
@@ -188,8 +331,6 @@ func (q *Queries) ListNewArrivals(ctx context.Context) ([]Product, error) {
 			&i.Url,
 			&i.Platform,
 			&i.Title,
-			&i.Price,
-			&i.OriginalPrice,
 			&i.ImageUrl,
 			&i.Description,
 			&i.Rating,
@@ -199,6 +340,15 @@ func (q *Queries) ListNewArrivals(ctx context.Context) ([]Product, error) {
 			&i.LongDescription,
 			&i.IsNew,
 			&i.IsBestseller,
+			&i.PricePaise,
+			&i.OriginalPricePaise,
+			&i.DiscountPct,
+			&i.Stock,
+			&i.SourcePlatform,
+			&i.SourceID,
+			&i.SyncedAt,
+			&i.DelistedAt,
+			&i.InStock,
 		); err != nil {
 			return nil, err
 		}
@@ -214,7 +364,7 @@ func (q *Queries) ListNewArrivals(ctx context.Context) ([]Product, error) {
 }
 
 const listProducts = `-- name: ListProducts :many
-SELECT id, url, platform, title, price, original_price, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller FROM products ORDER BY added_at DESC
+SELECT id, url, platform, title, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller, price_paise, original_price_paise, discount_pct, stock, source_platform, source_id, synced_at, delisted_at, in_stock FROM products ORDER BY added_at DESC
 `
 
 func (q *Queries) ListProducts(ctx context.Context) ([]Product, error) {
@@ -231,8 +381,6 @@ func (q *Queries) ListProducts(ctx context.Context) ([]Product, error) {
 			&i.Url,
 			&i.Platform,
 			&i.Title,
-			&i.Price,
-			&i.OriginalPrice,
 			&i.ImageUrl,
 			&i.Description,
 			&i.Rating,
@@ -242,6 +390,15 @@ func (q *Queries) ListProducts(ctx context.Context) ([]Product, error) {
 			&i.LongDescription,
 			&i.IsNew,
 			&i.IsBestseller,
+			&i.PricePaise,
+			&i.OriginalPricePaise,
+			&i.DiscountPct,
+			&i.Stock,
+			&i.SourcePlatform,
+			&i.SourceID,
+			&i.SyncedAt,
+			&i.DelistedAt,
+			&i.InStock,
 		); err != nil {
 			return nil, err
 		}
@@ -257,7 +414,7 @@ func (q *Queries) ListProducts(ctx context.Context) ([]Product, error) {
 }
 
 const listProductsByCategory = `-- name: ListProductsByCategory :many
-SELECT id, url, platform, title, price, original_price, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller FROM products WHERE category = ? ORDER BY added_at DESC
+SELECT id, url, platform, title, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller, price_paise, original_price_paise, discount_pct, stock, source_platform, source_id, synced_at, delisted_at, in_stock FROM products WHERE category = ? ORDER BY added_at DESC
 `
 
 func (q *Queries) ListProductsByCategory(ctx context.Context, category string) ([]Product, error) {
@@ -274,8 +431,6 @@ func (q *Queries) ListProductsByCategory(ctx context.Context, category string) (
 			&i.Url,
 			&i.Platform,
 			&i.Title,
-			&i.Price,
-			&i.OriginalPrice,
 			&i.ImageUrl,
 			&i.Description,
 			&i.Rating,
@@ -285,6 +440,15 @@ func (q *Queries) ListProductsByCategory(ctx context.Context, category string) (
 			&i.LongDescription,
 			&i.IsNew,
 			&i.IsBestseller,
+			&i.PricePaise,
+			&i.OriginalPricePaise,
+			&i.DiscountPct,
+			&i.Stock,
+			&i.SourcePlatform,
+			&i.SourceID,
+			&i.SyncedAt,
+			&i.DelistedAt,
+			&i.InStock,
 		); err != nil {
 			return nil, err
 		}
@@ -299,53 +463,69 @@ func (q *Queries) ListProductsByCategory(ctx context.Context, category string) (
 	return items, nil
 }
 
-const searchProducts = `-- name: SearchProducts :many
-SELECT id, url, platform, title, price, original_price, image_url, description, rating, added_at, category, images, long_description, is_new, is_bestseller FROM products WHERE title LIKE ? OR description LIKE ? OR category LIKE ? ORDER BY added_at DESC
+const restoreProduct = `-- name: RestoreProduct :exec
+INSERT INTO products (id, url, platform, title, price_paise, original_price_paise, image_url, description, rating, category, images, long_description, is_new, is_bestseller, stock, source_platform, source_id)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 `
 
-type SearchProductsParams struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Category    string `json:"category"`
+type RestoreProductParams struct {
+	ID                 int64  `json:"id"`
+	Url                string `json:"url"`
+	Platform           string `json:"platform"`
+	Title              string `json:"title"`
+	PricePaise         int64  `json:"price_paise"`
+	OriginalPricePaise int64  `json:"original_price_paise"`
+	ImageUrl           string `json:"image_url"`
+	Description        string `json:"description"`
+	Rating             string `json:"rating"`
+	Category           string `json:"category"`
+	Images             string `json:"images"`
+	LongDescription    string `json:"long_description"`
+	IsNew              int64  `json:"is_new"`
+	IsBestseller       int64  `json:"is_bestseller"`
+	Stock              *int64 `json:"stock"`
+	SourcePlatform     string `json:"source_platform"`
+	SourceID           string `json:"source_id"`
 }
 
-func (q *Queries) SearchProducts(ctx context.Context, arg SearchProductsParams) ([]Product, error) {
-	rows, err := q.db.QueryContext(ctx, searchProducts, arg.Title, arg.Description, arg.Category)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	items := []Product{}
-	for rows.Next() {
-		var i Product
-		if err := rows.Scan(
-			&i.ID,
-			&i.Url,
-			&i.Platform,
-			&i.Title,
-			&i.Price,
-			&i.OriginalPrice,
-			&i.ImageUrl,
-			&i.Description,
-			&i.Rating,
-			&i.AddedAt,
-			&i.Category,
-			&i.Images,
-			&i.LongDescription,
-			&i.IsNew,
-			&i.IsBestseller,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+// Re-creates a deleted product under its old ID, for reverting a delete.
+func (q *Queries) RestoreProduct(ctx context.Context, arg RestoreProductParams) error {
+	_, err := q.db.ExecContext(ctx, restoreProduct,
+		arg.ID,
+		arg.Url,
+		arg.Platform,
+		arg.Title,
+		arg.PricePaise,
+		arg.OriginalPricePaise,
+		arg.ImageUrl,
+		arg.Description,
+		arg.Rating,
+		arg.Category,
+		arg.Images,
+		arg.LongDescription,
+		arg.IsNew,
+		arg.IsBestseller,
+		arg.Stock,
+		arg.SourcePlatform,
+		arg.SourceID,
+	)
+	return err
+}
+
+const setProductSource = `-- name: SetProductSource :exec
+UPDATE products SET source_platform = ?, source_id = ? WHERE id = ?
+`
+
+type SetProductSourceParams struct {
+	SourcePlatform string `json:"source_platform"`
+	SourceID       string `json:"source_id"`
+	ID             int64  `json:"id"`
+}
+
+// Puts back the import listing a product came from, for reverting an edit.
+func (q *Queries) SetProductSource(ctx context.Context, arg SetProductSourceParams) error {
+	_, err := q.db.ExecContext(ctx, setProductSource, arg.SourcePlatform, arg.SourceID, arg.ID)
+	return err
 }
 
 const updateCategory = `-- name: UpdateCategory :exec
@@ -362,11 +542,46 @@ func (q *Queries) UpdateCategory(ctx context.Context, arg UpdateCategoryParams)
 	return err
 }
 
+const updateImportedProduct = `-- name: UpdateImportedProduct :exec
+UPDATE products
+SET price_paise = ?, original_price_paise = ?, image_url = ?, images = ?, rating = ?, url = ?, source_platform = ?, source_id = ?
+WHERE id = ?
+`
+
+type UpdateImportedProductParams struct {
+	PricePaise         int64  `json:"price_paise"`
+	OriginalPricePaise int64  `json:"original_price_paise"`
+	ImageUrl           string `json:"image_url"`
+	Images             string `json:"images"`
+	Rating             string `json:"rating"`
+	Url                string `json:"url"`
+	SourcePlatform     string `json:"source_platform"`
+	SourceID           string `json:"source_id"`
+	ID                 int64  `json:"id"`
+}
+
+// What a re-import refreshes; titles, descriptions and categories may
+// have been edited by hand and are left alone.
+func (q *Queries) UpdateImportedProduct(ctx context.Context, arg UpdateImportedProductParams) error {
+	_, err := q.db.ExecContext(ctx, updateImportedProduct,
+		arg.PricePaise,
+		arg.OriginalPricePaise,
+		arg.ImageUrl,
+		arg.Images,
+		arg.Rating,
+		arg.Url,
+		arg.SourcePlatform,
+		arg.SourceID,
+		arg.ID,
+	)
+	return err
+}
+
 const updateProduct = `-- name: UpdateProduct :exec
 UPDATE products SET
   title = ?,
-  price = ?,
-  original_price = ?,
+  price_paise = ?,
+  original_price_paise = ?,
   image_url = ?,
   description = ?,
   rating = ?,
@@ -381,27 +596,27 @@ WHERE id = ?
 `
 
 type UpdateProductParams struct {
-	Title           string `json:"title"`
-	Price           string `json:"price"`
-	OriginalPrice   string `json:"original_price"`
-	ImageUrl        string `json:"image_url"`
-	Description     string `json:"description"`
-	Rating          string `json:"rating"`
-	Category        string `json:"category"`
-	Images          string `json:"images"`
-	LongDescription string `json:"long_description"`
-	Url             string `json:"url"`
-	Platform        string `json:"platform"`
-	IsNew           int64  `json:"is_new"`
-	IsBestseller    int64  `json:"is_bestseller"`
-	ID              int64  `json:"id"`
+	Title              string `json:"title"`
+	PricePaise         int64  `json:"price_paise"`
+	OriginalPricePaise int64  `json:"original_price_paise"`
+	ImageUrl           string `json:"image_url"`
+	Description        string `json:"description"`
+	Rating             string `json:"rating"`
+	Category           string `json:"category"`
+	Images             string `json:"images"`
+	LongDescription    string `json:"long_description"`
+	Url                string `json:"url"`
+	Platform           string `json:"platform"`
+	IsNew              int64  `json:"is_new"`
+	IsBestseller       int64  `json:"is_bestseller"`
+	ID                 int64  `json:"id"`
 }
 
 func (q *Queries) UpdateProduct(ctx context.Context, arg UpdateProductParams) error {
 	_, err := q.db.ExecContext(ctx, updateProduct,
 		arg.Title,
-		arg.Price,
-		arg.OriginalPrice,
+		arg.PricePaise,
+		arg.OriginalPricePaise,
 		arg.ImageUrl,
 		arg.Description,
 		arg.Rating,
@@ -0,0 +1,29 @@
+-- Store prices as integer paise instead of free-form strings like "₹1,234".
+ALTER TABLE products ADD COLUMN price_paise INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE products ADD COLUMN original_price_paise INTEGER NOT NULL DEFAULT 0;
+
+-- Backfill from the old text columns, stripping currency markers and separators.
+UPDATE products SET
+  price_paise = CAST(ROUND(CAST(
+    REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(TRIM(price),
+      '₹', ''), 'Rs.', ''), 'Rs', ''), 'INR', ''), ',', ''), '/-', ''), ' ', '')
+    AS REAL) * 100) AS INTEGER),
+  original_price_paise = CAST(ROUND(CAST(
+    REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(TRIM(original_price),
+      '₹', ''), 'Rs.', ''), 'Rs', ''), 'INR', ''), ',', ''), '/-', ''), ' ', '')
+    AS REAL) * 100) AS INTEGER);
+
+ALTER TABLE products DROP COLUMN price;
+ALTER TABLE products DROP COLUMN original_price;
+
+-- Discount percentage, computed by SQLite so sorting and filtering never re-parse prices.
+ALTER TABLE products ADD COLUMN discount_pct INTEGER GENERATED ALWAYS AS (
+  CASE WHEN price_paise > 0 AND original_price_paise > price_paise
+    THEN ((original_price_paise - price_paise) * 100) / original_price_paise
+    ELSE 0 END
+) VIRTUAL;
+
+CREATE INDEX IF NOT EXISTS idx_products_price_paise ON products(price_paise);
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name)
+VALUES (008, '008-price-paise');
@@ -0,0 +1,23 @@
+-- Product variants: one listing sold in several sizes, colours or pack counts.
+-- Each variant carries its own price and optional image; the product row keeps
+-- the "from" price shown on listings.
+CREATE TABLE IF NOT EXISTS product_variants (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    size TEXT NOT NULL DEFAULT '',
+    colour TEXT NOT NULL DEFAULT '',
+    pack TEXT NOT NULL DEFAULT '',
+    price_paise INTEGER NOT NULL DEFAULT 0,
+    original_price_paise INTEGER NOT NULL DEFAULT 0,
+    image_url TEXT NOT NULL DEFAULT '',
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_variants_product_id ON product_variants(product_id);
+
+-- Record which variant a WhatsApp order click was for.
+ALTER TABLE wa_clicks ADD COLUMN variant_id INTEGER;
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name)
+VALUES (009, '009-product-variants');
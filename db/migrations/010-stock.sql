@@ -0,0 +1,24 @@
+-- Stock tracking. A NULL stock means the item isn't tracked and is always
+-- shown as available; existing products start out untracked.
+ALTER TABLE products ADD COLUMN stock INTEGER;
+ALTER TABLE product_variants ADD COLUMN stock INTEGER;
+
+ALTER TABLE products ADD COLUMN in_stock INTEGER NOT NULL GENERATED ALWAYS AS (
+  stock IS NULL OR stock > 0
+) VIRTUAL;
+
+-- Log of every stock change and the reason given for it.
+CREATE TABLE IF NOT EXISTS stock_adjustments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id INTEGER NOT NULL,
+    variant_id INTEGER,
+    delta INTEGER NOT NULL,
+    stock_after INTEGER NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_adjustments_product_id ON stock_adjustments(product_id);
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name)
+VALUES (010, '010-stock');
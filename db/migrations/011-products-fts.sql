@@ -0,0 +1,34 @@
+-- Full-text index over products for ranked search. External-content table:
+-- the text lives in products, the triggers below keep the index in step.
+CREATE VIRTUAL TABLE IF NOT EXISTS products_fts USING fts5(
+    title,
+    description,
+    long_description,
+    category,
+    content='products',
+    content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2',
+    prefix='2 3'
+);
+
+CREATE TRIGGER IF NOT EXISTS products_fts_ai AFTER INSERT ON products BEGIN
+    INSERT INTO products_fts (rowid, title, description, long_description, category)
+    VALUES (new.id, new.title, new.description, new.long_description, new.category);
+END;
+
+CREATE TRIGGER IF NOT EXISTS products_fts_ad AFTER DELETE ON products BEGIN
+    INSERT INTO products_fts (products_fts, rowid, title, description, long_description, category)
+    VALUES ('delete', old.id, old.title, old.description, old.long_description, old.category);
+END;
+
+CREATE TRIGGER IF NOT EXISTS products_fts_au AFTER UPDATE OF title, description, long_description, category ON products BEGIN
+    INSERT INTO products_fts (products_fts, rowid, title, description, long_description, category)
+    VALUES ('delete', old.id, old.title, old.description, old.long_description, old.category);
+    INSERT INTO products_fts (rowid, title, description, long_description, category)
+    VALUES (new.id, new.title, new.description, new.long_description, new.category);
+END;
+
+INSERT INTO products_fts (products_fts) VALUES ('rebuild');
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name)
+VALUES (011, '011-products-fts');
@@ -0,0 +1,6 @@
+-- Per-session CSRF token (synchronizer pattern). Sessions created before
+-- this migration have an empty token and must log in again.
+ALTER TABLE sessions ADD COLUMN csrf_token TEXT NOT NULL DEFAULT '';
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name)
+VALUES (013, '013-session-csrf');
@@ -0,0 +1,24 @@
+-- Optional TOTP two-factor authentication (RFC 6238). totp_secret is the
+-- base32 shared secret; it is set during enrolment and only enforced once
+-- totp_enabled is 1. totp_last_step is the time step of the last accepted
+-- code, so a code can't be replayed.
+ALTER TABLE admin_users ADD COLUMN totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE admin_users ADD COLUMN totp_enabled INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE admin_users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+
+-- One-time recovery codes, stored as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES admin_users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes(user_id);
+
+-- A session that has passed the password step but still needs a code.
+ALTER TABLE sessions ADD COLUMN mfa_pending INTEGER NOT NULL DEFAULT 0;
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name)
+VALUES (015, '015-totp');
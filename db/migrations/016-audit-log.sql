@@ -0,0 +1,23 @@
+-- Who changed what in the catalogue. before_json and after_json are
+-- product snapshots (empty when the product didn't exist on that side of
+-- the change) and diff lists the fields that changed as
+-- {"field": [before, after]}. Uploads have no product and keep the file in
+-- after_json.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER,
+    actor TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    product_id INTEGER,
+    before_json TEXT NOT NULL DEFAULT '',
+    after_json TEXT NOT NULL DEFAULT '',
+    diff TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_product_id ON audit_log(product_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor);
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name)
+VALUES (016, '016-audit-log');
@@ -0,0 +1,23 @@
+-- Progress of Meesho store imports, saved after every listing page so an
+-- import interrupted by a restart carries on from the page it reached.
+-- finished_at stays NULL until the import completes or gives up.
+CREATE TABLE IF NOT EXISTS bulk_import_progress (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    store_url TEXT NOT NULL,
+    next_page INTEGER NOT NULL DEFAULT 1,
+    total INTEGER NOT NULL DEFAULT 0,
+    seen INTEGER NOT NULL DEFAULT 0,
+    imported INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    message TEXT NOT NULL DEFAULT '',
+    user_id INTEGER,
+    actor TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name)
+VALUES (017, '017-bulk-import-progress');
@@ -0,0 +1,15 @@
+-- Where an imported product came from: the platform's own product ID, so
+-- re-importing updates the product instead of matching it by title.
+-- Products added by hand have no source.
+ALTER TABLE products ADD COLUMN source_platform TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN source_id TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_products_source ON products(source_platform, source_id)
+WHERE source_id != '';
+
+-- Store imports now count products they refreshed separately from ones
+-- that were already up to date.
+ALTER TABLE bulk_import_progress ADD COLUMN updated INTEGER NOT NULL DEFAULT 0;
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name)
+VALUES (018, '018-product-source');
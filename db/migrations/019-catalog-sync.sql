@@ -0,0 +1,40 @@
+-- Scheduled catalogue sync. synced_at is when a product's source page was
+-- last checked. delisted_at is set when that page is gone (404 or 410) and
+-- cleared if it comes back; delisted products count as out of stock, so
+-- in_stock is redefined to include it.
+ALTER TABLE products ADD COLUMN synced_at TIMESTAMP;
+ALTER TABLE products ADD COLUMN delisted_at TIMESTAMP;
+
+ALTER TABLE products DROP COLUMN in_stock;
+ALTER TABLE products ADD COLUMN in_stock INTEGER NOT NULL GENERATED ALWAYS AS (
+  (stock IS NULL OR stock > 0) AND delisted_at IS NULL
+) VIRTUAL;
+
+-- A product's price from recorded_at on. The sync adds a row whenever the
+-- price it finds differs from ours.
+CREATE TABLE IF NOT EXISTS price_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id INTEGER NOT NULL,
+    price_paise INTEGER NOT NULL,
+    original_price_paise INTEGER NOT NULL DEFAULT 0,
+    recorded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_history_product_id ON price_history(product_id);
+
+-- One row per sync, scheduled or started by hand. errors is a JSON array
+-- of the first few failures.
+CREATE TABLE IF NOT EXISTS sync_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    trigger TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP,
+    checked INTEGER NOT NULL DEFAULT 0,
+    updated INTEGER NOT NULL DEFAULT 0,
+    delisted INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    errors TEXT NOT NULL DEFAULT '[]'
+);
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name)
+VALUES (019, '019-catalog-sync');
@@ -0,0 +1,60 @@
+-- Imports run as jobs from a queue that a pool of workers works through,
+-- replacing bulk_import_progress. kind is "store" (walk a Meesho store's
+-- listing from store_url) or "json" (products pasted as JSON, kept in
+-- payload). state is queued, running, done, failed or cancelled. A store
+-- job resumes from next_page and a json job from item number seen.
+CREATE TABLE IF NOT EXISTS import_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    state TEXT NOT NULL DEFAULT 'queued',
+    store_url TEXT NOT NULL DEFAULT '',
+    payload TEXT NOT NULL DEFAULT '',
+    next_page INTEGER NOT NULL DEFAULT 1,
+    total INTEGER NOT NULL DEFAULT 0,
+    seen INTEGER NOT NULL DEFAULT 0,
+    imported INTEGER NOT NULL DEFAULT 0,
+    updated INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    message TEXT NOT NULL DEFAULT '',
+    user_id INTEGER,
+    actor TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_jobs_state ON import_jobs(state);
+
+-- What became of each product a job looked at. outcome is created,
+-- updated, unchanged or failed.
+CREATE TABLE IF NOT EXISTS import_job_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id INTEGER NOT NULL,
+    source_id TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL DEFAULT '',
+    url TEXT NOT NULL DEFAULT '',
+    outcome TEXT NOT NULL,
+    product_id INTEGER,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_job_items_job_id ON import_job_items(job_id);
+
+-- An import a restart interrupted goes back in the queue to carry on.
+INSERT INTO import_jobs (kind, state, store_url, next_page, total, seen, imported, updated, skipped, failed,
+                         message, user_id, actor, ip, created_at, started_at, updated_at, finished_at)
+SELECT 'store',
+       CASE WHEN finished_at IS NULL THEN 'queued' WHEN message LIKE 'Error%' THEN 'failed' ELSE 'done' END,
+       store_url, next_page, total, seen, imported, updated, skipped, failed,
+       message, user_id, actor, ip, started_at, started_at, updated_at, finished_at
+FROM bulk_import_progress
+ORDER BY id;
+
+DROP TABLE bulk_import_progress;
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name)
+VALUES (020, '020-import-jobs');
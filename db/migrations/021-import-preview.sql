@@ -0,0 +1,12 @@
+-- Preview imports stage what they would do instead of doing it. Their
+-- items keep the product row they would write in params, and the job
+-- waits in state "review" until an admin accepts, edits or rejects each
+-- item and commits. decision is '' outside previews, then pending,
+-- accepted or rejected.
+ALTER TABLE import_jobs ADD COLUMN preview INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE import_job_items ADD COLUMN params TEXT NOT NULL DEFAULT '';
+ALTER TABLE import_job_items ADD COLUMN decision TEXT NOT NULL DEFAULT '';
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name)
+VALUES (021, '021-import-preview');
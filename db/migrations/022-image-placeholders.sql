@@ -0,0 +1,10 @@
+-- Blurred, tiny versions of product images shown while the real ones
+-- load, as data: URLs, keyed by the image URL as stored on products.
+CREATE TABLE IF NOT EXISTS image_placeholders (
+    url TEXT PRIMARY KEY,
+    data TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT OR IGNORE INTO migrations (migration_number, migration_name)
+VALUES (022, '022-image-placeholders');
@@ -0,0 +1,87 @@
+-- name: CountAdminUsers :one
+SELECT COUNT(*) FROM admin_users;
+
+-- name: CountActiveOwners :one
+SELECT COUNT(*) FROM admin_users WHERE role = 'owner' AND disabled = 0;
+
+-- name: ListAdminUsers :many
+SELECT * FROM admin_users ORDER BY id;
+
+-- name: GetAdminUser :one
+SELECT * FROM admin_users WHERE id = ?;
+
+-- name: GetAdminUserByUsername :one
+SELECT * FROM admin_users WHERE username = ?;
+
+-- name: InsertAdminUser :one
+INSERT INTO admin_users (username, name, password_hash, role)
+VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: UpdateAdminUser :exec
+UPDATE admin_users SET name = ?, role = ?, disabled = ? WHERE id = ?;
+
+-- name: SetAdminUserPassword :exec
+UPDATE admin_users SET password_hash = ? WHERE id = ?;
+
+-- name: TouchAdminUserLogin :exec
+UPDATE admin_users SET last_login_at = CURRENT_TIMESTAMP WHERE id = ?;
+
+-- name: SetTOTPSecret :exec
+-- SetTOTPSecret starts (or restarts) enrolment; the secret isn't enforced
+-- until EnableTOTP.
+UPDATE admin_users SET totp_secret = ?, totp_enabled = 0, totp_last_step = 0 WHERE id = ?;
+
+-- name: EnableTOTP :exec
+UPDATE admin_users SET totp_enabled = 1, totp_last_step = ? WHERE id = ?;
+
+-- name: SetTOTPLastStep :execrows
+-- Records the step of a TOTP code as used. No rows are updated if it, or a
+-- later one, already was, such as by a concurrent login with the same code.
+UPDATE admin_users SET totp_last_step = sqlc.arg(step)
+WHERE id = sqlc.arg(id) AND totp_last_step < sqlc.arg(step);
+
+-- name: DisableTOTP :exec
+UPDATE admin_users SET totp_secret = '', totp_enabled = 0, totp_last_step = 0 WHERE id = ?;
+
+-- name: InsertRecoveryCode :exec
+INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?);
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = ? AND code_hash = ? AND used_at IS NULL;
+
+-- name: CountRecoveryCodes :one
+SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes WHERE user_id = ?;
+
+-- name: DeleteAdminUser :exec
+DELETE FROM admin_users WHERE id = ?;
+
+-- name: InsertSession :exec
+INSERT INTO sessions (id, user_id, user_agent, ip, expires_at, csrf_token, mfa_pending)
+VALUES (?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetSession :one
+-- GetSession returns a session and its user. Callers check revoked_at,
+-- expires_at and the user's disabled flag.
+SELECT sqlc.embed(s), sqlc.embed(u)
+FROM sessions s JOIN admin_users u ON u.id = s.user_id
+WHERE s.id = ?;
+
+-- name: TouchSession :exec
+UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP WHERE id = ?;
+
+-- name: ListUserSessions :many
+SELECT * FROM sessions WHERE user_id = ? AND revoked_at IS NULL ORDER BY last_seen_at DESC;
+
+-- name: RevokeSession :exec
+UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL;
+
+-- name: RevokeUserSessions :exec
+UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = ? AND revoked_at IS NULL;
+
+-- name: DeleteUserSessions :exec
+DELETE FROM sessions WHERE user_id = ?;
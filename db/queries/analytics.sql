@@ -3,7 +3,7 @@ INSERT INTO page_views (path, product_id, referrer, user_agent, visitor_id)
 VALUES (?, ?, ?, ?, ?);
 
 -- name: InsertWAClick :exec
-INSERT INTO wa_clicks (product_id, click_type) VALUES (?, ?);
+INSERT INTO wa_clicks (product_id, click_type, variant_id) VALUES (?, ?, ?);
 
 -- name: ViewsPerDay :many
 SELECT DATE(created_at) as day, COUNT(*) as views
@@ -0,0 +1,24 @@
+-- name: InsertAuditEntry :exec
+INSERT INTO audit_log (user_id, actor, action, product_id, before_json, after_json, diff, ip)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetAuditEntry :one
+SELECT * FROM audit_log WHERE id = ?;
+
+-- name: ListAuditEntries :many
+-- Newest first. Empty / zero filter arguments mean "no filter".
+SELECT * FROM audit_log
+WHERE (CAST(sqlc.arg(actor) AS TEXT) = '' OR actor = sqlc.arg(actor))
+  AND (CAST(sqlc.arg(action) AS TEXT) = '' OR action = sqlc.arg(action))
+  AND (CAST(sqlc.arg(product_id) AS INTEGER) = 0 OR product_id = sqlc.arg(product_id))
+ORDER BY id DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: CountAuditEntries :one
+SELECT COUNT(*) FROM audit_log
+WHERE (CAST(sqlc.arg(actor) AS TEXT) = '' OR actor = sqlc.arg(actor))
+  AND (CAST(sqlc.arg(action) AS TEXT) = '' OR action = sqlc.arg(action))
+  AND (CAST(sqlc.arg(product_id) AS INTEGER) = 0 OR product_id = sqlc.arg(product_id));
+
+-- name: ListAuditActors :many
+SELECT DISTINCT actor FROM audit_log ORDER BY actor;
@@ -0,0 +1,6 @@
+-- name: ListImagePlaceholders :many
+SELECT * FROM image_placeholders;
+
+-- name: UpsertImagePlaceholder :exec
+INSERT INTO image_placeholders (url, data) VALUES (?, ?)
+ON CONFLICT (url) DO UPDATE SET data = excluded.data, created_at = CURRENT_TIMESTAMP;
@@ -0,0 +1,85 @@
+-- name: InsertImportJob :one
+INSERT INTO import_jobs (kind, store_url, payload, preview, message, user_id, actor, ip)
+VALUES (?, ?, ?, ?, 'Waiting for a free worker...', ?, ?, ?)
+RETURNING *;
+
+-- name: ClaimImportJob :one
+-- Takes the oldest queued job for a worker. One statement, so two workers
+-- never get the same job.
+UPDATE import_jobs
+SET state = 'running', started_at = COALESCE(started_at, CURRENT_TIMESTAMP), updated_at = CURRENT_TIMESTAMP
+WHERE id = (SELECT id FROM import_jobs WHERE state = 'queued' ORDER BY id LIMIT 1)
+RETURNING *;
+
+-- name: RequeueRunningImportJobs :exec
+-- Jobs left running by a restart go back in the queue.
+UPDATE import_jobs SET state = 'queued', message = 'Resuming after a restart...' WHERE state = 'running';
+
+-- name: GetImportJob :one
+SELECT * FROM import_jobs WHERE id = ?;
+
+-- name: GetLatestImportJob :one
+SELECT * FROM import_jobs ORDER BY id DESC LIMIT 1;
+
+-- name: ListImportJobs :many
+SELECT * FROM import_jobs ORDER BY id DESC LIMIT ?;
+
+-- name: CountActiveStoreImports :one
+SELECT COUNT(*) FROM import_jobs
+WHERE kind = 'store' AND store_url = ? AND state IN ('queued', 'running');
+
+-- name: UpdateImportJobProgress :exec
+UPDATE import_jobs
+SET next_page = ?, total = ?, seen = ?, imported = ?, updated = ?, skipped = ?, failed = ?, message = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: SetImportJobMessage :exec
+UPDATE import_jobs SET message = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?;
+
+-- name: FinishImportJob :exec
+UPDATE import_jobs
+SET state = ?, message = ?, finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: CancelWaitingImportJob :execrows
+-- Cancels a job that is queued, or discards a preview awaiting review.
+UPDATE import_jobs
+SET state = 'cancelled',
+    message = CASE state WHEN 'review' THEN 'Preview discarded' ELSE 'Cancelled before it started' END,
+    finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND state IN ('queued', 'review');
+
+-- name: RetryImportJob :execrows
+-- Puts a failed or cancelled job back in the queue to carry on from where
+-- it stopped.
+UPDATE import_jobs
+SET state = 'queued', message = 'Queued to retry...', finished_at = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = ? AND state IN ('failed', 'cancelled');
+
+-- name: InsertImportJobItem :exec
+INSERT INTO import_job_items (job_id, source_id, title, url, outcome, product_id, error, params, decision)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: UpdateImportJobItem :exec
+-- Records the decision on a staged item and what committing it did.
+UPDATE import_job_items
+SET title = ?, outcome = ?, product_id = ?, error = ?, params = ?, decision = ?
+WHERE id = ?;
+
+-- name: FinishImportReview :exec
+UPDATE import_jobs
+SET state = 'done', imported = ?, updated = ?, skipped = ?, failed = ?, message = ?,
+    finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: ListImportJobItems :many
+SELECT * FROM import_job_items WHERE job_id = ? ORDER BY id;
+
+-- name: ListImportJobErrors :many
+SELECT error FROM import_job_items
+WHERE job_id = ? AND outcome = 'failed'
+ORDER BY id
+LIMIT ?;
+
+-- name: ListImportJobSourceIDs :many
+SELECT source_id FROM import_job_items WHERE job_id = ? AND source_id != '';
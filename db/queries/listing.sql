@@ -0,0 +1,165 @@
+-- name: ListCategoryProducts :many
+-- Category listing with facet filters, sorting and paging. Zero / empty
+-- filter arguments mean "no filter"; prices are in paise.
+SELECT * FROM products p
+WHERE p.category = sqlc.arg(category)
+  AND (CAST(sqlc.arg(min_price) AS INTEGER) = 0 OR p.price_paise >= sqlc.arg(min_price))
+  AND (CAST(sqlc.arg(max_price) AS INTEGER) = 0 OR p.price_paise <= sqlc.arg(max_price))
+  AND CAST(p.rating AS REAL) >= CAST(sqlc.arg(min_rating) AS REAL)
+  AND (CAST(sqlc.arg(platform) AS TEXT) = '' OR p.platform = sqlc.arg(platform))
+  AND p.discount_pct >= CAST(sqlc.arg(min_discount) AS INTEGER)
+  AND p.is_new >= CAST(sqlc.arg(is_new) AS INTEGER)
+  AND p.is_bestseller >= CAST(sqlc.arg(is_bestseller) AS INTEGER)
+  AND (p.in_stock = 1 OR CAST(sqlc.arg(stock_policy) AS TEXT) <> 'hide')
+ORDER BY
+  CASE WHEN CAST(sqlc.arg(stock_policy) AS TEXT) = 'demote' THEN p.in_stock END DESC,
+  CASE WHEN CAST(sqlc.arg(sort) AS TEXT) = 'price-asc' THEN p.price_paise END ASC,
+  CASE WHEN CAST(sqlc.arg(sort) AS TEXT) = 'price-desc' THEN p.price_paise END DESC,
+  CASE WHEN CAST(sqlc.arg(sort) AS TEXT) = 'discount' THEN p.discount_pct END DESC,
+  CASE WHEN CAST(sqlc.arg(sort) AS TEXT) = 'rating' THEN CAST(p.rating AS REAL) END DESC,
+  CASE WHEN CAST(sqlc.arg(sort) AS TEXT) = 'bestseller' THEN p.is_bestseller END DESC,
+  CASE WHEN CAST(sqlc.arg(sort) AS TEXT) = 'newest' THEN p.added_at END DESC,
+  p.added_at DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: CountCategoryProducts :one
+SELECT COUNT(*) FROM products p
+WHERE p.category = sqlc.arg(category)
+  AND (CAST(sqlc.arg(min_price) AS INTEGER) = 0 OR p.price_paise >= sqlc.arg(min_price))
+  AND (CAST(sqlc.arg(max_price) AS INTEGER) = 0 OR p.price_paise <= sqlc.arg(max_price))
+  AND CAST(p.rating AS REAL) >= CAST(sqlc.arg(min_rating) AS REAL)
+  AND (CAST(sqlc.arg(platform) AS TEXT) = '' OR p.platform = sqlc.arg(platform))
+  AND p.discount_pct >= CAST(sqlc.arg(min_discount) AS INTEGER)
+  AND p.is_new >= CAST(sqlc.arg(is_new) AS INTEGER)
+  AND p.is_bestseller >= CAST(sqlc.arg(is_bestseller) AS INTEGER)
+  AND (p.in_stock = 1 OR CAST(sqlc.arg(stock_policy) AS TEXT) <> 'hide');
+
+-- name: CategoryFacetCounts :many
+-- Per-option counts for the category facets. Each facet's counts apply every
+-- other active filter but not its own, so options stay selectable.
+WITH base AS (
+  SELECT p.platform, p.price_paise, p.discount_pct, p.is_new, p.is_bestseller,
+    CAST(p.rating AS REAL) AS rating_num,
+    (CAST(sqlc.arg(min_price) AS INTEGER) = 0 OR p.price_paise >= sqlc.arg(min_price))
+      AND (CAST(sqlc.arg(max_price) AS INTEGER) = 0 OR p.price_paise <= sqlc.arg(max_price)) AS f_price,
+    CAST(p.rating AS REAL) >= CAST(sqlc.arg(min_rating) AS REAL) AS f_rating,
+    (CAST(sqlc.arg(platform) AS TEXT) = '' OR p.platform = sqlc.arg(platform)) AS f_platform,
+    p.discount_pct >= CAST(sqlc.arg(min_discount) AS INTEGER) AS f_discount,
+    p.is_new >= CAST(sqlc.arg(is_new) AS INTEGER) AS f_new,
+    p.is_bestseller >= CAST(sqlc.arg(is_bestseller) AS INTEGER) AS f_best
+  FROM products p
+  WHERE p.category = sqlc.arg(category)
+    AND (p.in_stock = 1 OR CAST(sqlc.arg(stock_policy) AS TEXT) <> 'hide')
+)
+SELECT CAST('platform' AS TEXT) AS facet, platform AS value, COUNT(*) AS n FROM base
+WHERE f_price AND f_rating AND f_discount AND f_new AND f_best
+GROUP BY platform
+UNION ALL
+SELECT 'price', CASE
+    WHEN price_paise < 20000 THEN '0-200'
+    WHEN price_paise < 50000 THEN '200-500'
+    WHEN price_paise < 100000 THEN '500-1000'
+    ELSE '1000-' END, COUNT(*) FROM base
+WHERE price_paise > 0 AND f_rating AND f_platform AND f_discount AND f_new AND f_best
+GROUP BY 2
+UNION ALL
+SELECT 'rating', '4', COUNT(*) FROM base WHERE rating_num >= 4 AND f_price AND f_platform AND f_discount AND f_new AND f_best
+UNION ALL
+SELECT 'rating', '3', COUNT(*) FROM base WHERE rating_num >= 3 AND f_price AND f_platform AND f_discount AND f_new AND f_best
+UNION ALL
+SELECT 'discount', '50', COUNT(*) FROM base WHERE discount_pct >= 50 AND f_price AND f_rating AND f_platform AND f_new AND f_best
+UNION ALL
+SELECT 'discount', '25', COUNT(*) FROM base WHERE discount_pct >= 25 AND f_price AND f_rating AND f_platform AND f_new AND f_best
+UNION ALL
+SELECT 'discount', '10', COUNT(*) FROM base WHERE discount_pct >= 10 AND f_price AND f_rating AND f_platform AND f_new AND f_best
+UNION ALL
+SELECT 'new', '1', COUNT(*) FROM base WHERE is_new = 1 AND f_price AND f_rating AND f_platform AND f_discount AND f_best
+UNION ALL
+SELECT 'bestseller', '1', COUNT(*) FROM base WHERE is_bestseller = 1 AND f_price AND f_rating AND f_platform AND f_discount AND f_new;
+
+-- name: SearchProducts :many
+-- Ranked full-text search with the same filters as ListCategoryProducts.
+-- bm25 weights follow the products_fts column order (title, description,
+-- long_description, category) so title hits rank first. Highlight markers are
+-- \x02 and \x03; the handler turns them into <mark>.
+SELECT sqlc.embed(p),
+  CAST(highlight(products_fts, 0, char(2), char(3)) AS TEXT) AS title_highlight,
+  CAST(snippet(products_fts, -1, char(2), char(3), '…', 16) AS TEXT) AS snippet
+FROM products_fts
+JOIN products p ON p.id = products_fts.rowid
+WHERE products_fts MATCH CAST(sqlc.arg(query) AS TEXT)
+  AND (CAST(sqlc.arg(min_price) AS INTEGER) = 0 OR p.price_paise >= sqlc.arg(min_price))
+  AND (CAST(sqlc.arg(max_price) AS INTEGER) = 0 OR p.price_paise <= sqlc.arg(max_price))
+  AND CAST(p.rating AS REAL) >= CAST(sqlc.arg(min_rating) AS REAL)
+  AND (CAST(sqlc.arg(platform) AS TEXT) = '' OR p.platform = sqlc.arg(platform))
+  AND p.discount_pct >= CAST(sqlc.arg(min_discount) AS INTEGER)
+  AND p.is_new >= CAST(sqlc.arg(is_new) AS INTEGER)
+  AND p.is_bestseller >= CAST(sqlc.arg(is_bestseller) AS INTEGER)
+  AND (p.in_stock = 1 OR CAST(sqlc.arg(stock_policy) AS TEXT) <> 'hide')
+ORDER BY
+  CASE WHEN CAST(sqlc.arg(stock_policy) AS TEXT) = 'demote' THEN p.in_stock END DESC,
+  CASE WHEN CAST(sqlc.arg(sort) AS TEXT) = 'price-asc' THEN p.price_paise END ASC,
+  CASE WHEN CAST(sqlc.arg(sort) AS TEXT) = 'price-desc' THEN p.price_paise END DESC,
+  CASE WHEN CAST(sqlc.arg(sort) AS TEXT) = 'discount' THEN p.discount_pct END DESC,
+  CASE WHEN CAST(sqlc.arg(sort) AS TEXT) = 'rating' THEN CAST(p.rating AS REAL) END DESC,
+  CASE WHEN CAST(sqlc.arg(sort) AS TEXT) = 'bestseller' THEN p.is_bestseller END DESC,
+  CASE WHEN CAST(sqlc.arg(sort) AS TEXT) = 'newest' THEN p.added_at END DESC,
+  bm25(products_fts, 10.0, 3.0, 1.0, 5.0)
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: CountSearchProducts :one
+SELECT COUNT(*)
+FROM products_fts
+JOIN products p ON p.id = products_fts.rowid
+WHERE products_fts MATCH CAST(sqlc.arg(query) AS TEXT)
+  AND (CAST(sqlc.arg(min_price) AS INTEGER) = 0 OR p.price_paise >= sqlc.arg(min_price))
+  AND (CAST(sqlc.arg(max_price) AS INTEGER) = 0 OR p.price_paise <= sqlc.arg(max_price))
+  AND CAST(p.rating AS REAL) >= CAST(sqlc.arg(min_rating) AS REAL)
+  AND (CAST(sqlc.arg(platform) AS TEXT) = '' OR p.platform = sqlc.arg(platform))
+  AND p.discount_pct >= CAST(sqlc.arg(min_discount) AS INTEGER)
+  AND p.is_new >= CAST(sqlc.arg(is_new) AS INTEGER)
+  AND p.is_bestseller >= CAST(sqlc.arg(is_bestseller) AS INTEGER)
+  AND (p.in_stock = 1 OR CAST(sqlc.arg(stock_policy) AS TEXT) <> 'hide');
+
+-- name: SearchFacetCounts :many
+-- Facet counts for search results; see CategoryFacetCounts.
+WITH base AS (
+  SELECT p.platform, p.price_paise, p.discount_pct, p.is_new, p.is_bestseller,
+    CAST(p.rating AS REAL) AS rating_num,
+    (CAST(sqlc.arg(min_price) AS INTEGER) = 0 OR p.price_paise >= sqlc.arg(min_price))
+      AND (CAST(sqlc.arg(max_price) AS INTEGER) = 0 OR p.price_paise <= sqlc.arg(max_price)) AS f_price,
+    CAST(p.rating AS REAL) >= CAST(sqlc.arg(min_rating) AS REAL) AS f_rating,
+    (CAST(sqlc.arg(platform) AS TEXT) = '' OR p.platform = sqlc.arg(platform)) AS f_platform,
+    p.discount_pct >= CAST(sqlc.arg(min_discount) AS INTEGER) AS f_discount,
+    p.is_new >= CAST(sqlc.arg(is_new) AS INTEGER) AS f_new,
+    p.is_bestseller >= CAST(sqlc.arg(is_bestseller) AS INTEGER) AS f_best
+  FROM products_fts
+  JOIN products p ON p.id = products_fts.rowid
+  WHERE products_fts MATCH CAST(sqlc.arg(query) AS TEXT)
+    AND (p.in_stock = 1 OR CAST(sqlc.arg(stock_policy) AS TEXT) <> 'hide')
+)
+SELECT CAST('platform' AS TEXT) AS facet, platform AS value, COUNT(*) AS n FROM base
+WHERE f_price AND f_rating AND f_discount AND f_new AND f_best
+GROUP BY platform
+UNION ALL
+SELECT 'price', CASE
+    WHEN price_paise < 20000 THEN '0-200'
+    WHEN price_paise < 50000 THEN '200-500'
+    WHEN price_paise < 100000 THEN '500-1000'
+    ELSE '1000-' END, COUNT(*) FROM base
+WHERE price_paise > 0 AND f_rating AND f_platform AND f_discount AND f_new AND f_best
+GROUP BY 2
+UNION ALL
+SELECT 'rating', '4', COUNT(*) FROM base WHERE rating_num >= 4 AND f_price AND f_platform AND f_discount AND f_new AND f_best
+UNION ALL
+SELECT 'rating', '3', COUNT(*) FROM base WHERE rating_num >= 3 AND f_price AND f_platform AND f_discount AND f_new AND f_best
+UNION ALL
+SELECT 'discount', '50', COUNT(*) FROM base WHERE discount_pct >= 50 AND f_price AND f_rating AND f_platform AND f_new AND f_best
+UNION ALL
+SELECT 'discount', '25', COUNT(*) FROM base WHERE discount_pct >= 25 AND f_price AND f_rating AND f_platform AND f_new AND f_best
+UNION ALL
+SELECT 'discount', '10', COUNT(*) FROM base WHERE discount_pct >= 10 AND f_price AND f_rating AND f_platform AND f_new AND f_best
+UNION ALL
+SELECT 'new', '1', COUNT(*) FROM base WHERE is_new = 1 AND f_price AND f_rating AND f_platform AND f_discount AND f_best
+UNION ALL
+SELECT 'bestseller', '1', COUNT(*) FROM base WHERE is_bestseller = 1 AND f_price AND f_rating AND f_platform AND f_discount AND f_new;
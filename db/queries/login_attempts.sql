@@ -0,0 +1,40 @@
+-- name: InsertLoginAttempt :exec
+INSERT INTO login_attempts (ip, username, success, reason, user_agent)
+VALUES (?, ?, ?, ?, ?);
+
+-- name: LoginFailuresByIP :one
+-- Failed attempts from one IP within the window (an SQLite datetime
+-- modifier such as '-900 seconds') and since its last successful login,
+-- with the seconds elapsed since the most recent one. Throttled attempts
+-- don't count, so waiting out a backoff is enough to try again.
+SELECT
+  COUNT(*) AS failures,
+  CAST(COALESCE(strftime('%s', 'now') - strftime('%s', MAX(created_at)), 0) AS INTEGER) AS seconds_since_last
+FROM login_attempts
+WHERE ip = sqlc.arg(ip) AND success = 0 AND reason != 'throttled'
+  AND created_at >= datetime('now', CAST(sqlc.arg(window) AS TEXT))
+  AND id > COALESCE((SELECT MAX(id) FROM login_attempts WHERE ip = sqlc.arg(ip) AND success = 1), 0);
+
+-- name: LoginFailuresByAccount :one
+-- LoginFailuresByIP for one username from one IP, since that username's
+-- last successful login from there.
+SELECT
+  COUNT(*) AS failures,
+  CAST(COALESCE(strftime('%s', 'now') - strftime('%s', MAX(created_at)), 0) AS INTEGER) AS seconds_since_last
+FROM login_attempts
+WHERE ip = sqlc.arg(ip) AND username = sqlc.arg(username) COLLATE NOCASE AND success = 0 AND reason != 'throttled'
+  AND created_at >= datetime('now', CAST(sqlc.arg(window) AS TEXT))
+  AND id > COALESCE((SELECT MAX(id) FROM login_attempts
+                     WHERE ip = sqlc.arg(ip) AND username = sqlc.arg(username) COLLATE NOCASE AND success = 1), 0);
+
+-- name: CountRecentLoginFailures :one
+-- Failed attempts from every IP within the window, for the global limit.
+SELECT COUNT(*) FROM login_attempts
+WHERE success = 0 AND reason != 'throttled'
+  AND created_at >= datetime('now', CAST(sqlc.arg(window) AS TEXT));
+
+-- name: ListLoginAttempts :many
+SELECT * FROM login_attempts ORDER BY id DESC LIMIT 100;
+
+-- name: DeleteOldLoginAttempts :exec
+DELETE FROM login_attempts WHERE created_at < datetime('now', '-30 days');
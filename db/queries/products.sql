@@ -1,6 +1,6 @@
 -- name: InsertProduct :one
-INSERT INTO products (url, platform, title, price, original_price, image_url, description, rating, category, images, long_description)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+INSERT INTO products (url, platform, title, price_paise, original_price_paise, image_url, description, rating, category, images, long_description, source_platform, source_id)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 RETURNING *;
 
 -- name: ListProducts :many
@@ -18,9 +18,6 @@ UPDATE products SET category = ? WHERE id = ?;
 -- name: ListCategories :many
 SELECT DISTINCT category FROM products WHERE category != '' ORDER BY category;
 
--- name: SearchProducts :many
-SELECT * FROM products WHERE title LIKE ? OR description LIKE ? OR category LIKE ? ORDER BY added_at DESC;
-
 -- name: UpdateProductImages :exec
 UPDATE products SET images = ?, long_description = ? WHERE id = ?;
 
@@ -30,8 +27,8 @@ SELECT * FROM products WHERE category = ? ORDER BY added_at DESC;
 -- name: UpdateProduct :exec
 UPDATE products SET
   title = ?,
-  price = ?,
-  original_price = ?,
+  price_paise = ?,
+  original_price_paise = ?,
   image_url = ?,
   description = ?,
   rating = ?,
@@ -52,3 +49,34 @@ SELECT * FROM products WHERE is_bestseller = 1 ORDER BY added_at DESC;
 
 -- name: UpdateProductTags :exec
 UPDATE products SET is_new = ?, is_bestseller = ? WHERE id = ?;
+
+-- name: RestoreProduct :exec
+-- Re-creates a deleted product under its old ID, for reverting a delete.
+INSERT INTO products (id, url, platform, title, price_paise, original_price_paise, image_url, description, rating, category, images, long_description, is_new, is_bestseller, stock, source_platform, source_id)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: SetProductSource :exec
+-- Puts back the import listing a product came from, for reverting an edit.
+UPDATE products SET source_platform = ?, source_id = ? WHERE id = ?;
+
+-- name: GetProductBySource :one
+SELECT * FROM products WHERE source_platform = ? AND source_id = ?;
+
+-- name: GetUnsourcedProductByURL :one
+-- A product imported before source IDs were recorded, matched by the
+-- listing URL the importer built for it.
+SELECT * FROM products
+WHERE platform = ? AND url = ? AND source_id = ''
+ORDER BY id
+LIMIT 1;
+
+-- name: UpdateImportedProduct :exec
+-- What a re-import refreshes; titles, descriptions and categories may
+-- have been edited by hand and are left alone.
+UPDATE products
+SET price_paise = ?, original_price_paise = ?, image_url = ?, images = ?, rating = ?, url = ?, source_platform = ?, source_id = ?
+WHERE id = ?;
+
+-- name: GetProductByURL :one
+-- The oldest product with this listing URL, for matching spreadsheet rows.
+SELECT * FROM products WHERE url = ? ORDER BY id LIMIT 1;
@@ -0,0 +1,19 @@
+-- name: SetProductStock :exec
+UPDATE products SET stock = ? WHERE id = ?;
+
+-- name: SetVariantStock :exec
+UPDATE product_variants SET stock = ? WHERE id = ? AND product_id = ?;
+
+-- name: SyncProductStockFromVariants :exec
+UPDATE products SET stock = (
+  SELECT CASE WHEN COUNT(*) = 0 OR SUM(v.stock IS NULL) > 0 THEN NULL ELSE SUM(v.stock) END
+  FROM product_variants v WHERE v.product_id = products.id
+) WHERE id = ?;
+
+-- name: InsertStockAdjustment :one
+INSERT INTO stock_adjustments (product_id, variant_id, delta, stock_after, reason)
+VALUES (?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: ListStockAdjustments :many
+SELECT * FROM stock_adjustments WHERE product_id = ? ORDER BY id DESC LIMIT 50;
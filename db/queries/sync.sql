@@ -0,0 +1,58 @@
+-- name: ListSyncableProducts :many
+-- Products with a source page, least recently checked first.
+SELECT * FROM products
+WHERE url != ''
+ORDER BY synced_at IS NOT NULL, synced_at, id;
+
+-- name: MarkProductSynced :exec
+UPDATE products SET synced_at = CURRENT_TIMESTAMP WHERE id = ?;
+
+-- name: UpdateSyncedProduct :exec
+UPDATE products
+SET price_paise = ?, original_price_paise = ?, rating = ?, image_url = ?, images = ?,
+    delisted_at = NULL, synced_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: DelistProduct :exec
+UPDATE products
+SET delisted_at = COALESCE(delisted_at, CURRENT_TIMESTAMP), synced_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: ListDelistedProducts :many
+SELECT * FROM products WHERE delisted_at IS NOT NULL ORDER BY delisted_at DESC;
+
+-- name: InsertPriceHistory :exec
+INSERT INTO price_history (product_id, price_paise, original_price_paise, recorded_at)
+VALUES (?, ?, ?, ?);
+
+-- name: CountPriceHistory :one
+SELECT COUNT(*) FROM price_history WHERE product_id = ?;
+
+-- name: ListRecentPriceChanges :many
+-- The latest price changes with the price each one replaced.
+SELECT h.product_id, p.title, h.price_paise, h.recorded_at,
+       CAST(COALESCE((SELECT prev.price_paise FROM price_history prev
+                      WHERE prev.product_id = h.product_id AND prev.id < h.id
+                      ORDER BY prev.id DESC LIMIT 1), 0) AS INTEGER) AS previous_price_paise
+FROM price_history h
+JOIN products p ON p.id = h.product_id
+WHERE EXISTS (SELECT 1 FROM price_history prev WHERE prev.product_id = h.product_id AND prev.id < h.id)
+ORDER BY h.id DESC
+LIMIT ?;
+
+-- name: InsertSyncRun :one
+INSERT INTO sync_runs (trigger) VALUES (?) RETURNING *;
+
+-- name: UpdateSyncRun :exec
+UPDATE sync_runs
+SET checked = ?, updated = ?, delisted = ?, failed = ?, errors = ?
+WHERE id = ?;
+
+-- name: FinishSyncRun :exec
+UPDATE sync_runs SET finished_at = CURRENT_TIMESTAMP WHERE id = ?;
+
+-- name: GetLastSyncRun :one
+SELECT * FROM sync_runs ORDER BY id DESC LIMIT 1;
+
+-- name: ListSyncRuns :many
+SELECT * FROM sync_runs ORDER BY id DESC LIMIT ?;
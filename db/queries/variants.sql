@@ -0,0 +1,24 @@
+-- name: ListProductVariants :many
+SELECT * FROM product_variants WHERE product_id = ? ORDER BY sort_order, id;
+
+-- name: ListAllProductVariants :many
+SELECT * FROM product_variants ORDER BY product_id, sort_order, id;
+
+-- name: InsertProductVariant :one
+INSERT INTO product_variants (product_id, size, colour, pack, price_paise, original_price_paise, image_url, sort_order)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: UpdateProductVariant :exec
+UPDATE product_variants
+SET size = ?, colour = ?, pack = ?, price_paise = ?, original_price_paise = ?, image_url = ?, sort_order = ?
+WHERE id = ? AND product_id = ?;
+
+-- name: DeleteProductVariant :exec
+DELETE FROM product_variants WHERE id = ? AND product_id = ?;
+
+-- name: DeleteProductVariants :exec
+DELETE FROM product_variants WHERE product_id = ?;
+
+-- name: GetProductVariant :one
+SELECT * FROM product_variants WHERE id = ? AND product_id = ?;
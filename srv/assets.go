@@ -0,0 +1,240 @@
+package srv
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed templates static
+var embeddedAssets embed.FS
+
+// assetFS returns the filesystem holding templates/ and static/. Normally
+// that is the copy embedded in the binary; with -dev it is the source tree
+// instead, so edits show up without a rebuild. Files in themeDir, laid out
+// the same way, take precedence over either.
+func assetFS(themeDir string, dev bool) fs.FS {
+	var base fs.FS = embeddedAssets
+	if dev {
+		// Only meaningful on the machine that built the binary, which is
+		// the one place -dev is used.
+		_, thisFile, _, _ := runtime.Caller(0)
+		base = os.DirFS(filepath.Dir(thisFile))
+	}
+	if themeDir == "" {
+		return base
+	}
+	return overlayFS{os.DirFS(themeDir), base}
+}
+
+// overlayFS looks up each file in its layers in order and lists
+// directories as the union of all layers, so a theme only needs the files
+// it changes.
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	var err error
+	for _, layer := range o {
+		var f fs.File
+		if f, err = layer.Open(name); err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return f, err
+		}
+	}
+	return nil, err
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	seen := map[string]bool{}
+	var out []fs.DirEntry
+	found := false
+	for _, layer := range o {
+		entries, err := fs.ReadDir(layer, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		for _, e := range entries {
+			if !seen[e.Name()] {
+				seen[e.Name()] = true
+				out = append(out, e)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	slices.SortFunc(out, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return out, nil
+}
+
+// assetHashLen is how many hex digits of a file's SHA-256 go in its URL.
+const assetHashLen = 12
+
+// staticFiles serves static/ and gives templates content-hashed URLs for
+// it, such as /static/icon-192.1a2b3c4d5e6f.png. A hashed URL only ever
+// names one version of a file, so browsers may cache it forever; plain
+// URLs still work and are revalidated against the same hash as an ETag.
+type staticFiles struct {
+	fsys fs.FS // rooted at static/
+
+	mu     sync.RWMutex
+	hashes map[string]string // file name → content hash
+}
+
+func loadStatic(fsys fs.FS) (*staticFiles, error) {
+	sf := &staticFiles{fsys: fsys}
+	return sf, sf.load()
+}
+
+// load hashes every file, replacing the previous hashes.
+func (sf *staticFiles) load() error {
+	hashes := map[string]string{}
+	err := fs.WalkDir(sf.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := fs.ReadFile(sf.fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+		hashes[name] = hex.EncodeToString(sum[:])[:assetHashLen]
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sf.mu.Lock()
+	sf.hashes = hashes
+	sf.mu.Unlock()
+	return nil
+}
+
+func (sf *staticFiles) hash(name string) string {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.hashes[name]
+}
+
+// URL is the "asset" template function: the hashed URL of a static file.
+// Naming a file that doesn't exist fails the render rather than shipping a
+// broken link.
+func (sf *staticFiles) URL(name string) (string, error) {
+	h := sf.hash(name)
+	if h == "" {
+		return "", fmt.Errorf("no static file %q", name)
+	}
+	ext := path.Ext(name)
+	return "/static/" + strings.TrimSuffix(name, ext) + "." + h + ext, nil
+}
+
+// unhash splits "icon-192.1a2b3c4d5e6f.png" into "icon-192.png" and its
+// hash; ok is false for names without one.
+func unhash(name string) (base, hash string, ok bool) {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	i := strings.LastIndexByte(stem, '.')
+	if i < 0 || len(stem)-i-1 != assetHashLen {
+		return "", "", false
+	}
+	hash = stem[i+1:]
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", "", false
+	}
+	return stem[:i] + ext, hash, true
+}
+
+// ServeHTTP serves /static/ requests.
+func (sf *staticFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	immutable := false
+	if base, h, ok := unhash(name); ok && sf.hash(base) != "" {
+		// An outdated hash still gets the current file, just not cached
+		// for good.
+		name, immutable = base, h == sf.hash(base)
+	}
+	f, err := sf.fsys.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		content = bytes.NewReader(b)
+	}
+	if immutable {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"`+sf.hash(name)+`"`)
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// watchAssets reloads templates and static hashes whenever a file changes,
+// for -dev. It polls modification times rather than depending on a file
+// notification library; a bad edit is logged and the previous templates
+// stay in use until it is fixed.
+func (s *Server) watchAssets(every time.Duration) {
+	last := modTime(s.assets)
+	for range time.Tick(every) {
+		mt := modTime(s.assets)
+		if mt.Equal(last) {
+			continue
+		}
+		last = mt
+		if err := s.static.load(); err != nil {
+			slog.Error("reload static files", "error", err)
+		}
+		if err := s.templates.load(); err != nil {
+			slog.Error("reload templates", "error", err)
+			continue
+		}
+		slog.Info("reloaded templates and static files")
+	}
+}
+
+// modTime returns the newest modification time of any file or directory
+// in fsys, so adding, editing or removing a file all change it.
+func modTime(fsys fs.FS) time.Time {
+	var newest time.Time
+	fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest
+}
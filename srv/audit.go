@@ -0,0 +1,454 @@
+package srv
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// Audit log actions.
+const (
+	auditAdd    = "add"
+	auditUpdate = "update"
+	auditDelete = "delete"
+	auditImport = "import"
+	auditUpload = "upload"
+	auditRevert = "revert"
+	auditSync   = "sync"
+)
+
+var auditActions = []string{auditAdd, auditUpdate, auditDelete, auditImport, auditUpload, auditRevert, auditSync}
+
+const auditPageSize = 50
+
+// auditActor is who made a change. It is taken from the request up front
+// so background work such as a bulk import can still be attributed.
+type auditActor struct {
+	UserID *int64
+	Name   string
+	IP     string
+}
+
+func (s *Server) auditActor(r *http.Request) auditActor {
+	a := auditActor{Name: "(open panel)", IP: s.clientIP(r)}
+	if u := adminUser(r.Context()); u != nil {
+		id := u.ID
+		a.UserID, a.Name = &id, u.Username
+	}
+	return a
+}
+
+// productSnapshot is everything an admin or an import can change on a
+// product, as stored in the audit log and restored by a revert. The source
+// is the import listing the product is linked to, so a revert doesn't
+// leave the next sync to match it again.
+type productSnapshot struct {
+	Title           string            `json:"title"`
+	URL             string            `json:"url"`
+	Platform        string            `json:"platform"`
+	SourcePlatform  string            `json:"source_platform"`
+	SourceID        string            `json:"source_id"`
+	Price           Money             `json:"price"`
+	OriginalPrice   Money             `json:"original_price"`
+	ImageURL        string            `json:"image_url"`
+	Description     string            `json:"description"`
+	Rating          string            `json:"rating"`
+	Category        string            `json:"category"`
+	Images          string            `json:"images"`
+	LongDescription string            `json:"long_description"`
+	IsNew           bool              `json:"is_new"`
+	IsBestseller    bool              `json:"is_bestseller"`
+	Stock           *int64            `json:"stock"`
+	Variants        []variantSnapshot `json:"variants"`
+}
+
+type variantSnapshot struct {
+	variantInput
+	Stock *int64 `json:"stock"`
+}
+
+// snapshotProduct reads product id and its variants through q, so a
+// transaction-bound q sees the transaction's own changes.
+func snapshotProduct(ctx context.Context, q *dbgen.Queries, id int64) (*productSnapshot, error) {
+	p, err := q.GetProduct(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	vs, err := q.ListProductVariants(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	snap := &productSnapshot{
+		Title:           p.Title,
+		URL:             p.Url,
+		Platform:        p.Platform,
+		SourcePlatform:  p.SourcePlatform,
+		SourceID:        p.SourceID,
+		Price:           Money(p.PricePaise),
+		OriginalPrice:   Money(p.OriginalPricePaise),
+		ImageURL:        p.ImageUrl,
+		Description:     p.Description,
+		Rating:          p.Rating,
+		Category:        p.Category,
+		Images:          p.Images,
+		LongDescription: p.LongDescription,
+		IsNew:           p.IsNew != 0,
+		IsBestseller:    p.IsBestseller != 0,
+		Stock:           p.Stock,
+		Variants:        []variantSnapshot{},
+	}
+	for _, v := range vs {
+		snap.Variants = append(snap.Variants, variantSnapshot{
+			variantInput: variantInput{
+				ID:            v.ID,
+				Size:          v.Size,
+				Colour:        v.Colour,
+				Pack:          v.Pack,
+				Price:         Money(v.PricePaise),
+				OriginalPrice: Money(v.OriginalPricePaise),
+				ImageURL:      v.ImageUrl,
+			},
+			Stock: v.Stock,
+		})
+	}
+	return snap, nil
+}
+
+// logAudit records a change. before and after are JSON-encoded as given;
+// pass nil for a side that doesn't exist, such as before an add. Call it
+// with the transaction-bound q that made the change so the entry commits
+// or rolls back with it.
+func logAudit(ctx context.Context, q *dbgen.Queries, a auditActor, action string, productID *int64, before, after any) error {
+	params := dbgen.InsertAuditEntryParams{
+		UserID:    a.UserID,
+		Actor:     a.Name,
+		Action:    action,
+		ProductID: productID,
+		Ip:        a.IP,
+	}
+	var err error
+	if params.BeforeJson, err = auditJSON(before); err != nil {
+		return err
+	}
+	if params.AfterJson, err = auditJSON(after); err != nil {
+		return err
+	}
+	if params.BeforeJson != "" && params.AfterJson != "" {
+		if params.Diff, err = auditDiff(params.BeforeJson, params.AfterJson); err != nil {
+			return err
+		}
+	}
+	return q.InsertAuditEntry(ctx, params)
+}
+
+func auditJSON(v any) (string, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil()) {
+		return "", nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// auditDiff compares two JSON objects field by field and returns the
+// changed ones as {"field": [before, after]}.
+func auditDiff(before, after string) (string, error) {
+	var b, a map[string]any
+	if err := json.Unmarshal([]byte(before), &b); err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal([]byte(after), &a); err != nil {
+		return "", err
+	}
+	diff := map[string][2]any{}
+	for k, av := range a {
+		if bv := b[k]; !reflect.DeepEqual(bv, av) {
+			diff[k] = [2]any{bv, av}
+		}
+	}
+	for k, bv := range b {
+		if _, ok := a[k]; !ok {
+			diff[k] = [2]any{bv, nil}
+		}
+	}
+	out, err := json.Marshal(diff)
+	return string(out), err
+}
+
+// auditChange is one row of an entry's diff on the audit page.
+type auditChange struct {
+	Field, Before, After string
+}
+
+// auditView is an audit_log row prepared for the audit page.
+type auditView struct {
+	dbgen.AuditLog
+	Subject   string // product title or uploaded file
+	Changes   []auditChange
+	CanRevert bool
+}
+
+func newAuditView(e dbgen.AuditLog) auditView {
+	v := auditView{AuditLog: e, CanRevert: e.ProductID != nil && e.BeforeJson != ""}
+	var side struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+	}
+	if e.AfterJson != "" {
+		json.Unmarshal([]byte(e.AfterJson), &side)
+	} else {
+		json.Unmarshal([]byte(e.BeforeJson), &side)
+	}
+	v.Subject = side.Title
+	if v.Subject == "" {
+		v.Subject = side.URL
+	}
+	v.Changes = auditChanges(e.Diff)
+	return v
+}
+
+// auditChanges turns an auditDiff result into rows sorted by field.
+func auditChanges(diffJSON string) []auditChange {
+	var diff map[string][2]json.RawMessage
+	json.Unmarshal([]byte(diffJSON), &diff)
+	var changes []auditChange
+	for _, k := range slices.Sorted(maps.Keys(diff)) {
+		changes = append(changes, auditChange{Field: k, Before: auditValue(diff[k][0]), After: auditValue(diff[k][1])})
+	}
+	return changes
+}
+
+// auditValue shows a JSON value with strings unquoted.
+func auditValue(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// handleAudit renders the audit log, filtered by actor, action and product.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	q := dbgen.New(s.DB)
+	filter := dbgen.ListAuditEntriesParams{
+		Actor:  r.URL.Query().Get("actor"),
+		Action: r.URL.Query().Get("action"),
+		Limit:  auditPageSize,
+	}
+	filter.ProductID, _ = strconv.ParseInt(r.URL.Query().Get("product"), 10, 64)
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page = max(page, 1)
+	filter.Offset = int64(page-1) * auditPageSize
+
+	entries, err := q.ListAuditEntries(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	total, _ := q.CountAuditEntries(r.Context(), dbgen.CountAuditEntriesParams{
+		Actor:     filter.Actor,
+		Action:    filter.Action,
+		ProductID: filter.ProductID,
+	})
+	actors, _ := q.ListAuditActors(r.Context())
+	views := make([]auditView, 0, len(entries))
+	for _, e := range entries {
+		views = append(views, newAuditView(e))
+	}
+
+	pageURL := func(n int) string {
+		v := r.URL.Query()
+		v.Set("page", strconv.Itoa(n))
+		return "/admin/audit?" + v.Encode()
+	}
+	var prev, next string
+	if page > 1 {
+		prev = pageURL(page - 1)
+	}
+	if int64(page)*auditPageSize < total {
+		next = pageURL(page + 1)
+	}
+	s.templates.render(w, "audit.html", map[string]any{
+		"Nav":            "audit",
+		"CSRFToken":      s.csrfToken(w, r),
+		"CanEditCatalog": true,
+		"SignedIn":       adminUser(r.Context()) != nil,
+		"Entries":        views,
+		"Total":          total,
+		"Actors":         actors,
+		"Actions":        auditActions,
+		"Actor":          filter.Actor,
+		"Action":         filter.Action,
+		"ProductID":      filter.ProductID,
+		"PrevURL":        prev,
+		"NextURL":        next,
+	})
+}
+
+// handleAuditRevert puts a product back the way it was before an audit
+// entry's change, re-creating it under its old ID if it has since been
+// deleted. Stock levels are only restored when re-creating: otherwise they
+// have moved with sales since and have their own log.
+func (s *Server) handleAuditRevert(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid ID", 400)
+		return
+	}
+	entry, err := dbgen.New(s.DB).GetAuditEntry(r.Context(), id)
+	if err != nil {
+		jsonError(w, "Audit entry not found", 404)
+		return
+	}
+	if entry.ProductID == nil || entry.BeforeJson == "" {
+		jsonError(w, "Nothing to revert to: there was no product before this change", 400)
+		return
+	}
+	var snap productSnapshot
+	if err := json.Unmarshal([]byte(entry.BeforeJson), &snap); err != nil {
+		jsonError(w, "Corrupt snapshot: "+err.Error(), 500)
+		return
+	}
+	productID := *entry.ProductID
+
+	tx, err := s.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		jsonError(w, "Failed to revert: "+err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	q := dbgen.New(tx)
+	current, err := snapshotProduct(r.Context(), q, productID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		jsonError(w, "Failed to revert: "+err.Error(), 500)
+		return
+	}
+	if err := restoreSnapshot(r.Context(), q, productID, &snap, current); err != nil {
+		jsonError(w, "Failed to revert: "+err.Error(), 500)
+		return
+	}
+	after, err := snapshotProduct(r.Context(), q, productID)
+	if err == nil {
+		err = logAudit(r.Context(), q, s.auditActor(r), auditRevert, &productID, current, after)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		jsonError(w, "Failed to revert: "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "product_id": productID})
+}
+
+// restoreSnapshot makes product id match snap. current is the product as
+// it is now, or nil if it no longer exists.
+func restoreSnapshot(ctx context.Context, q *dbgen.Queries, id int64, snap, current *productSnapshot) error {
+	if current == nil {
+		err := q.RestoreProduct(ctx, dbgen.RestoreProductParams{
+			ID:                 id,
+			Url:                snap.URL,
+			Platform:           snap.Platform,
+			Title:              snap.Title,
+			PricePaise:         snap.Price.Paise(),
+			OriginalPricePaise: snap.OriginalPrice.Paise(),
+			ImageUrl:           snap.ImageURL,
+			Description:        snap.Description,
+			Rating:             snap.Rating,
+			Category:           snap.Category,
+			Images:             snap.Images,
+			LongDescription:    snap.LongDescription,
+			IsNew:              boolInt(snap.IsNew),
+			IsBestseller:       boolInt(snap.IsBestseller),
+			Stock:              snap.Stock,
+			SourcePlatform:     snap.SourcePlatform,
+			SourceID:           snap.SourceID,
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		err := q.UpdateProduct(ctx, dbgen.UpdateProductParams{
+			Title:              snap.Title,
+			PricePaise:         snap.Price.Paise(),
+			OriginalPricePaise: snap.OriginalPrice.Paise(),
+			ImageUrl:           snap.ImageURL,
+			Description:        snap.Description,
+			Rating:             snap.Rating,
+			Category:           snap.Category,
+			Images:             snap.Images,
+			LongDescription:    snap.LongDescription,
+			Url:                snap.URL,
+			Platform:           snap.Platform,
+			IsNew:              boolInt(snap.IsNew),
+			IsBestseller:       boolInt(snap.IsBestseller),
+			ID:                 id,
+		})
+		if err == nil {
+			err = q.SetProductSource(ctx, dbgen.SetProductSourceParams{
+				SourcePlatform: snap.SourcePlatform,
+				SourceID:       snap.SourceID,
+				ID:             id,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Keep variants that still exist so their stock and click history stay
+	// attached; ones deleted since come back as new variants.
+	existing := map[int64]bool{}
+	if current != nil {
+		for _, v := range current.Variants {
+			existing[v.ID] = true
+		}
+	}
+	vs := make([]variantInput, 0, len(snap.Variants))
+	for _, v := range snap.Variants {
+		in := v.variantInput
+		if !existing[in.ID] {
+			in.ID = 0
+		}
+		vs = append(vs, in)
+	}
+	if err := saveVariants(ctx, q, id, vs); err != nil {
+		return err
+	}
+	if current != nil || len(snap.Variants) == 0 {
+		return nil
+	}
+	saved, err := q.ListProductVariants(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(saved) != len(snap.Variants) {
+		return fmt.Errorf("restored %d of %d variants", len(saved), len(snap.Variants))
+	}
+	for i, v := range saved {
+		if err := q.SetVariantStock(ctx, dbgen.SetVariantStockParams{Stock: snap.Variants[i].Stock, ID: v.ID, ProductID: id}); err != nil {
+			return err
+		}
+	}
+	return q.SyncProductStockFromVariants(ctx, id)
+}
+
+// logUpload records an uploaded image, which isn't tied to a product until
+// it is saved as one's image.
+func (s *Server) logUpload(r *http.Request, url, filename string, size int64) {
+	err := logAudit(r.Context(), dbgen.New(s.DB), s.auditActor(r), auditUpload, nil, nil,
+		map[string]any{"url": url, "filename": filename, "size": size})
+	if err != nil {
+		slog.Error("audit upload", "error", err)
+	}
+}
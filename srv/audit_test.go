@@ -0,0 +1,68 @@
+package srv
+
+import (
+	"context"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestRevertRestoresImportSource(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	q := dbgen.New(s.DB)
+	p := addProduct(t, s, dbgen.InsertProductParams{
+		Title:          "Cotton Kurta",
+		Url:            "https://www.meesho.com/kurta/p/1",
+		PricePaise:     49900,
+		SourcePlatform: "Meesho",
+		SourceID:       "1",
+	})
+	before, err := snapshotProduct(ctx, q, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A sync links the product to another listing.
+	err = q.UpdateImportedProduct(ctx, dbgen.UpdateImportedProductParams{
+		PricePaise:     59900,
+		Url:            "https://www.meesho.com/kurta/p/2",
+		Images:         "[]",
+		SourcePlatform: "Meesho",
+		SourceID:       "2",
+		ID:             p.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := snapshotProduct(ctx, q, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreSnapshot(ctx, q, p.ID, before, current); err != nil {
+		t.Fatal(err)
+	}
+	got, err := q.GetProduct(ctx, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SourcePlatform != "Meesho" || got.SourceID != "1" || got.PricePaise != 49900 || got.Url != p.Url {
+		t.Errorf("after revert: source %q/%q, price %d, url %q; want Meesho/1, 49900, %q",
+			got.SourcePlatform, got.SourceID, got.PricePaise, got.Url, p.Url)
+	}
+
+	// Reverting a delete brings the source back too.
+	if err := q.DeleteProduct(ctx, p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreSnapshot(ctx, q, p.ID, before, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err = q.GetProductBySource(ctx, dbgen.GetProductBySourceParams{SourcePlatform: "Meesho", SourceID: "1"})
+	if err != nil {
+		t.Fatalf("re-created product isn't linked to its listing: %v", err)
+	}
+	if got.ID != p.ID {
+		t.Errorf("re-created product has ID %d, want %d", got.ID, p.ID)
+	}
+}
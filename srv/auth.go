@@ -0,0 +1,287 @@
+package srv
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// Admin roles. Owners can do everything including managing staff accounts,
+// editors manage the catalogue, analysts only see analytics.
+const (
+	RoleOwner   = "owner"
+	RoleEditor  = "editor"
+	RoleAnalyst = "analyst"
+)
+
+// permission is something a role may be allowed to do; requireAdmin checks
+// one per route.
+type permission int
+
+const (
+	permOwnAccount permission = iota // the signed-in user's own settings, such as 2FA
+	permViewAnalytics
+	permEditCatalog
+	permManageUsers
+)
+
+var rolePermissions = map[string][]permission{
+	RoleOwner:   {permOwnAccount, permViewAnalytics, permEditCatalog, permManageUsers},
+	RoleEditor:  {permOwnAccount, permViewAnalytics, permEditCatalog},
+	RoleAnalyst: {permOwnAccount, permViewAnalytics},
+}
+
+func validRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func roleAllows(role string, p permission) bool {
+	return slices.Contains(rolePermissions[role], p)
+}
+
+const (
+	sessionCookie = "admin_session"
+	sessionTTL    = 7 * 24 * time.Hour
+	// sessionTouchEvery limits last_seen_at writes to one per session per
+	// interval instead of one per request.
+	sessionTouchEvery = 5 * time.Minute
+	minPasswordLen    = 8
+)
+
+// dummyPasswordHash is compared against when a login names an unknown user,
+// so the response takes as long as a wrong password for a real one.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("shukarsh-no-such-user"), bcrypt.DefaultCost)
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLen {
+		return "", errors.New("password must be at least 8 characters")
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+// sessionID is the database key for a cookie token.
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type adminCtxKey struct{}
+
+// adminSession returns the session and account for a request that passed
+// requireAdmin, or nil when the panel is open because no accounts exist yet.
+func adminSession(ctx context.Context) *dbgen.GetSessionRow {
+	sess, _ := ctx.Value(adminCtxKey{}).(*dbgen.GetSessionRow)
+	return sess
+}
+
+// adminUser is the account half of adminSession.
+func adminUser(ctx context.Context) *dbgen.AdminUser {
+	if sess := adminSession(ctx); sess != nil {
+		return &sess.AdminUser
+	}
+	return nil
+}
+
+// bootstrapOwner creates an "admin" owner account with the given password
+// when there are no accounts yet, so existing -admin-password deployments
+// keep working after the upgrade.
+func (s *Server) bootstrapOwner(ctx context.Context, password string) error {
+	q := dbgen.New(s.DB)
+	n, err := q.CountAdminUsers(ctx)
+	if err != nil || n > 0 {
+		return err
+	}
+	if password == "" {
+		slog.Warn("no admin accounts and no -admin-password; the admin panel is open to anyone")
+		return nil
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = q.InsertAdminUser(ctx, dbgen.InsertAdminUserParams{Username: "admin", Name: "Owner", PasswordHash: hash, Role: RoleOwner})
+	if err == nil {
+		slog.Info("created owner account", "username", "admin")
+	}
+	return err
+}
+
+// Login failures. The first two read the same so the login form doesn't
+// reveal which usernames exist; the attempt log tells them apart.
+var (
+	errUnknownUser     = errors.New("wrong username or password")
+	errWrongPassword   = errors.New("wrong username or password")
+	errAccountDisabled = errors.New("this account is disabled")
+)
+
+// authenticate checks a username and password and returns the account.
+func (s *Server) authenticate(ctx context.Context, username, password string) (*dbgen.AdminUser, error) {
+	u, err := dbgen.New(s.DB).GetAdminUserByUsername(ctx, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, errUnknownUser
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		return nil, errWrongPassword
+	}
+	if u.Disabled != 0 {
+		return nil, errAccountDisabled
+	}
+	return &u, nil
+}
+
+// startSession records a new session for u and sets its cookie. A
+// mfaPending session only lets the user through the second login step.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, u *dbgen.AdminUser, mfaPending bool) error {
+	ttl := sessionTTL
+	if mfaPending {
+		ttl = mfaPendingTTL
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	q := dbgen.New(s.DB)
+	err := q.InsertSession(r.Context(), dbgen.InsertSessionParams{
+		ID:         sessionID(token),
+		UserID:     u.ID,
+		UserAgent:  r.UserAgent(),
+		Ip:         s.clientIP(r),
+		ExpiresAt:  time.Now().UTC().Add(ttl),
+		CsrfToken:  newCSRFToken(),
+		MfaPending: boolInt(mfaPending),
+	})
+	if err != nil {
+		return err
+	}
+	if !mfaPending {
+		q.TouchAdminUserLogin(r.Context(), u.ID)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(ttl / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// currentSession returns the live, fully signed-in session behind the
+// request's cookie.
+func (s *Server) currentSession(r *http.Request) (*dbgen.GetSessionRow, bool) {
+	row, ok := s.liveSession(r)
+	if !ok || row.Session.MfaPending != 0 {
+		return nil, false
+	}
+	if time.Since(row.Session.LastSeenAt) > sessionTouchEvery {
+		dbgen.New(s.DB).TouchSession(r.Context(), row.Session.ID)
+	}
+	return row, true
+}
+
+// pendingSession returns the session behind the request's cookie if it is
+// waiting for the second login step.
+func (s *Server) pendingSession(r *http.Request) (*dbgen.GetSessionRow, bool) {
+	row, ok := s.liveSession(r)
+	if !ok || row.Session.MfaPending == 0 {
+		return nil, false
+	}
+	return row, true
+}
+
+func (s *Server) liveSession(r *http.Request) (*dbgen.GetSessionRow, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil || c.Value == "" {
+		return nil, false
+	}
+	row, err := dbgen.New(s.DB).GetSession(r.Context(), sessionID(c.Value))
+	if err != nil {
+		return nil, false
+	}
+	if row.Session.RevokedAt != nil || time.Now().After(row.Session.ExpiresAt) || row.AdminUser.Disabled != 0 {
+		return nil, false
+	}
+	return &row, true
+}
+
+// redirectAfterLogin sends a freshly signed-in user to the first admin page
+// their role can see.
+func (s *Server) redirectAfterLogin(w http.ResponseWriter, r *http.Request, u *dbgen.AdminUser) {
+	if !roleAllows(u.Role, permEditCatalog) {
+		http.Redirect(w, r, "/admin/analytics", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusFound)
+}
+
+// adminOpen reports whether there are no staff accounts, in which case the
+// admin panel needs no login (local development).
+func (s *Server) adminOpen(ctx context.Context) bool {
+	n, err := dbgen.New(s.DB).CountAdminUsers(ctx)
+	return err == nil && n == 0
+}
+
+// requireAdmin wraps an admin page or API handler: the request needs a live
+// session whose role has permission p, and POSTs need the session's CSRF
+// token. The account is available to the handler through adminUser.
+func (s *Server) requireAdmin(p permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		api := r.Header.Get("Content-Type") == "application/json" || strings.HasPrefix(r.URL.Path, "/api/")
+		if s.adminOpen(r.Context()) {
+			if !safeMethod(r.Method) && !validCSRF(r, nil) {
+				jsonError(w, "invalid or missing CSRF token", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+			return
+		}
+		sess, ok := s.currentSession(r)
+		if !ok {
+			if api {
+				jsonError(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, "/admin/login", http.StatusFound)
+			return
+		}
+		if !roleAllows(sess.AdminUser.Role, p) {
+			if api {
+				jsonError(w, "your role ("+sess.AdminUser.Role+") can't do this", http.StatusForbidden)
+				return
+			}
+			if p != permViewAnalytics {
+				http.Redirect(w, r, "/admin/analytics", http.StatusFound)
+				return
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if !safeMethod(r.Method) && !validCSRF(r, sess) {
+			jsonError(w, "invalid or missing CSRF token; reload the page", http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), adminCtxKey{}, sess)))
+	}
+}
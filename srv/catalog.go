@@ -0,0 +1,720 @@
+package srv
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// The catalogue can be exported as CSV or XLSX, one row per product and a
+// column per field, and a sheet in that shape imported back. Imported
+// columns are matched to fields by header, with common spellings such as
+// "Name" or "MRP" recognised and any header mappable by hand. A row
+// updates the product with its id, else the one with its listing URL,
+// else adds a new product; blank cells leave a field as it is. Rows that
+// don't validate are skipped and reported, and the rest are saved in one
+// transaction. Scraped text is exported with a quote before anything a
+// spreadsheet would run as a formula, and the quote is dropped on import.
+
+// Catalogue sheet formats.
+const (
+	catalogCSV  = "csv"
+	catalogXLSX = "xlsx"
+)
+
+// catalogColumns are the export columns, in order. Those that aren't
+// importable are there for reference and ignored when read back.
+var catalogColumns = []struct {
+	Name       string
+	Importable bool
+	Value      func(p dbgen.Product) string
+}{
+	{"id", true, func(p dbgen.Product) string { return strconv.FormatInt(p.ID, 10) }},
+	{"title", true, func(p dbgen.Product) string { return p.Title }},
+	{"url", true, func(p dbgen.Product) string { return p.Url }},
+	{"platform", true, func(p dbgen.Product) string { return p.Platform }},
+	{"price", true, func(p dbgen.Product) string { return sheetMoney(p.PricePaise) }},
+	{"original_price", true, func(p dbgen.Product) string { return sheetMoney(p.OriginalPricePaise) }},
+	{"discount_pct", false, func(p dbgen.Product) string { return sheetInt(p.DiscountPct) }},
+	{"category", true, func(p dbgen.Product) string { return p.Category }},
+	{"description", true, func(p dbgen.Product) string { return p.Description }},
+	{"long_description", true, func(p dbgen.Product) string { return p.LongDescription }},
+	{"rating", true, func(p dbgen.Product) string { return p.Rating }},
+	{"image_url", true, func(p dbgen.Product) string { return p.ImageUrl }},
+	{"images", true, func(p dbgen.Product) string { return strings.Join(productImageList(p.Images), " | ") }},
+	{"is_new", true, func(p dbgen.Product) string { return sheetInt(p.IsNew) }},
+	{"is_bestseller", true, func(p dbgen.Product) string { return sheetInt(p.IsBestseller) }},
+	{"stock", true, func(p dbgen.Product) string {
+		if p.Stock == nil {
+			return ""
+		}
+		return strconv.FormatInt(*p.Stock, 10)
+	}},
+	{"in_stock", false, func(p dbgen.Product) string { return sheetInt(p.InStock) }},
+	{"source_platform", false, func(p dbgen.Product) string { return p.SourcePlatform }},
+	{"source_id", false, func(p dbgen.Product) string { return p.SourceID }},
+	{"added_at", false, func(p dbgen.Product) string { return sheetTime(&p.AddedAt) }},
+	{"synced_at", false, func(p dbgen.Product) string { return sheetTime(p.SyncedAt) }},
+	{"delisted_at", false, func(p dbgen.Product) string { return sheetTime(p.DelistedAt) }},
+}
+
+// catalogAliases are other headers recognised for importable columns,
+// after normalising with sheetHeader.
+var catalogAliases = map[string]string{
+	"name":              "title",
+	"product":           "title",
+	"product_name":      "title",
+	"product_title":     "title",
+	"link":              "url",
+	"product_url":       "url",
+	"source_url":        "url",
+	"listing_url":       "url",
+	"selling_price":     "price",
+	"sale_price":        "price",
+	"mrp":               "original_price",
+	"list_price":        "original_price",
+	"compare_at_price":  "original_price",
+	"image":             "image_url",
+	"main_image":        "image_url",
+	"image_link":        "image_url",
+	"image_urls":        "images",
+	"gallery":           "images",
+	"additional_images": "images",
+	"new":               "is_new",
+	"bestseller":        "is_bestseller",
+	"qty":               "stock",
+	"quantity":          "stock",
+}
+
+// numberedImage matches headers like "Image 2" or "image_3": one more
+// image each, added to the images field.
+var numberedImage = regexp.MustCompile(`^(image|img|photo)_?\d+$`)
+
+// catalogActor is who command-line imports are attributed to in the audit
+// log.
+var catalogActor = auditActor{Name: "(command line)"}
+
+func sheetMoney(paise int64) string {
+	if paise == 0 {
+		return ""
+	}
+	return Money(paise).Plain()
+}
+
+// sheetFormulaPrefixes start a formula when a spreadsheet opens a CSV, so
+// a scraped title such as "=HYPERLINK(...)" would run. XLSX cells are
+// written as text and never run, so they aren't escaped.
+const sheetFormulaPrefixes = "=+-@\t\r"
+
+// sheetEscape makes an exported CSV cell plain text by putting a quote before
+// any that would start a formula. Cells already starting with quotes
+// before such a character get one more, so sheetUnescape can tell them
+// apart.
+func sheetEscape(v string) string {
+	if rest := strings.TrimLeft(v, "'"); rest != "" && strings.ContainsRune(sheetFormulaPrefixes, rune(rest[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// sheetUnescape undoes sheetEscape on an imported CSV cell.
+func sheetUnescape(v string) string {
+	if strings.HasPrefix(v, "'") && v == sheetEscape(v[1:]) {
+		return v[1:]
+	}
+	return v
+}
+
+func sheetInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func sheetTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// productImageList decodes a product's images column.
+func productImageList(images string) []string {
+	var list []string
+	json.Unmarshal([]byte(images), &list)
+	return list
+}
+
+// sheetHeader normalises a header for matching: "Price (₹)" becomes
+// "price" and "Image URL" becomes "image_url".
+func sheetHeader(h string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(h)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "_"):
+			b.WriteByte('_')
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// catalogField returns the importable field a header maps to by name, or
+// "" if none does.
+func catalogField(header string) string {
+	h := sheetHeader(header)
+	if f, ok := catalogAliases[h]; ok {
+		return f
+	}
+	if numberedImage.MatchString(h) {
+		return "images"
+	}
+	for _, c := range catalogColumns {
+		if c.Name == h && c.Importable {
+			return h
+		}
+	}
+	return ""
+}
+
+// catalogFields lists the importable fields, for mapping columns by hand.
+func catalogFields() []string {
+	var fields []string
+	for _, c := range catalogColumns {
+		if c.Importable {
+			fields = append(fields, c.Name)
+		}
+	}
+	return fields
+}
+
+// ExportCatalog writes every product as a sheet in format, "csv" or "xlsx".
+func (s *Server) ExportCatalog(ctx context.Context, w io.Writer, format string) error {
+	products, err := dbgen.New(s.DB).ListProducts(ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(products)+1)
+	header := make([]string, len(catalogColumns))
+	for i, c := range catalogColumns {
+		header[i] = c.Name
+	}
+	rows = append(rows, header)
+	// Oldest first, so new products land at the bottom of the sheet.
+	for i := len(products) - 1; i >= 0; i-- {
+		row := make([]string, len(catalogColumns))
+		for j, c := range catalogColumns {
+			row[j] = c.Value(products[i])
+		}
+		rows = append(rows, row)
+	}
+	switch format {
+	case catalogCSV:
+		for _, row := range rows[1:] {
+			for j := range row {
+				row[j] = sheetEscape(row[j])
+			}
+		}
+		cw := csv.NewWriter(w)
+		cw.WriteAll(rows)
+		return cw.Error()
+	case catalogXLSX:
+		return writeXLSX(w, "Products", rows)
+	}
+	return fmt.Errorf("unknown export format %q: want csv or xlsx", format)
+}
+
+func (s *Server) handleExportCatalog(w http.ResponseWriter, r *http.Request) {
+	format := strings.TrimPrefix(path.Ext(r.URL.Path), ".")
+	var buf bytes.Buffer
+	if err := s.ExportCatalog(r.Context(), &buf, format); err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	contentType := "text/csv; charset=utf-8"
+	if format == catalogXLSX {
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="shukarsh-catalogue-%s.%s"`, time.Now().Format("2006-01-02"), format))
+	w.Write(buf.Bytes())
+}
+
+// readSheet returns the rows of a CSV or XLSX file, telling them apart by
+// content rather than name.
+func readSheet(data []byte) ([][]string, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return readXLSX(bytes.NewReader(data), int64(len(data)))
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	// Spreadsheets in some locales save with semicolons or tabs instead.
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	if n := bytes.Count(header, []byte(",")); bytes.Count(header, []byte(";")) > n {
+		cr.Comma = ';'
+	} else if bytes.Count(header, []byte("\t")) > n {
+		cr.Comma = '\t'
+	}
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read CSV: %w", err)
+	}
+	for _, row := range rows {
+		for j := range row {
+			row[j] = sheetUnescape(row[j])
+		}
+	}
+	return rows, nil
+}
+
+// CatalogImport is how to import a sheet.
+type CatalogImport struct {
+	// Mapping maps sheet headers to fields, overriding those recognised by
+	// name. A header mapped to "" is ignored.
+	Mapping map[string]string
+	// DryRun checks every row and reports what would happen without
+	// changing anything.
+	DryRun bool
+}
+
+// CatalogReport is what a sheet import did, or would do, row by row.
+type CatalogReport struct {
+	DryRun    bool               `json:"dry_run"`
+	Columns   []CatalogColumnMap `json:"columns"`
+	Fields    []string           `json:"fields"` // what columns can be mapped to
+	Rows      []CatalogRowReport `json:"rows"`
+	Created   int                `json:"created"`
+	Updated   int                `json:"updated"`
+	Unchanged int                `json:"unchanged"`
+	Failed    int                `json:"failed"`
+}
+
+// CatalogColumnMap is the field a sheet column was read into, "" if none.
+type CatalogColumnMap struct {
+	Header string `json:"header"`
+	Field  string `json:"field"`
+}
+
+// CatalogRowReport is the outcome of one row: created, updated,
+// unchanged or failed.
+type CatalogRowReport struct {
+	Row       int      `json:"row"` // as numbered in the spreadsheet
+	Outcome   string   `json:"outcome"`
+	ProductID int64    `json:"product_id,omitempty"`
+	Title     string   `json:"title"`
+	Errors    []string `json:"errors,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// ImportCatalog imports a CSV or XLSX sheet, attributing the changes to
+// the command line.
+func (s *Server) ImportCatalog(ctx context.Context, data []byte, opts CatalogImport) (*CatalogReport, error) {
+	return s.importCatalog(ctx, catalogActor, data, opts)
+}
+
+func (s *Server) importCatalog(ctx context.Context, actor auditActor, data []byte, opts CatalogImport) (*CatalogReport, error) {
+	rows, err := readSheet(data)
+	if err != nil {
+		return nil, err
+	}
+	for len(rows) > 0 && blankRow(rows[0]) {
+		rows = rows[1:]
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("the sheet is empty")
+	}
+
+	report := &CatalogReport{DryRun: opts.DryRun, Fields: catalogFields()}
+	fields := make([]string, len(rows[0]))
+	mapped := map[string]string{}
+	for i, h := range rows[0] {
+		f, ok := opts.Mapping[h]
+		if !ok {
+			f = catalogField(h)
+		}
+		if f != "" && !slices.Contains(report.Fields, f) {
+			return nil, fmt.Errorf("column %q: no field %q", h, f)
+		}
+		if prev, ok := mapped[f]; ok && f != "" && f != "images" {
+			return nil, fmt.Errorf("columns %q and %q both map to %s", prev, h, f)
+		}
+		mapped[f] = h
+		fields[i] = f
+		report.Columns = append(report.Columns, CatalogColumnMap{Header: h, Field: f})
+	}
+	if mapped["title"] == "" && mapped["id"] == "" && mapped["url"] == "" {
+		return nil, errors.New("no id, url or title column: map at least one")
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	q := dbgen.New(tx)
+	seen := map[int64]int{} // product ID to the row that touched it
+	for i, cells := range rows[1:] {
+		if blankRow(cells) {
+			continue
+		}
+		row := catalogRow{number: i + 2, values: map[string]string{}}
+		for j, v := range cells {
+			if j >= len(fields) || fields[j] == "" {
+				continue
+			}
+			v = strings.TrimSpace(v)
+			if fields[j] == "images" {
+				row.images = append(row.images, splitImageURLs(v)...)
+			} else {
+				row.values[fields[j]] = v
+			}
+		}
+		rr, err := row.apply(ctx, q, actor, seen)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", row.number, err)
+		}
+		switch rr.Outcome {
+		case importCreated:
+			report.Created++
+		case importUpdated:
+			report.Updated++
+		case importUnchanged:
+			report.Unchanged++
+		default:
+			report.Failed++
+		}
+		if opts.DryRun && rr.Outcome == importCreated {
+			rr.ProductID = 0
+		}
+		report.Rows = append(report.Rows, rr)
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+	return report, tx.Commit()
+}
+
+func blankRow(cells []string) bool {
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// splitImageURLs splits a cell of image URLs separated by "|", commas or
+// whitespace, or holding a JSON array.
+func splitImageURLs(v string) []string {
+	var list []string
+	if strings.HasPrefix(v, "[") && json.Unmarshal([]byte(v), &list) == nil {
+		return list
+	}
+	return strings.FieldsFunc(v, func(r rune) bool {
+		return r == '|' || r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+}
+
+// catalogRow is one sheet row, its cells keyed by field.
+type catalogRow struct {
+	number int
+	values map[string]string
+	images []string
+}
+
+// apply validates the row and saves it. Problems with the row are
+// reported as a failed outcome; only database errors are returned.
+func (row *catalogRow) apply(ctx context.Context, q *dbgen.Queries, actor auditActor, seen map[int64]int) (CatalogRowReport, error) {
+	rr := CatalogRowReport{Row: row.number, Title: row.values["title"]}
+	fail := func(format string, args ...any) {
+		rr.Errors = append(rr.Errors, fmt.Sprintf(format, args...))
+	}
+
+	// Find the product the row is for.
+	var p dbgen.Product
+	exists := false
+	if v := row.values["id"]; v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			fail("invalid id %q", v)
+		} else if p, err = q.GetProduct(ctx, id); errors.Is(err, sql.ErrNoRows) {
+			fail("no product #%d", id)
+		} else if err != nil {
+			return rr, err
+		} else {
+			exists = true
+		}
+	} else if v := row.values["url"]; v != "" {
+		var err error
+		p, err = q.GetProductByURL(ctx, v)
+		switch {
+		case err == nil:
+			exists = true
+		case !errors.Is(err, sql.ErrNoRows):
+			return rr, err
+		}
+	}
+	if exists {
+		if prev, ok := seen[p.ID]; ok {
+			fail("product #%d is already in row %d", p.ID, prev)
+		}
+		seen[p.ID] = row.number
+		rr.ProductID = p.ID
+		if rr.Title == "" {
+			rr.Title = p.Title
+		}
+	}
+
+	// Validate the cells, filling in the product's current values for
+	// blank ones.
+	upd := dbgen.UpdateProductParams{
+		Title:              cmp.Or(row.values["title"], p.Title),
+		PricePaise:         p.PricePaise,
+		OriginalPricePaise: p.OriginalPricePaise,
+		ImageUrl:           cmp.Or(row.values["image_url"], p.ImageUrl),
+		Description:        cmp.Or(row.values["description"], p.Description),
+		Rating:             cmp.Or(row.values["rating"], p.Rating),
+		Category:           cmp.Or(row.values["category"], p.Category),
+		Images:             p.Images,
+		LongDescription:    cmp.Or(row.values["long_description"], p.LongDescription),
+		Url:                cmp.Or(row.values["url"], p.Url),
+		Platform:           cmp.Or(row.values["platform"], p.Platform),
+		IsNew:              p.IsNew,
+		IsBestseller:       p.IsBestseller,
+		ID:                 p.ID,
+	}
+	if upd.Title == "" && row.values["id"] == "" {
+		fail("title is required for a new product")
+	}
+	for _, f := range []struct {
+		name string
+		dst  *int64
+	}{{"price", &upd.PricePaise}, {"original_price", &upd.OriginalPricePaise}} {
+		if v := row.values[f.name]; v != "" {
+			m, err := ParseMoney(v)
+			if err != nil {
+				fail("%s: %v", f.name, err)
+			}
+			*f.dst = m.Paise()
+		}
+	}
+	if upd.OriginalPricePaise != 0 && upd.OriginalPricePaise < upd.PricePaise {
+		rr.Warnings = append(rr.Warnings, "original price is below the price, so no discount shows")
+	}
+	if v := row.values["rating"]; v != "" {
+		if r, err := strconv.ParseFloat(v, 64); err != nil || r < 0 || r > 5 {
+			fail("rating %q: want a number from 0 to 5", v)
+		}
+	}
+	for _, f := range []struct {
+		name string
+		dst  *int64
+	}{{"is_new", &upd.IsNew}, {"is_bestseller", &upd.IsBestseller}} {
+		if v := row.values[f.name]; v != "" {
+			b, ok := sheetBool(v)
+			if !ok {
+				fail("%s %q: want yes or no", f.name, v)
+			}
+			*f.dst = b
+		}
+	}
+	var stock *int64
+	if v := row.values["stock"]; v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			fail("stock %q: want a whole number, 0 or more", v)
+		}
+		stock = &n
+	}
+	if v := row.values["url"]; v != "" && !webURL(v) {
+		fail("url %q: want an http or https link", v)
+	}
+	if len(row.images) > 0 {
+		for _, img := range row.images {
+			if !webURL(img) && !strings.HasPrefix(img, "/uploads/") {
+				fail("image %q: want an http or https link", img)
+			}
+		}
+		// Kept as stored when the list is the same, however it's spaced.
+		if !slices.Equal(row.images, productImageList(p.Images)) {
+			b, _ := json.Marshal(row.images)
+			upd.Images = string(b)
+		}
+	}
+	if v := row.values["image_url"]; v != "" && !webURL(v) && !strings.HasPrefix(v, "/uploads/") {
+		fail("image_url %q: want an http or https link", v)
+	}
+	// A gallery with no main image, or the other way round, uses one for
+	// the other.
+	if !exists || len(row.images) > 0 || row.values["image_url"] != "" {
+		if imgs := productImageList(upd.Images); upd.ImageUrl == "" && len(imgs) > 0 {
+			upd.ImageUrl = imgs[0]
+		} else if len(imgs) == 0 && upd.ImageUrl != "" {
+			b, _ := json.Marshal([]string{upd.ImageUrl})
+			upd.Images = string(b)
+		}
+	}
+	if upd.Platform == "" {
+		upd.Platform = cmp.Or(detectPlatform(upd.Url), "Other")
+	}
+	rr.Title = upd.Title
+	if len(rr.Errors) > 0 {
+		rr.Outcome = importFailed
+		return rr, nil
+	}
+
+	if !exists {
+		np, err := q.InsertProduct(ctx, dbgen.InsertProductParams{
+			Url:                upd.Url,
+			Platform:           upd.Platform,
+			Title:              upd.Title,
+			PricePaise:         upd.PricePaise,
+			OriginalPricePaise: upd.OriginalPricePaise,
+			ImageUrl:           upd.ImageUrl,
+			Description:        upd.Description,
+			Rating:             upd.Rating,
+			Category:           upd.Category,
+			Images:             upd.Images,
+			LongDescription:    upd.LongDescription,
+		})
+		if err != nil {
+			return rr, err
+		}
+		upd.ID, rr.ProductID, rr.Outcome = np.ID, np.ID, importCreated
+		seen[np.ID] = row.number
+		if err := q.UpdateProductTags(ctx, dbgen.UpdateProductTagsParams{IsNew: upd.IsNew, IsBestseller: upd.IsBestseller, ID: np.ID}); err != nil {
+			return rr, err
+		}
+		if err := setImportedStock(ctx, q, np, stock, &rr); err != nil {
+			return rr, err
+		}
+		after, err := snapshotProduct(ctx, q, np.ID)
+		if err != nil {
+			return rr, err
+		}
+		return rr, logAudit(ctx, q, actor, auditImport, &np.ID, nil, after)
+	}
+
+	stockChanged := stock != nil && (p.Stock == nil || *p.Stock != *stock)
+	if upd == (dbgen.UpdateProductParams{
+		Title: p.Title, PricePaise: p.PricePaise, OriginalPricePaise: p.OriginalPricePaise, ImageUrl: p.ImageUrl,
+		Description: p.Description, Rating: p.Rating, Category: p.Category, Images: p.Images, LongDescription: p.LongDescription,
+		Url: p.Url, Platform: p.Platform, IsNew: p.IsNew, IsBestseller: p.IsBestseller, ID: p.ID,
+	}) && !stockChanged {
+		rr.Outcome = importUnchanged
+		return rr, nil
+	}
+	before, err := snapshotProduct(ctx, q, p.ID)
+	if err != nil {
+		return rr, err
+	}
+	if err := q.UpdateProduct(ctx, upd); err != nil {
+		return rr, err
+	}
+	if stockChanged {
+		if err := setImportedStock(ctx, q, p, stock, &rr); err != nil {
+			return rr, err
+		}
+	}
+	after, err := snapshotProduct(ctx, q, p.ID)
+	if err != nil {
+		return rr, err
+	}
+	rr.Outcome = importUpdated
+	return rr, logAudit(ctx, q, actor, auditImport, &p.ID, before, after)
+}
+
+// setImportedStock sets a product's stock from a sheet, logging the
+// adjustment. Products with variants keep the sum of their variants'.
+func setImportedStock(ctx context.Context, q *dbgen.Queries, p dbgen.Product, stock *int64, rr *CatalogRowReport) error {
+	if stock == nil {
+		return nil
+	}
+	variants, err := q.ListProductVariants(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+	if len(variants) > 0 {
+		rr.Warnings = append(rr.Warnings, "stock ignored: the product has variants, whose stock adds up to its own")
+		return nil
+	}
+	if err := q.SetProductStock(ctx, dbgen.SetProductStockParams{Stock: stock, ID: p.ID}); err != nil {
+		return err
+	}
+	var before int64
+	if p.Stock != nil {
+		before = *p.Stock
+	}
+	_, err = q.InsertStockAdjustment(ctx, dbgen.InsertStockAdjustmentParams{
+		ProductID:  p.ID,
+		Delta:      *stock - before,
+		StockAfter: *stock,
+		Reason:     "Spreadsheet import",
+	})
+	return err
+}
+
+// sheetBool reads a yes/no cell as 1 or 0.
+func sheetBool(v string) (int64, bool) {
+	switch strings.ToLower(v) {
+	case "1", "yes", "y", "true", "✓":
+		return 1, true
+	case "0", "no", "n", "false", "-":
+		return 0, true
+	}
+	return 0, false
+}
+
+func webURL(v string) bool {
+	return strings.HasPrefix(v, "https://") || strings.HasPrefix(v, "http://")
+}
+
+// handleImportCatalog imports an uploaded CSV or XLSX sheet, form fields:
+//
+//	file     the sheet
+//	mapping  optional JSON object of header to field
+//	dry_run  1 to only check it
+func (s *Server) handleImportCatalog(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		jsonError(w, "Choose a CSV or XLSX file", 400)
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		jsonError(w, "Failed to read file: "+err.Error(), 400)
+		return
+	}
+	opts := CatalogImport{DryRun: r.FormValue("dry_run") == "1"}
+	if v := r.FormValue("mapping"); v != "" {
+		if err := json.Unmarshal([]byte(v), &opts.Mapping); err != nil {
+			jsonError(w, "Invalid mapping: "+err.Error(), 400)
+			return
+		}
+	}
+	report, err := s.importCatalog(r.Context(), s.auditActor(r), data, opts)
+	if err != nil {
+		jsonError(w, err.Error(), 400)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "report": report})
+}
@@ -0,0 +1,186 @@
+package srv
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestSheetEscape(t *testing.T) {
+	tests := []struct{ in, out string }{
+		{"Cotton Kurta", "Cotton Kurta"},
+		{"", ""},
+		{`=HYPERLINK("https://evil.example","Click")`, `'=HYPERLINK("https://evil.example","Click")`},
+		{"+cmd|' /C calc'!A0", "'+cmd|' /C calc'!A0"},
+		{"-2+3+cmd|' /C calc'!A0", "'-2+3+cmd|' /C calc'!A0"},
+		{"@SUM(1+1)*cmd|' /C calc'!A0", "'@SUM(1+1)*cmd|' /C calc'!A0"},
+		{"\t=1+1", "'\t=1+1"},
+		{"\r=1+1", "'\r=1+1"},
+		{"'90s Denim", "'90s Denim"},
+		{"'=1+1", "''=1+1"},
+	}
+	for _, tt := range tests {
+		if got := sheetEscape(tt.in); got != tt.out {
+			t.Errorf("sheetEscape(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+		if got := sheetUnescape(tt.out); got != tt.in {
+			t.Errorf("sheetUnescape(%q) = %q, want %q", tt.out, got, tt.in)
+		}
+	}
+}
+
+// formulaProduct has scraped text that would run as formulas if exported
+// as is.
+var formulaProduct = dbgen.InsertProductParams{
+	Title:           `=HYPERLINK("https://evil.example","Click for offer")`,
+	Url:             "https://www.meesho.com/kurta/p/1",
+	PricePaise:      49950,
+	Description:     "+cmd|' /C calc'!A0",
+	LongDescription: "@SUM(1+1)",
+	Rating:          "4.1",
+}
+
+func exportCatalog(t *testing.T, s *Server, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := s.ExportCatalog(context.Background(), &buf, format); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCatalogExportEscapesFormulas(t *testing.T) {
+	s := newTestServer(t)
+	p := addProduct(t, s, formulaProduct)
+	// Read as a spreadsheet would, without readSheet's unescaping.
+	rows, err := csv.NewReader(bytes.NewReader(exportCatalog(t, s, catalogCSV))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := strconv.FormatInt(p.ID, 10)
+	found := false
+	for _, row := range rows[1:] {
+		if row[0] != id {
+			continue
+		}
+		found = true
+		for i, cell := range row {
+			if cell != "" && strings.ContainsRune(sheetFormulaPrefixes, rune(cell[0])) {
+				t.Errorf("column %s = %q starts a formula", rows[0][i], cell)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("product #%s isn't in the export", id)
+	}
+
+	// XLSX cells are text, so they're exported as they are.
+	rows, err = readSheet(exportCatalog(t, s, catalogXLSX))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows[1:] {
+		if row[0] == id && row[1] != formulaProduct.Title {
+			t.Errorf("XLSX title = %q, want %q", row[1], formulaProduct.Title)
+		}
+	}
+}
+
+func TestCatalogRoundTrip(t *testing.T) {
+	for _, format := range []string{catalogCSV, catalogXLSX} {
+		t.Run(format, func(t *testing.T) {
+			s := newTestServer(t)
+			p := addProduct(t, s, formulaProduct)
+			addProduct(t, s, dbgen.InsertProductParams{Title: "Steel Bottle", Url: "https://www.amazon.in/dp/B01", PricePaise: 129900})
+
+			report, err := s.ImportCatalog(context.Background(), exportCatalog(t, s, format), CatalogImport{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Unchanged != len(report.Rows) || report.Created+report.Updated+report.Failed != 0 {
+				t.Errorf("re-importing an export: %d created, %d updated, %d failed; want every row unchanged",
+					report.Created, report.Updated, report.Failed)
+			}
+			got, err := dbgen.New(s.DB).GetProduct(context.Background(), p.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != formulaProduct.Title || got.Description != formulaProduct.Description ||
+				got.LongDescription != formulaProduct.LongDescription {
+				t.Errorf("after round trip: %q, %q, %q; want the text as exported",
+					got.Title, got.Description, got.LongDescription)
+			}
+		})
+	}
+}
+
+func TestCatalogImportUpsert(t *testing.T) {
+	for _, format := range []string{catalogCSV, catalogXLSX} {
+		t.Run(format, func(t *testing.T) {
+			s := newTestServer(t)
+			ctx := context.Background()
+			q := dbgen.New(s.DB)
+			byID := addProduct(t, s, dbgen.InsertProductParams{Title: "Cotton Kurta", Url: "https://www.meesho.com/kurta/p/1", PricePaise: 49900})
+			byURL := addProduct(t, s, dbgen.InsertProductParams{Title: "Steel Bottle", Url: "https://www.amazon.in/dp/B01", PricePaise: 129900})
+
+			// Headers as another tool might write them: "Product Name",
+			// "Link" and "MRP" are recognised, "Selling Rs" is mapped by
+			// hand and "Notes" is ignored.
+			rows := [][]string{
+				{"ID", "Product Name", "Link", "Selling Rs", "MRP", "Notes"},
+				{strconv.FormatInt(byID.ID, 10), "Cotton Kurta (Blue)", "", "", "", "renamed"},
+				{"", "", byURL.Url, "1,149.50", "1999", "matched by link"},
+				{"", "Ceramic Mug", "https://shop.example.com/mug", "299", "399", "new"},
+				{"", "=1+1", "https://shop.example.com/cup", "199", "", "formula typed in the sheet"},
+			}
+			var buf bytes.Buffer
+			if format == catalogCSV {
+				w := csv.NewWriter(&buf)
+				w.WriteAll(rows)
+			} else if err := writeXLSX(&buf, "Products", rows); err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := s.ImportCatalog(ctx, buf.Bytes(), CatalogImport{Mapping: map[string]string{"Selling Rs": "price"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]string{"ID": "id", "Product Name": "title", "Link": "url", "Selling Rs": "price", "MRP": "original_price", "Notes": ""}
+			for _, c := range report.Columns {
+				if want[c.Header] != c.Field {
+					t.Errorf("column %q mapped to %q, want %q", c.Header, c.Field, want[c.Header])
+				}
+			}
+			if report.Updated != 2 || report.Created != 2 || report.Failed != 0 {
+				t.Fatalf("report %+v, want 2 updated and 2 created", report)
+			}
+
+			got, _ := q.GetProduct(ctx, byID.ID)
+			if got.Title != "Cotton Kurta (Blue)" || got.PricePaise != 49900 || got.Url != byID.Url {
+				t.Errorf("updated by id: %q, %d, %q; want the new title and the rest kept", got.Title, got.PricePaise, got.Url)
+			}
+			got, _ = q.GetProduct(ctx, byURL.ID)
+			if got.Title != "Steel Bottle" || got.PricePaise != 114950 || got.OriginalPricePaise != 199900 {
+				t.Errorf("updated by url: %q, %d, %d; want the title kept and prices 114950, 199900",
+					got.Title, got.PricePaise, got.OriginalPricePaise)
+			}
+			got, err = q.GetProductByURL(ctx, "https://shop.example.com/mug")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != "Ceramic Mug" || got.PricePaise != 29900 || got.OriginalPricePaise != 39900 || got.Platform != "Other" {
+				t.Errorf("created: %q, %d, %d, %q", got.Title, got.PricePaise, got.OriginalPricePaise, got.Platform)
+			}
+			// Only quotes added by an export are taken off.
+			got, _ = q.GetProductByURL(ctx, "https://shop.example.com/cup")
+			if got.Title != "=1+1" {
+				t.Errorf("title typed in the sheet = %q, want it kept as =1+1", got.Title)
+			}
+		})
+	}
+}
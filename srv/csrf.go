@@ -0,0 +1,89 @@
+package srv
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"mime"
+	"net/http"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// CSRF protection for admin writes. Signed-in requests use the synchronizer
+// pattern: each session row has its own random csrf_token, rendered into the
+// admin pages and sent back on every POST in the X-CSRF-Token header (fetch)
+// or the csrf_token form field (plain forms). Before there is a session, on
+// the login form and while the panel is open because no accounts exist, a
+// random admin_csrf cookie is used as a double-submit token instead.
+const (
+	csrfHeader = "X-CSRF-Token"
+	csrfField  = "csrf_token"
+	csrfCookie = "admin_csrf"
+)
+
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// csrfToken returns the token pages must send back with their next POST,
+// setting the pre-session cookie if needed.
+func (s *Server) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if sess := adminSession(r.Context()); sess != nil {
+		return sess.Session.CsrfToken
+	}
+	if sess, ok := s.currentSession(r); ok {
+		return sess.Session.CsrfToken
+	}
+	if c, err := r.Cookie(csrfCookie); err == nil && wellFormedToken(c.Value) {
+		return c.Value
+	}
+	token := newCSRFToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+// wellFormedToken reports whether v could have come from newCSRFToken, so a
+// cookie set by someone else is never written into a page.
+func wellFormedToken(v string) bool {
+	b, err := hex.DecodeString(v)
+	return err == nil && len(b) == 32
+}
+
+// validCSRF reports whether a state-changing request carries the expected
+// token. sess is the request's session, or nil before login.
+func validCSRF(r *http.Request, sess *dbgen.GetSessionRow) bool {
+	// Browsers that send Fetch Metadata tell us outright about cross-site
+	// requests; reject those before looking at tokens.
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return false
+	}
+	// Only plain forms may send the token as a field. Reading it from a
+	// multipart body would parse the whole upload before the handler can
+	// limit its size, so those must use the header.
+	got := r.Header.Get(csrfHeader)
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); got == "" && mt == "application/x-www-form-urlencoded" {
+		got = r.PostFormValue(csrfField)
+	}
+	var want string
+	if sess != nil {
+		want = sess.Session.CsrfToken
+	} else if c, err := r.Cookie(csrfCookie); err == nil {
+		want = c.Value
+	}
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// safeMethod reports whether a request method can't change state.
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
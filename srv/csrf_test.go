@@ -0,0 +1,147 @@
+package srv
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestLoginFormCSRF(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  func(c *testClient) string
+		header http.Header
+		ok     bool
+	}{
+		{"double-submit cookie", (*testClient).loginToken, nil, true},
+		{"same-origin", (*testClient).loginToken, http.Header{"Sec-Fetch-Site": {"same-origin"}}, true},
+		{"missing token", func(c *testClient) string { c.loginToken(); return "" }, nil, false},
+		{"wrong token", func(c *testClient) string { c.loginToken(); return strings.Repeat("ab", 32) }, nil, false},
+		{"no cookie", func(*testClient) string { return newCSRFToken() }, nil, false},
+		{"cross-site", (*testClient).loginToken, http.Header{"Sec-Fetch-Site": {"cross-site"}}, false},
+	}
+	s := newTestServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, s)
+			resp, _ := c.postForm("/admin/login", url.Values{
+				"username":   {"admin"},
+				"password":   {testPassword},
+				"csrf_token": {tt.token(c)},
+			}, tt.header)
+			loc := resp.Header.Get("Location")
+			if tt.ok && loc != "/admin" {
+				t.Errorf("redirected to %q, want /admin", loc)
+			}
+			if !tt.ok && !strings.Contains(loc, "expired") {
+				t.Errorf("redirected to %q, want the login form with an error", loc)
+			}
+		})
+	}
+}
+
+func TestAdminPostCSRF(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestClient(t, s)
+	token := c.login()
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		header http.Header
+		status int
+	}{
+		{"missing token", nil, nil, http.StatusForbidden},
+		{"wrong header token", nil, http.Header{"X-Csrf-Token": {strings.Repeat("0", 64)}}, http.StatusForbidden},
+		{"wrong form token", url.Values{"csrf_token": {newCSRFToken()}}, nil, http.StatusForbidden},
+		{"cross-site with token", nil, http.Header{"X-Csrf-Token": {token}, "Sec-Fetch-Site": {"cross-site"}}, http.StatusForbidden},
+		{"header token", nil, http.Header{"X-Csrf-Token": {token}, "Sec-Fetch-Site": {"same-origin"}}, http.StatusOK},
+		{"form token", url.Values{"csrf_token": {token}}, nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := addProduct(t, s, dbgen.InsertProductParams{Title: "Victim", PricePaise: 10000})
+			resp, body := c.postForm("/api/delete/"+strconv.FormatInt(p.ID, 10), tt.form, tt.header)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d (%s), want %d", resp.StatusCode, body, tt.status)
+			}
+			_, err := dbgen.New(s.DB).GetProduct(context.Background(), p.ID)
+			if deleted := err != nil; deleted != (tt.status == http.StatusOK) {
+				t.Errorf("deleted = %v, want %v", deleted, tt.status == http.StatusOK)
+			}
+		})
+	}
+}
+
+// A session cookie alone, as a cross-origin form would send, is refused.
+func TestAdminPostNeedsSessionToken(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestClient(t, s)
+	c.login()
+	// The pre-login cookie is no substitute for the session's token.
+	u, _ := url.Parse(c.base)
+	var pre string
+	for _, ck := range c.http.Jar.Cookies(u) {
+		if ck.Name == csrfCookie {
+			pre = ck.Value
+		}
+	}
+	if pre == "" {
+		t.Fatal("no admin_csrf cookie")
+	}
+	p := addProduct(t, s, dbgen.InsertProductParams{Title: "Victim", PricePaise: 10000})
+	resp, _ := c.postForm("/api/delete/"+strconv.FormatInt(p.ID, 10), url.Values{"csrf_token": {pre}}, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status %d, want 403", resp.StatusCode)
+	}
+}
+
+// A forged admin_csrf cookie is replaced, never written into the page.
+func TestLoginFormIgnoresForgedCookie(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestClient(t, s)
+	forged := "'><script>alert(1)</script>"
+	forged += strings.Repeat("a", 64-len(forged))
+	req, _ := http.NewRequest("GET", c.base+"/admin/login", nil)
+	req.Header.Set("Cookie", csrfCookie+"="+forged)
+	resp, body := c.do(req)
+	if strings.Contains(body, "<script>alert(1)") {
+		t.Error("forged cookie written into the login form")
+	}
+	var fresh string
+	for _, ck := range resp.Cookies() {
+		if ck.Name == csrfCookie {
+			fresh = ck.Value
+		}
+	}
+	if !wellFormedToken(fresh) || !strings.Contains(body, `value="`+fresh+`"`) {
+		t.Errorf("new cookie %q isn't the form's token", fresh)
+	}
+}
+
+// Multipart posts must send the token in the header: finding it in the
+// body would mean parsing the body before the handler limits its size.
+func TestMultipartPostNeedsHeaderToken(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestClient(t, s)
+	token := c.login()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField(csrfField, token)
+	fw, _ := mw.CreateFormFile("file", "photo.png")
+	fw.Write(encodePNG(t, noise(8, 8)))
+	mw.Close()
+	req, _ := http.NewRequest("POST", c.base+"/api/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if resp, _ := c.do(req); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("token in a multipart field: status %d, want 403", resp.StatusCode)
+	}
+}
@@ -0,0 +1,269 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Every request to a URL that came from outside, whether an admin's
+// product link, a store page or an image shown through /img, goes through
+// a fetcher. It only talks to public addresses, checked on the address
+// actually dialled so redirects and DNS tricks can't reach the server's
+// own network, and only to the hosts and content types it was made for.
+
+// errFetchBlocked wraps refusals to fetch a URL, as opposed to failures
+// fetching it.
+var errFetchBlocked = errors.New("not allowed")
+
+// errFetchTooLarge is returned reading a response longer than the
+// fetcher's limit.
+var errFetchTooLarge = errors.New("response too large")
+
+// fetcher is an HTTP client for outside URLs with its own policy.
+type fetcher struct {
+	// hosts are the host names it may fetch from, matched exactly; nil
+	// allows any public host.
+	hosts []string
+	// hostPattern matches further hosts it may fetch from, such as a
+	// CDN's numbered shards.
+	hostPattern *regexp.Regexp
+	// contentTypes are the media types a 200 response may have.
+	contentTypes []string
+	maxBytes     int64
+	client       *http.Client
+}
+
+// Fetchers for each kind of outside URL.
+var (
+	// pageFetcher reads product pages. Admins add products from any shop,
+	// so any public host will do.
+	pageFetcher = newFetcher(15*time.Second, 5<<20, []string{"text/html", "application/xhtml+xml"}, nil)
+	// meeshoFetcher reads Meesho store listings.
+	meeshoFetcher = newFetcher(30*time.Second, 5<<20, []string{"text/html", "application/xhtml+xml"},
+		[]string{"www.meesho.com", "meesho.com"})
+	// imageFetcher reads product images from the platforms' CDNs for /img.
+	// Only raster images: SVGs can carry scripts, and /img serves them
+	// from our own origin.
+	imageFetcher = newFetcher(10*time.Second, 10<<20,
+		[]string{"image/jpeg", "image/png", "image/webp", "image/gif", "image/avif"},
+		[]string{
+			"images.meesho.com",
+			"m.media-amazon.com",
+			"images-eu.ssl-images-amazon.com",
+			"images-na.ssl-images-amazon.com",
+			"img.fkcdn.com",
+		}).allowHostPattern(flipkartCDNHostRe)
+)
+
+func newFetcher(timeout time.Duration, maxBytes int64, contentTypes, hosts []string) *fetcher {
+	f := &fetcher{hosts: hosts, contentTypes: contentTypes, maxBytes: maxBytes}
+	f.client = f.newClient(timeout)
+	return f
+}
+
+// allowHostPattern lets f fetch from hosts matching re as well as its
+// listed ones.
+func (f *fetcher) allowHostPattern(re *regexp.Regexp) *fetcher {
+	f.hostPattern = re
+	return f
+}
+
+// fetchTransport is shared by every fetcher. It ignores proxy settings,
+// since a proxy would dial on our behalf and skip the address check.
+var fetchTransport = &http.Transport{
+	Proxy: nil,
+	DialContext: (&net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   checkDialAddress,
+	}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          50,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ResponseHeaderTimeout: 15 * time.Second,
+}
+
+func (f *fetcher) newClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: fetchTransport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+}
+
+// checkDialAddress refuses connections to anything but public unicast
+// addresses. It runs after DNS resolution, on the address being dialled.
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddr(ip) {
+		return fmt.Errorf("%w: %s is a private address", errFetchBlocked, ip)
+	}
+	return nil
+}
+
+// nonPublic are ranges the netip predicates don't cover: shared carrier
+// NAT, IETF protocol assignments, benchmarking, reserved, and IPv6 ranges
+// that embed IPv4 addresses.
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// publicAddr reports whether ip is a public unicast address.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, p := range nonPublic {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkURL checks a URL, or a redirect's, against the fetcher's policy.
+func (f *fetcher) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: %s links", errFetchBlocked, u.Scheme)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: links with a user name", errFetchBlocked)
+	}
+	if p := u.Port(); p != "" && p != "80" && p != "443" {
+		return fmt.Errorf("%w: port %s", errFetchBlocked, p)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" {
+		return fmt.Errorf("%w: no host", errFetchBlocked)
+	}
+	if f.hosts != nil && !slices.Contains(f.hosts, host) && (f.hostPattern == nil || !f.hostPattern.MatchString(host)) {
+		return fmt.Errorf("%w: %s isn't an allowed host", errFetchBlocked, host)
+	}
+	// Literal addresses are caught when dialled too, but this gives a
+	// clearer error.
+	ip, err := netip.ParseAddr(strings.Trim(host, "[]"))
+	if err == nil && !publicAddr(ip) {
+		return fmt.Errorf("%w: %s is a private address", errFetchBlocked, ip)
+	}
+	// Other spellings of IPv4 addresses, such as 2130706433 or 0x7f.1,
+	// which some resolvers accept. No top-level domain is a number.
+	if err != nil && numericLabel(host[strings.LastIndexByte(host, '.')+1:]) {
+		return fmt.Errorf("%w: %s isn't a host name", errFetchBlocked, host)
+	}
+	return nil
+}
+
+// numericLabel reports whether a DNS label is a decimal or hex number.
+func numericLabel(label string) bool {
+	digits := "0123456789"
+	if rest, ok := strings.CutPrefix(label, "0x"); ok {
+		label, digits = rest, "0123456789abcdef"
+	}
+	return label != "" && strings.Trim(label, digits) == ""
+}
+
+// get fetches rawURL with the given headers. The caller checks the status
+// and closes the body; a 200 response has an allowed content type, and its
+// body fails with errFetchTooLarge past the fetcher's limit.
+func (f *fetcher) get(ctx context.Context, rawURL string, header http.Header) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.checkURL(u); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	if err := f.checkContentType(resp.Header.Get("Content-Type")); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if resp.ContentLength > f.maxBytes {
+		resp.Body.Close()
+		return nil, errFetchTooLarge
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, left: f.maxBytes}
+	return resp, nil
+}
+
+func (f *fetcher) checkContentType(header string) error {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return fmt.Errorf("%w: missing or invalid content type %q", errFetchBlocked, header)
+	}
+	if slices.Contains(f.contentTypes, mediaType) {
+		return nil
+	}
+	return fmt.Errorf("%w: content type %s", errFetchBlocked, mediaType)
+}
+
+// limitedBody is a response body that fails once it passes a limit,
+// rather than ending early as io.LimitReader would.
+type limitedBody struct {
+	io.ReadCloser
+	left int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.left <= 0 {
+		// One more byte tells a body of exactly the limit from a longer one.
+		var one [1]byte
+		n, err := b.ReadCloser.Read(one[:])
+		if n > 0 {
+			return 0, errFetchTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.left {
+		p = p[:b.left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.left -= int64(n)
+	return n, err
+}
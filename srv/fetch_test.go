@@ -0,0 +1,136 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCheckDialAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		ok      bool
+	}{
+		{"93.184.215.14:443", true},
+		{"[2606:4700::6810:84e5]:443", true},
+		{"169.254.169.254:80", false}, // cloud metadata
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"[::ffff:169.254.169.254]:80", false},
+		{"10.1.2.3:443", false},
+		{"172.16.0.1:443", false},
+		{"192.168.1.1:443", false},
+		{"100.64.0.1:443", false},
+		{"0.0.0.0:80", false},
+		{"[fd00::1]:443", false},
+		{"[fe80::1]:443", false},
+		{"[64:ff9b::7f00:1]:80", false}, // NAT64 for 127.0.0.1
+		{"[2002:7f00:1::]:80", false},   // 6to4 for 127.0.0.1
+	}
+	for _, tt := range tests {
+		err := checkDialAddress("tcp", tt.address, nil)
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v, want allowed", tt.address, err)
+		}
+		if !tt.ok && !errors.Is(err, errFetchBlocked) {
+			t.Errorf("%s: %v, want errFetchBlocked", tt.address, err)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		f   *fetcher
+		url string
+		ok  bool
+	}{
+		// Product pages come from any shop, so only the address is checked.
+		{pageFetcher, "https://www.meesho.com/kurti/p/1", true},
+		{pageFetcher, "https://amzn.to/3xYz", true},
+		{pageFetcher, "https://WWW.FLIPKART.COM./p/itm1", true},
+		{pageFetcher, "https://shop.example.com/product", true},
+		{pageFetcher, "http://169.254.169.254/latest/meta-data/", false},
+		{pageFetcher, "http://[::ffff:127.0.0.1]/", false},
+		{pageFetcher, "http://10.0.0.1/", false},
+		{pageFetcher, "http://2130706433/", false}, // 127.0.0.1 in decimal
+		{pageFetcher, "http://0177.0.0.1/", false}, // 127.0.0.1 in octal
+		{pageFetcher, "http://0x7f.1/", false},
+		{pageFetcher, "https://www.meesho.com:8443/p/1", false},
+		{pageFetcher, "https://admin@www.meesho.com/p/1", false},
+		{pageFetcher, "file:///etc/passwd", false},
+		{pageFetcher, "gopher://www.meesho.com/", false},
+
+		// Images only come from the platforms' CDNs.
+		{imageFetcher, "https://images.meesho.com/images/products/1/a_512.webp", true},
+		{imageFetcher, "https://m.media-amazon.com/images/I/71a.jpg", true},
+		{imageFetcher, "https://rukminim1.flixcart.com/image/832/832/a.jpeg", true},
+		{imageFetcher, "https://rukminim2.flixcart.com/image/832/832/a.jpeg", true},
+		{imageFetcher, "https://rukminim.flixcart.com/image/832/832/a.jpeg", true},
+		{imageFetcher, "https://rukminim13.flixcart.com/image/832/832/a.jpeg", true},
+		{imageFetcher, "https://rukminim1.flixcart.com.evil.example/a.jpeg", false},
+		{imageFetcher, "https://evil-rukminim1.flixcart.com/a.jpeg", false},
+		{imageFetcher, "https://images.meesho.com.evil.example/a.jpg", false},
+		{imageFetcher, "https://shop.example.com/a.jpg", false},
+		{imageFetcher, "http://169.254.169.254/a.jpg", false},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tt.f.checkURL(u)
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v, want allowed", tt.url, err)
+		}
+		if !tt.ok && !errors.Is(err, errFetchBlocked) {
+			t.Errorf("%s: %v, want errFetchBlocked", tt.url, err)
+		}
+	}
+}
+
+func TestFetchRedirectToPrivateAddress(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+	}))
+	defer ts.Close()
+
+	// An allowed host whose DNS points at the test server, so the first
+	// request gets through and only the redirect is checked.
+	f := newFetcher(5*time.Second, 1<<20, []string{"text/html"}, []string{"www.meesho.com"})
+	f.client.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, ts.Listener.Addr().String())
+		},
+	}
+	for _, to := range []string{
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::ffff:127.0.0.1]/",
+		"http://2130706433/",
+		"http://localhost/",
+		"https://www.meesho.com:8443/",
+	} {
+		_, err := f.get(context.Background(), "http://www.meesho.com/r?to="+url.QueryEscape(to), nil)
+		if !errors.Is(err, errFetchBlocked) {
+			t.Errorf("redirect to %s: %v, want errFetchBlocked", to, err)
+		}
+	}
+
+	// A host that resolves to a private address is refused when dialled,
+	// whatever its name.
+	f = newFetcher(5*time.Second, 1<<20, []string{"text/html"}, []string{"www.meesho.com"})
+	f.client.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := &net.Dialer{Control: checkDialAddress}
+			return d.DialContext(ctx, network, ts.Listener.Addr().String())
+		},
+	}
+	if _, err := f.get(context.Background(), "http://www.meesho.com/", nil); !errors.Is(err, errFetchBlocked) {
+		t.Errorf("host resolving to %s: %v, want errFetchBlocked", ts.Listener.Addr(), err)
+	}
+}
@@ -0,0 +1,460 @@
+package srv
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Images shown through /img are kept on disk under UploadsDir/cache, the
+// originals and each size asked for, so the CDN is asked for an image
+// once. Files are named by a hash of the image URL and size, followed by
+// a hash of their bytes that doubles as the ETag. The least recently used
+// files are removed once the cache passes its size limit, and requests
+// for an image that is already being fetched or resized wait for that
+// instead of starting another.
+
+// Resize modes for /img's fit parameter.
+const (
+	fitContain = "contain" // fit inside w×h, keeping the aspect ratio
+	fitCover   = "cover"   // fill w×h, cropping the overflow
+)
+
+// Image resizing limits.
+const (
+	maxThumbSide = 1600 // largest w or h
+	thumbStep    = 20   // w and h round up to a multiple of this
+	// decodeBytesPerPixel is about the most memory an image takes per
+	// pixel while it's being worked on: decoded, plus a full-size RGBA
+	// copy turned upright or converted from WebP's colour range.
+	decodeBytesPerPixel = 8
+)
+
+// decodeSlot is held while an image is decoded and worked on, for /img
+// and uploads alike, so only one is in memory at a time and
+// Server.ImageMemory bounds its size.
+var decodeSlot = make(chan struct{}, 1)
+
+// maxDecodePixels is the largest image, in pixels, that fits in
+// s.ImageMemory. Larger ones are served unresized and refused as uploads.
+func (s *Server) maxDecodePixels() int {
+	return int(s.ImageMemory / decodeBytesPerPixel)
+}
+
+// imageVariant is a size and format of an image, the zero value being the
+// original.
+type imageVariant struct {
+	W, H int
+	Fit  string
+	// Format is formatWebP to encode as WebP where it can, or empty for
+	// JPEG, or PNG with transparency.
+	Format string
+}
+
+// formatWebP is imageVariant.Format for WebP.
+const formatWebP = "webp"
+
+func (v imageVariant) String() string {
+	if v == (imageVariant{}) {
+		return "original"
+	}
+	s := fmt.Sprintf("%dx%d-%s", v.W, v.H, v.Fit)
+	if v.Format != "" {
+		s += "." + v.Format
+	}
+	return s
+}
+
+// cachedImage is a file in the image cache.
+type cachedImage struct {
+	key         string
+	path        string
+	etag        string
+	contentType string
+	size        int64
+}
+
+// imageFlight is a fetch or resize that other requests can wait for.
+type imageFlight struct {
+	done chan struct{}
+	img  *cachedImage
+	err  error
+}
+
+// imageCache is the on-disk cache behind /img.
+type imageCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // of *cachedImage, by key
+	lru     *list.List               // most recently used first
+	size    int64
+	flights map[string]*imageFlight
+}
+
+// Extensions of cached files, by content type.
+var imageExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+	"image/avif": ".avif",
+}
+
+// newImageCache opens the cache in dir, picking up the files already there
+// in order of last use.
+func newImageCache(dir string, maxBytes int64) *imageCache {
+	c := &imageCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+		flights:  map[string]*imageFlight{},
+	}
+	type found struct {
+		img  *cachedImage
+		used time.Time
+	}
+	var files []found
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		img := parseCachedName(path)
+		if img == nil {
+			// Half-written files from a crash.
+			os.Remove(path)
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			img.size = info.Size()
+			files = append(files, found{img, info.ModTime()})
+		}
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].used.After(files[j].used) })
+	for _, f := range files {
+		c.entries[f.img.key] = c.lru.PushBack(f.img)
+		c.size += f.img.size
+	}
+	c.evict()
+	return c
+}
+
+// parseCachedName reads a cached file's key, ETag and type back from its
+// name, nil if it isn't one.
+func parseCachedName(path string) *cachedImage {
+	name := filepath.Base(path)
+	ext := filepath.Ext(name)
+	key, sum, ok := strings.Cut(strings.TrimSuffix(name, ext), "-")
+	if !ok || len(key) != 64 || sum == "" {
+		return nil
+	}
+	for contentType, e := range imageExts {
+		if e == ext {
+			return &cachedImage{key: key, path: path, etag: `"` + sum + `"`, contentType: contentType}
+		}
+	}
+	return nil
+}
+
+// imageKey is the cache key of a size of the image at src.
+func imageKey(src string, v imageVariant) string {
+	sum := sha256.Sum256([]byte(src + "\n" + v.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the cached image for key, running fill to make it if it
+// isn't cached and nobody else is already making it. fill runs to the end
+// even if ctx is cancelled, since other requests may be waiting for it.
+func (c *imageCache) get(ctx context.Context, key string, fill func(ctx context.Context) ([]byte, string, error)) (*cachedImage, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(el)
+		img := el.Value.(*cachedImage)
+		c.mu.Unlock()
+		// Keeps the order across restarts.
+		now := time.Now()
+		os.Chtimes(img.path, now, now)
+		return img, nil
+	}
+	f, ok := c.flights[key]
+	if !ok {
+		f = &imageFlight{done: make(chan struct{})}
+		c.flights[key] = f
+		go c.fill(key, f, fill)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.img, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *imageCache) fill(key string, f *imageFlight, fill func(ctx context.Context) ([]byte, string, error)) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.flights, key)
+		c.mu.Unlock()
+		close(f.done)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	data, contentType, err := fill(ctx)
+	if err != nil {
+		f.err = err
+		return
+	}
+	f.img, f.err = c.store(key, data, contentType)
+}
+
+// store writes an image to the cache and makes room for it.
+func (c *imageCache) store(key string, data []byte, contentType string) (*cachedImage, error) {
+	ext, ok := imageExts[contentType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported image type %s", contentType)
+	}
+	sum := sha256.Sum256(data)
+	etag := hex.EncodeToString(sum[:8])
+	path := filepath.Join(c.dir, key[:2], key+"-"+etag+ext)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	// Written under another name first, so a crash never leaves a
+	// truncated image under a real one.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	img := &cachedImage{key: key, path: path, etag: `"` + etag + `"`, contentType: contentType, size: int64(len(data))}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		old := el.Value.(*cachedImage)
+		c.size -= old.size
+		c.lru.Remove(el)
+		if old.path != path {
+			os.Remove(old.path)
+		}
+	}
+	c.entries[key] = c.lru.PushFront(img)
+	c.size += img.size
+	c.evict()
+	return img, nil
+}
+
+// forget drops an entry whose file has gone missing.
+func (c *imageCache) forget(img *cachedImage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[img.key]; ok && el.Value.(*cachedImage) == img {
+		c.lru.Remove(el)
+		delete(c.entries, img.key)
+		c.size -= img.size
+	}
+}
+
+// evict removes the least recently used files until the cache fits. The
+// caller holds c.mu.
+func (c *imageCache) evict() {
+	for c.size > c.maxBytes && c.lru.Len() > 1 {
+		el := c.lru.Back()
+		img := el.Value.(*cachedImage)
+		c.lru.Remove(el)
+		delete(c.entries, img.key)
+		c.size -= img.size
+		if err := os.Remove(img.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("evict cached image", "path", img.path, "error", err)
+		}
+	}
+}
+
+// resizeImage scales an image to fit v, returning it as JPEG, or PNG if it
+// has transparency. Opaque images are WebP instead when v asks for it,
+// which also converts ones that are already small enough. ok is false
+// when the image is left as it is: nothing to do, more than maxPixels to
+// decode, or in a format we can't read.
+func resizeImage(data []byte, v imageVariant, maxPixels int) (out []byte, contentType string, ok bool, err error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width*cfg.Height > maxPixels || cfg.Width == 0 || cfg.Height == 0 {
+		return nil, "", false, nil
+	}
+	dstW, dstH, crop := fitSize(cfg.Width, cfg.Height, v)
+	resized := dstW < cfg.Width || dstH < cfg.Height || crop != image.Rect(0, 0, cfg.Width, cfg.Height)
+	// GIFs could be animated, and would lose all but the first frame.
+	if !resized && (v.Format != formatWebP || format != "jpeg" && format != "png") {
+		return nil, "", false, nil
+	}
+
+	decodeSlot <- struct{}{}
+	defer func() { <-decodeSlot }()
+	src, _, err := decodeImage(data)
+	if err != nil {
+		return nil, "", false, err
+	}
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop.Add(b.Min), draw.Src, nil)
+
+	var buf bytes.Buffer
+	switch {
+	case !dst.Opaque():
+		if !resized {
+			return nil, "", false, nil
+		}
+		err = (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(&buf, dst)
+		contentType = "image/png"
+	case v.Format == formatWebP:
+		err = encodeWebP(&buf, dst, 80)
+		contentType = "image/webp"
+	default:
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 82})
+		contentType = "image/jpeg"
+	}
+	if err != nil {
+		return nil, "", false, err
+	}
+	if !resized && buf.Len() >= len(data) {
+		// Converting only pays when it's smaller.
+		return nil, "", false, nil
+	}
+	return buf.Bytes(), contentType, true, nil
+}
+
+// decodeImage decodes an image as image.Decode does, except that lossy
+// WebPs come back as RGB in the right colour range; see webpRGB.
+func decodeImage(data []byte) (image.Image, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err == nil && format == "webp" {
+		img = webpRGB(img)
+	}
+	return img, format, err
+}
+
+// webpRGB converts a lossy WebP, as golang.org/x/image/webp decodes it,
+// to RGB. VP8 stores BT.601 YCbCr in studio range, luma from 16 to 235,
+// but the decoder returns it as an image.YCbCr, which the image packages
+// read as JPEG's full range: black would come out as 16 and white as 235,
+// and each resize or re-encode would lose more contrast. Lossless WebPs
+// decode to NRGBA and are returned as they are.
+func webpRGB(img image.Image) image.Image {
+	var ycc *image.YCbCr
+	var alpha *image.NYCbCrA
+	switch m := img.(type) {
+	case *image.YCbCr:
+		ycc = m
+	case *image.NYCbCrA:
+		ycc, alpha = &m.YCbCr, m
+	default:
+		return img
+	}
+	b := ycc.Bounds()
+	var pix []uint8
+	var stride int
+	var out image.Image
+	if alpha != nil {
+		m := image.NewNRGBA(b)
+		pix, stride, out = m.Pix, m.Stride, m
+	} else {
+		m := image.NewRGBA(b)
+		pix, stride, out = m.Pix, m.Stride, m
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			ci := ycc.COffset(x, y)
+			p := pix[(y-b.Min.Y)*stride+(x-b.Min.X)*4:]
+			p[0], p[1], p[2] = vp8RGB(ycc.Y[ycc.YOffset(x, y)], ycc.Cb[ci], ycc.Cr[ci])
+			p[3] = 255
+			if alpha != nil {
+				p[3] = alpha.A[alpha.AOffset(x, y)]
+			}
+		}
+	}
+	return out
+}
+
+// vp8RGB converts studio-range BT.601 YCbCr to RGB with the fixed-point
+// arithmetic of libwebp, which browsers decode WebP with.
+func vp8RGB(y, cb, cr uint8) (r, g, b uint8) {
+	yy := int32(y) * 19077 >> 8
+	u, v := int32(cb), int32(cr)
+	return vp8Clip6(yy + v*26149>>8 - 14234),
+		vp8Clip6(yy - u*6419>>8 - v*13320>>8 + 8708),
+		vp8Clip6(yy + u*33050>>8 - 17685)
+}
+
+// vp8Clip6 clamps a value with 6 fractional bits to a byte.
+func vp8Clip6(v int32) uint8 {
+	if v&^16383 == 0 {
+		return uint8(v >> 6)
+	}
+	if v < 0 {
+		return 0
+	}
+	return 255
+}
+
+// fitSize works out the output size of a w×h image for v, and the part of
+// it to scale. Images are never enlarged.
+func fitSize(w, h int, v imageVariant) (dstW, dstH int, crop image.Rectangle) {
+	crop = image.Rect(0, 0, w, h)
+	switch {
+	case v.W > 0 && v.H > 0 && v.Fit == fitCover:
+		// Crop to the target's aspect ratio, centred, then scale.
+		if w*v.H > h*v.W {
+			cw := h * v.W / v.H
+			crop = image.Rect((w-cw)/2, 0, (w-cw)/2+cw, h)
+		} else {
+			ch := w * v.H / v.W
+			crop = image.Rect(0, (h-ch)/2, w, (h-ch)/2+ch)
+		}
+		dstW, dstH = min(v.W, crop.Dx()), min(v.H, crop.Dy())
+		// Keep the aspect ratio when the crop is smaller than asked.
+		if dstW*v.H != dstH*v.W {
+			if dstW*v.H > dstH*v.W {
+				dstW = dstH * v.W / v.H
+			} else {
+				dstH = dstW * v.H / v.W
+			}
+		}
+	default:
+		scale := 1.0
+		if v.W > 0 {
+			scale = min(scale, float64(v.W)/float64(w))
+		}
+		if v.H > 0 {
+			scale = min(scale, float64(v.H)/float64(h))
+		}
+		dstW, dstH = int(float64(w)*scale+0.5), int(float64(h)*scale+0.5)
+	}
+	return max(dstW, 1), max(dstH, 1), crop
+}
@@ -0,0 +1,291 @@
+package srv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blackAndWhite is a w×h image, black on the left and white on the right.
+func blackAndWhite(w, h int) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			if x >= w/2 {
+				m.SetRGBA(x, y, color.RGBA{255, 255, 255, 255})
+			} else {
+				m.SetRGBA(x, y, color.RGBA{0, 0, 0, 255})
+			}
+		}
+	}
+	return m
+}
+
+// checkBlackAndWhite checks that the middle of each half of m is still
+// black or white, within tolerance.
+func checkBlackAndWhite(t *testing.T, name string, m image.Image, tolerance uint8) {
+	t.Helper()
+	b := m.Bounds()
+	y := b.Min.Y + b.Dy()/2
+	for _, c := range []struct {
+		x    int
+		want uint8
+	}{{b.Min.X + b.Dx()/4, 0}, {b.Min.X + b.Dx()*3/4, 255}} {
+		r, g, bl, _ := m.At(c.x, y).RGBA()
+		for _, v := range []uint8{uint8(r >> 8), uint8(g >> 8), uint8(bl >> 8)} {
+			if max(v, c.want)-min(v, c.want) > tolerance {
+				t.Errorf("%s: pixel (%d,%d) = %d,%d,%d, want %d", name, c.x, y, r>>8, g>>8, bl>>8, c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestWebPColourRange(t *testing.T) {
+	var buf bytes.Buffer
+	if err := encodeWebP(&buf, blackAndWhite(64, 32), 90); err != nil {
+		t.Fatal(err)
+	}
+	webp := buf.Bytes()
+
+	m, format, err := decodeImage(webp)
+	if err != nil || format != "webp" {
+		t.Fatalf("decode: %v, %q", err, format)
+	}
+	checkBlackAndWhite(t, "decoded", m, 3)
+
+	for _, v := range []imageVariant{
+		{W: 32, H: 16, Fit: fitCover},
+		{W: 32, H: 16, Fit: fitCover, Format: formatWebP},
+	} {
+		out, contentType, ok, err := resizeImage(webp, v, 1<<20)
+		if err != nil || !ok {
+			t.Fatalf("resize to %s: %v, %v", v, ok, err)
+		}
+		m, _, err := decodeImage(out)
+		if err != nil {
+			t.Fatalf("decode %s: %v", contentType, err)
+		}
+		if m.Bounds().Dx() != 32 || m.Bounds().Dy() != 16 {
+			t.Errorf("resized to %v, want 32×16", m.Bounds().Size())
+		}
+		checkBlackAndWhite(t, "resized as "+contentType, m, 6)
+	}
+}
+
+func TestWebPRGBMatchesLibwebp(t *testing.T) {
+	tests := []struct {
+		y, cb, cr uint8
+		r, g, b   uint8
+	}{
+		{16, 128, 128, 0, 0, 0},
+		{235, 128, 128, 255, 255, 255},
+		{126, 128, 128, 128, 128, 128},
+		{81, 90, 240, 255, 0, 0},
+		{145, 54, 34, 0, 255, 0},
+		{41, 240, 110, 0, 0, 255},
+	}
+	for _, tt := range tests {
+		r, g, b := vp8RGB(tt.y, tt.cb, tt.cr)
+		if max(r, tt.r)-min(r, tt.r) > 1 || max(g, tt.g)-min(g, tt.g) > 1 || max(b, tt.b)-min(b, tt.b) > 1 {
+			t.Errorf("vp8RGB(%d, %d, %d) = %d, %d, %d, want %d, %d, %d", tt.y, tt.cb, tt.cr, r, g, b, tt.r, tt.g, tt.b)
+		}
+	}
+}
+
+func TestResizeImageMemoryLimit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := encodeWebP(&buf, blackAndWhite(64, 32), 90); err != nil {
+		t.Fatal(err)
+	}
+	v := imageVariant{W: 32, H: 16, Fit: fitCover}
+	if _, _, ok, err := resizeImage(buf.Bytes(), v, 64*32-1); ok || err != nil {
+		t.Errorf("image over the limit: resized %v, error %v; want it left as it is", ok, err)
+	}
+	if _, _, ok, err := resizeImage(buf.Bytes(), v, 64*32); !ok || err != nil {
+		t.Errorf("image at the limit: resized %v, error %v; want it resized", ok, err)
+	}
+}
+
+// cacheKeys lists a cache's keys, most recently used first.
+func cacheKeys(c *imageCache) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keys []string
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Value.(*cachedImage).key)
+	}
+	return keys
+}
+
+// storeTestImage stores size bytes of fake PNG under a key made from name.
+func storeTestImage(t *testing.T, c *imageCache, name string, size int) *cachedImage {
+	t.Helper()
+	data := append([]byte("\x89PNG\r\n\x1a\n"+name), make([]byte, size-8-len(name))...)
+	img, err := c.store(imageKey(name, imageVariant{}), data, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestImageCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	c := newImageCache(dir, 250)
+	a := storeTestImage(t, c, "a", 100)
+	b := storeTestImage(t, c, "b", 100)
+	// Using a makes b the least recently used.
+	if img, err := c.get(context.Background(), a.key, nil); err != nil || img != a {
+		t.Fatalf("get a: %v, %v", img, err)
+	}
+	cc := storeTestImage(t, c, "c", 100)
+
+	if got, want := cacheKeys(c), []string{cc.key, a.key}; !slices.Equal(got, want) {
+		t.Errorf("keys %q, want c then a", got)
+	}
+	if c.size != 200 {
+		t.Errorf("size %d, want 200", c.size)
+	}
+	if _, err := os.Stat(b.path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("evicted file: %v, want it removed", err)
+	}
+
+	// An image bigger than the whole cache is kept until the next one.
+	big := storeTestImage(t, c, "big", 400)
+	if got := cacheKeys(c); !slices.Equal(got, []string{big.key}) {
+		t.Errorf("after storing an image over the limit: %d entries, want only it", len(got))
+	}
+	d := storeTestImage(t, c, "d", 100)
+
+	// Reopened, the cache finds its files in the order they were used.
+	e := storeTestImage(t, c, "e", 100)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(d.path, old, old)
+	c = newImageCache(dir, 150)
+	if got := cacheKeys(c); !slices.Equal(got, []string{e.key}) {
+		t.Errorf("reopened with room for one: keys %q, want e, the last used", got)
+	}
+	if _, err := os.Stat(d.path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file evicted on reopening: %v, want it removed", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*", "*"))
+	if len(files) != 1 {
+		t.Errorf("cache dir holds %q, want only e", files)
+	}
+}
+
+func TestImageCacheCoalesces(t *testing.T) {
+	c := newImageCache(t.TempDir(), 1<<20)
+	key := imageKey("https://images.meesho.com/a.jpg", imageVariant{})
+	var fills atomic.Int32
+	release := make(chan struct{})
+	fill := func(ctx context.Context) ([]byte, string, error) {
+		fills.Add(1)
+		<-release
+		return []byte("\xff\xd8\xff fake jpeg"), "image/jpeg", nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	imgs := make([]*cachedImage, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			img, err := c.get(context.Background(), key, fill)
+			if err != nil {
+				t.Error(err)
+			}
+			imgs[i] = img
+		}()
+	}
+	// Give the other requests time to find the fill in progress. Any that
+	// come after it finishes get the cached image instead.
+	for {
+		c.mu.Lock()
+		waiting := c.flights[key] != nil
+		c.mu.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if fills.Load() != 1 {
+		t.Errorf("fill ran %d times for %d requests, want once", fills.Load(), n)
+	}
+	for _, img := range imgs {
+		if img != imgs[0] || img == nil {
+			t.Fatal("requests got different images")
+		}
+	}
+	if _, err := c.get(context.Background(), key, fill); err != nil || fills.Load() != 1 {
+		t.Errorf("cached image: fill ran %d times, error %v; want it served from the cache", fills.Load(), err)
+	}
+
+	// Failures aren't cached.
+	failing := imageKey("https://images.meesho.com/missing.jpg", imageVariant{})
+	for range 2 {
+		_, err := c.get(context.Background(), failing, func(context.Context) ([]byte, string, error) {
+			fills.Add(1)
+			return nil, "", errImageNotFound
+		})
+		if !errors.Is(err, errImageNotFound) {
+			t.Errorf("failed fill: %v, want errImageNotFound", err)
+		}
+	}
+	if fills.Load() != 3 {
+		t.Errorf("failed fill ran %d times for two requests, want twice", fills.Load()-1)
+	}
+}
+
+func TestImageProxyNotModified(t *testing.T) {
+	s := newTestServer(t)
+	// Serve makes the cache, along with workers this test doesn't need.
+	s.images = newImageCache(filepath.Join(s.UploadsDir, "cache"), s.ImageCacheSize)
+	var buf bytes.Buffer
+	if err := encodeWebP(&buf, blackAndWhite(64, 64), 90); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(s.UploadsDir, "photo.webp"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, s)
+
+	resp, _ := c.get("/img?url=/uploads/photo.webp&w=40&h=40&fit=cover")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("first request: %d, ETag %q; want 200 with an ETag", resp.StatusCode, etag)
+	}
+	for _, tt := range []struct {
+		ifNoneMatch string
+		status      int
+	}{
+		{etag, http.StatusNotModified},
+		{`"0000000000000000", ` + etag, http.StatusNotModified},
+		{`"0000000000000000"`, http.StatusOK},
+	} {
+		req, _ := http.NewRequest("GET", c.base+"/img?url=/uploads/photo.webp&w=40&h=40&fit=cover", nil)
+		req.Header.Set("If-None-Match", tt.ifNoneMatch)
+		resp, body := c.do(req)
+		if resp.StatusCode != tt.status {
+			t.Errorf("If-None-Match %s: status %d, want %d", tt.ifNoneMatch, resp.StatusCode, tt.status)
+		}
+		if tt.status == http.StatusNotModified && body != "" {
+			t.Errorf("304 with a %d byte body", len(body))
+		}
+	}
+}
@@ -1,50 +1,195 @@
 package srv
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
-var proxyClient = &http.Client{Timeout: 10 * time.Second}
+// errImageNotFound is a source image the CDN or uploads didn't have.
+var errImageNotFound = errors.New("image not found")
 
-func handleImageProxy(w http.ResponseWriter, r *http.Request) {
-	rawURL := r.URL.Query().Get("url")
-	if rawURL == "" {
+// handleImageProxy serves a product image from one of the platforms' CDNs,
+// or an upload, through the image cache. Optional parameters resize it:
+//
+//	w, h  largest width and height, rounded up to a multiple of 20
+//	fit   contain (the default) to fit inside w×h, or cover to fill it,
+//	      cropping the overflow
+//
+// Resized images are WebP for browsers that accept it.
+func (s *Server) handleImageProxy(w http.ResponseWriter, r *http.Request) {
+	src := r.URL.Query().Get("url")
+	if src == "" {
 		http.Error(w, "missing url", 400)
 		return
 	}
-	// Only proxy known CDN domains
-	allowed := false
-	for _, d := range []string{"images.meesho.com", "m.media-amazon.com", "rukminim", "img.fkcdn"} {
-		if strings.Contains(rawURL, d) {
-			allowed = true
-			break
-		}
+	v, err := parseImageVariant(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
 	}
-	if !allowed {
-		http.Error(w, "domain not allowed", 403)
+	if v == (imageVariant{}) && strings.HasPrefix(src, "/uploads/") {
+		http.Redirect(w, r, src, http.StatusFound)
 		return
 	}
 
-	req, err := http.NewRequest("GET", rawURL, nil)
-	if err != nil {
-		http.Error(w, err.Error(), 400)
+	// The file can be evicted between finding and opening it; the second
+	// try makes it again.
+	for range 2 {
+		img, err := s.cachedImage(r.Context(), src, v)
+		switch {
+		case errors.Is(err, errFetchBlocked):
+			http.Error(w, err.Error(), 403)
+			return
+		case errors.Is(err, errImageNotFound):
+			http.Error(w, err.Error(), 404)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), 502)
+			return
+		}
+		f, err := os.Open(img.path)
+		if err != nil {
+			s.images.forget(img)
+			continue
+		}
+		defer f.Close()
+		if v != (imageVariant{}) {
+			w.Header().Set("Vary", "Accept")
+		}
+		w.Header().Set("Content-Type", img.contentType)
+		w.Header().Set("ETag", img.etag)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "public, max-age=604800")
+		http.ServeContent(w, r, "", time.Time{}, f)
 		return
 	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-	req.Header.Set("Referer", "https://www.meesho.com/")
-	req.Header.Set("Accept", "image/*,*/*")
+	http.Error(w, "image cache unavailable", 503)
+}
 
-	resp, err := proxyClient.Do(req)
+// parseImageVariant reads the w, h and fit parameters, and whether the
+// browser takes WebP.
+func parseImageVariant(r *http.Request) (imageVariant, error) {
+	var v imageVariant
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"w", &v.W}, {"h", &v.H}} {
+		s := r.URL.Query().Get(p.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return v, fmt.Errorf("invalid %s", p.name)
+		}
+		// Rounding keeps the number of sizes cached per image small.
+		*p.dst = min((n+thumbStep-1)/thumbStep*thumbStep, maxThumbSide)
+	}
+	switch fit := r.URL.Query().Get("fit"); fit {
+	case "", fitContain:
+		if v.W > 0 || v.H > 0 {
+			v.Fit = fitContain
+		}
+	case fitCover:
+		if v.W == 0 || v.H == 0 {
+			return v, errors.New("fit=cover needs both w and h")
+		}
+		v.Fit = fitCover
+	default:
+		return v, fmt.Errorf("invalid fit %q: want contain or cover", fit)
+	}
+	if v != (imageVariant{}) && strings.Contains(r.Header.Get("Accept"), "image/webp") {
+		v.Format = formatWebP
+	}
+	return v, nil
+}
+
+// cachedImage returns a size of the image at src from the cache, fetching
+// or resizing it first if needed.
+func (s *Server) cachedImage(ctx context.Context, src string, v imageVariant) (*cachedImage, error) {
+	return s.images.get(ctx, imageKey(src, v), func(ctx context.Context) ([]byte, string, error) {
+		var data []byte
+		var contentType string
+		if v == (imageVariant{}) {
+			return fetchImage(ctx, src)
+		}
+		if strings.HasPrefix(src, "/uploads/") {
+			var err error
+			data, contentType, err = s.readUpload(src)
+			if err != nil {
+				return nil, "", err
+			}
+		} else {
+			orig, err := s.cachedImage(ctx, src, imageVariant{})
+			if err != nil {
+				return nil, "", err
+			}
+			if data, err = os.ReadFile(orig.path); err != nil {
+				return nil, "", err
+			}
+			contentType = orig.contentType
+		}
+		out, outType, ok, err := resizeImage(data, v, s.maxDecodePixels())
+		if err != nil {
+			slog.Warn("resize image", "url", src, "error", err)
+		}
+		if !ok {
+			// Served as it is, but under this size's key so the next
+			// request doesn't try again.
+			return data, contentType, nil
+		}
+		return out, outType, nil
+	})
+}
+
+// fetchImage downloads an image from a CDN.
+func fetchImage(ctx context.Context, src string) ([]byte, string, error) {
+	resp, err := imageFetcher.get(ctx, src, http.Header{
+		"User-Agent": {"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36"},
+		"Referer":    {"https://www.meesho.com/"},
+		"Accept":     {"image/*,*/*"},
+	})
 	if err != nil {
-		http.Error(w, err.Error(), 502)
-		return
+		return nil, "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, "", errImageNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s returned %d %s", resp.Request.URL.Host, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	contentType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	return data, strings.TrimSpace(contentType), nil
+}
 
-	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
-	w.Header().Set("Cache-Control", "public, max-age=86400")
-	io.Copy(w, resp.Body)
+// readUpload reads an uploaded image by its /uploads/ path.
+func (s *Server) readUpload(src string) ([]byte, string, error) {
+	name := path.Clean(strings.TrimPrefix(src, "/uploads/"))
+	if name == "." || strings.HasPrefix(name, "..") || strings.HasPrefix(name, "cache/") {
+		return nil, "", errImageNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(s.UploadsDir, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, "", errImageNotFound
+	}
+	contentType := http.DetectContentType(data)
+	if _, ok := imageExts[contentType]; !ok {
+		return nil, "", fmt.Errorf("%w: content type %s", errFetchBlocked, contentType)
+	}
+	return data, contentType, nil
 }
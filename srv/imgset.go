@@ -0,0 +1,212 @@
+package srv
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// Product images in listings are <img> tags with a srcset of sizes from
+// /img, so phones download a copy about the size they show, and a blurred
+// placeholder a few hundred bytes long as their background until it
+// arrives. Placeholders are made in the background the first time an
+// image is shown, and kept in the database.
+
+// imageLayout is a place images are shown: the square sizes offered for
+// it, the one for browsers without srcset, and its CSS width.
+type imageLayout struct {
+	widths []int
+	src    int
+	sizes  string
+}
+
+// imageLayouts are the layouts for the "imgSet" template function, by name.
+var imageLayouts = map[string]imageLayout{
+	// Product cards, four to a row, two on phones.
+	"card": {[]int{160, 240, 320, 400, 480, 640}, 400, "(max-width: 900px) 50vw, 300px"},
+	// The product in a home page hero slide.
+	"slide": {[]int{160, 220, 320, 440}, 440, "(max-width: 600px) 160px, (max-width: 900px) 180px, 220px"},
+	// Gallery thumbnails on product pages.
+	"thumb": {[]int{60, 80, 120, 160}, 160, "72px"},
+}
+
+// placeholderSide is the width and height of placeholders, in pixels.
+const placeholderSide = 16
+
+// placeholders holds the placeholder of each image URL, an empty string
+// for images that have none (transparent ones, which would show it
+// through).
+type placeholders struct {
+	mu      sync.Mutex
+	data    map[string]string
+	pending map[string]bool // queued, or failed since the server started
+	queue   chan string
+}
+
+func newPlaceholders() *placeholders {
+	return &placeholders{data: map[string]string{}, pending: map[string]bool{}}
+}
+
+// get returns the placeholder for an image, queuing it to be made if it
+// hasn't been. Nothing is queued before start.
+func (p *placeholders) get(src string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if data, ok := p.data[src]; ok {
+		return data
+	}
+	if p.queue != nil && !p.pending[src] {
+		select {
+		case p.queue <- src:
+			p.pending[src] = true
+		default:
+			// Busy; a later page view asks again.
+		}
+	}
+	return ""
+}
+
+// startPlaceholders loads the saved placeholders and starts making the
+// missing ones.
+func (s *Server) startPlaceholders() {
+	rows, err := dbgen.New(s.DB).ListImagePlaceholders(context.Background())
+	if err != nil {
+		slog.Error("load image placeholders", "error", err)
+	}
+	p := s.placeholders
+	p.mu.Lock()
+	for _, row := range rows {
+		p.data[row.Url] = row.Data
+	}
+	p.queue = make(chan string, 256)
+	p.mu.Unlock()
+	go s.placeholderWorker()
+}
+
+func (s *Server) placeholderWorker() {
+	q := dbgen.New(s.DB)
+	for src := range s.placeholders.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		data, err := s.makePlaceholder(ctx, src)
+		cancel()
+		if err != nil {
+			// Left pending, so it isn't tried again until a restart.
+			slog.Warn("make image placeholder", "url", src, "error", err)
+			continue
+		}
+		if err := q.UpsertImagePlaceholder(context.Background(), dbgen.UpsertImagePlaceholderParams{Url: src, Data: data}); err != nil {
+			slog.Error("save image placeholder", "url", src, "error", err)
+		}
+		s.placeholders.mu.Lock()
+		s.placeholders.data[src] = data
+		delete(s.placeholders.pending, src)
+		s.placeholders.mu.Unlock()
+	}
+}
+
+// makePlaceholder shrinks the image at src to a blurred square WebP data
+// URL, or "" if it has transparency.
+func (s *Server) makePlaceholder(ctx context.Context, src string) (string, error) {
+	// The smallest card size, which the page showing it has likely
+	// asked for already.
+	img, err := s.cachedImage(ctx, src, imageVariant{W: 160, H: 160, Fit: fitCover})
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(img.path)
+	if err != nil {
+		return "", err
+	}
+	// Images too big to resize are cached as they are.
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	if cfg.Width*cfg.Height > s.maxDecodePixels() {
+		return "", fmt.Errorf("%d×%d image is too big to decode", cfg.Width, cfg.Height)
+	}
+	decodeSlot <- struct{}{}
+	defer func() { <-decodeSlot }()
+	m, _, err := decodeImage(data)
+	if err != nil {
+		return "", err
+	}
+	b := m.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(b.Min).Add(image.Pt((b.Dx()-side)/2, (b.Dy()-side)/2))
+	small := image.NewRGBA(image.Rect(0, 0, placeholderSide, placeholderSide))
+	draw.BiLinear.Scale(small, small.Bounds(), m, crop, draw.Src, nil)
+	if !small.Opaque() {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := encodeWebP(&buf, boxBlur(small), 50); err != nil {
+		return "", err
+	}
+	return "data:image/webp;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// boxBlur averages each pixel of an opaque image with its neighbours.
+func boxBlur(m *image.RGBA) *image.RGBA {
+	b := m.Bounds()
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var r, g, bl, n int
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					p := image.Pt(x+dx, y+dy)
+					if !p.In(b) {
+						continue
+					}
+					c := m.RGBAAt(p.X, p.Y)
+					r, g, bl, n = r+int(c.R), g+int(c.G), bl+int(c.B), n+1
+				}
+			}
+			out.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255})
+		}
+	}
+	return out
+}
+
+// imgSet is the "imgSet" template function. It returns the src, srcset
+// and sizes attributes of an <img> showing the image at u in a layout,
+// with its placeholder as the background.
+func (s *Server) imgSet(u, layout string) (template.HTMLAttr, error) {
+	l, ok := imageLayouts[layout]
+	if !ok {
+		return "", fmt.Errorf("no image layout %q", layout)
+	}
+	if u == "" || strings.HasPrefix(u, "/static/") {
+		return template.HTMLAttr(`src="` + template.HTMLEscapeString(u) + `"`), nil
+	}
+	sized := func(w int) string {
+		return fmt.Sprintf("/img?url=%s&w=%d&h=%d&fit=cover", url.QueryEscape(u), w, w)
+	}
+	srcset := make([]string, len(l.widths))
+	for i, w := range l.widths {
+		srcset[i] = fmt.Sprintf("%s %dw", sized(w), w)
+	}
+	attrs := fmt.Sprintf(`src="%s" srcset="%s" sizes="%s"`,
+		template.HTMLEscapeString(sized(l.src)),
+		template.HTMLEscapeString(strings.Join(srcset, ", ")),
+		template.HTMLEscapeString(l.sizes))
+	if p := s.placeholders.get(u); p != "" {
+		attrs += fmt.Sprintf(` style="background:url(%s) center/cover"`, template.HTMLEscapeString(p))
+	}
+	return template.HTMLAttr(attrs), nil
+}
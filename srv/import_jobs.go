@@ -0,0 +1,594 @@
+package srv
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// Imports are jobs in the import_jobs table. Handlers queue them and a
+// pool of ImportWorkers workers takes them oldest first, so several can
+// run at once, they survive restarts, and each keeps its own progress and
+// a row per product in import_job_items.
+//
+// A preview job only stages its products: each item keeps the product row
+// it would write, and the job waits in state review until an admin
+// accepts, edits or rejects each one and commits them together.
+
+// Import job kinds.
+const (
+	importKindStore = "store" // walk a Meesho store listing
+	importKindJSON  = "json"  // products pasted as JSON
+)
+
+// Import job states.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobReview    = "review" // a preview waiting to be committed
+	jobDone      = "done"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// importFailed is the outcome recorded for a product that couldn't be
+// imported, alongside importCreated, importUpdated and importUnchanged.
+const importFailed = "failed"
+
+// Decisions on a previewed item.
+const (
+	decisionPending  = "pending"
+	decisionAccepted = "accepted"
+	decisionRejected = "rejected"
+)
+
+// importQueue wakes idle workers and cancels running jobs.
+type importQueue struct {
+	wake chan struct{}
+
+	mu      sync.Mutex
+	cancels map[int64]context.CancelFunc // by job ID, while running
+}
+
+func newImportQueue() *importQueue {
+	return &importQueue{wake: make(chan struct{}, 1), cancels: map[int64]context.CancelFunc{}}
+}
+
+// signal wakes one idle worker, if any, to look for a queued job.
+func (iq *importQueue) signal() {
+	select {
+	case iq.wake <- struct{}{}:
+	default:
+	}
+}
+
+// cancel stops a running job, reporting whether it was running here.
+func (iq *importQueue) cancel(id int64) bool {
+	iq.mu.Lock()
+	defer iq.mu.Unlock()
+	cancel, ok := iq.cancels[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// startImportWorkers requeues jobs a restart interrupted and starts the
+// worker pool.
+func (s *Server) startImportWorkers() {
+	if err := dbgen.New(s.DB).RequeueRunningImportJobs(context.Background()); err != nil {
+		slog.Error("requeue interrupted imports", "error", err)
+	}
+	for range max(s.ImportWorkers, 1) {
+		go s.importWorker()
+	}
+	s.imports.signal()
+}
+
+func (s *Server) importWorker() {
+	q := dbgen.New(s.DB)
+	for {
+		job, err := q.ClaimImportJob(context.Background())
+		if errors.Is(err, sql.ErrNoRows) {
+			<-s.imports.wake
+			continue
+		}
+		if err != nil {
+			slog.Error("claim import job", "error", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		// There may be more queued jobs for another idle worker.
+		s.imports.signal()
+		s.runImportJob(job)
+	}
+}
+
+// enqueueImport queues a job and wakes a worker for it.
+func (s *Server) enqueueImport(ctx context.Context, actor auditActor, kind, storeURL, payload string, preview bool) (dbgen.ImportJob, error) {
+	params := dbgen.InsertImportJobParams{
+		Kind:     kind,
+		StoreUrl: storeURL,
+		Payload:  payload,
+		UserID:   actor.UserID,
+		Actor:    actor.Name,
+		Ip:       actor.IP,
+	}
+	if preview {
+		params.Preview = 1
+	}
+	job, err := dbgen.New(s.DB).InsertImportJob(ctx, params)
+	if err != nil {
+		return job, err
+	}
+	s.imports.signal()
+	return job, nil
+}
+
+// runImportJob works on a claimed job until it finishes, fails or is
+// cancelled.
+func (s *Server) runImportJob(job dbgen.ImportJob) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.imports.mu.Lock()
+	s.imports.cancels[job.ID] = cancel
+	s.imports.mu.Unlock()
+	defer func() {
+		s.imports.mu.Lock()
+		delete(s.imports.cancels, job.ID)
+		s.imports.mu.Unlock()
+		cancel()
+	}()
+
+	run := &importRun{
+		s:     s,
+		q:     dbgen.New(s.DB),
+		job:   job,
+		actor: auditActor{UserID: job.UserID, Name: job.Actor, IP: job.Ip},
+	}
+	slog.Info("import started", "job", job.ID, "kind", job.Kind, "store", job.StoreUrl)
+	var err error
+	switch job.Kind {
+	case importKindStore:
+		err = s.runStoreImport(ctx, run)
+	case importKindJSON:
+		err = run.runJSON(ctx)
+	default:
+		err = fmt.Errorf("unknown import kind %q", job.Kind)
+	}
+
+	state, message := jobDone, fmt.Sprintf("Done! Imported %d new, updated %d, %d already up to date, failed %d",
+		run.job.Imported, run.job.Updated, run.job.Skipped, run.job.Failed)
+	switch {
+	case ctx.Err() != nil:
+		state, message = jobCancelled, fmt.Sprintf("Cancelled after %d products", run.job.Seen)
+	case err != nil:
+		state, message = jobFailed, err.Error()
+	case job.Preview != 0:
+		state, message = jobReview, fmt.Sprintf("Ready to review: %d new, %d changed, %d already up to date, failed %d",
+			run.job.Imported, run.job.Updated, run.job.Skipped, run.job.Failed)
+	}
+	if err := run.q.FinishImportJob(context.Background(), dbgen.FinishImportJobParams{State: state, Message: message, ID: job.ID}); err != nil {
+		slog.Error("save import progress", "job", job.ID, "error", err)
+	}
+	slog.Info("import finished", "job", job.ID, "state", state, "message", message)
+}
+
+// importRun is a job being worked on, with its counts kept up to date in
+// job and saved as they change.
+type importRun struct {
+	s     *Server
+	q     *dbgen.Queries
+	job   dbgen.ImportJob
+	actor auditActor
+}
+
+// importItem imports one product, or stages it in a preview, and
+// records what became of it. A product is imported whole even if the job
+// is cancelled halfway.
+func (r *importRun) importItem(ctx context.Context, params dbgen.InsertProductParams) {
+	item := dbgen.InsertImportJobItemParams{
+		JobID:    r.job.ID,
+		SourceID: params.SourceID,
+		Title:    params.Title,
+		Url:      params.Url,
+	}
+	var outcome string
+	var productID int64
+	var err error
+	if r.job.Preview != 0 {
+		outcome, productID, _, err = previewImport(ctx, r.q, params)
+		b, _ := json.Marshal(params)
+		item.Params, item.Decision = string(b), decisionPending
+	} else {
+		outcome, productID, err = r.s.importProduct(context.WithoutCancel(ctx), r.actor, params)
+	}
+	item.Outcome = outcome
+	if productID != 0 {
+		item.ProductID = &productID
+	}
+	r.job.Seen++
+	switch {
+	case err != nil:
+		r.job.Failed++
+		item.Outcome, item.Error = importFailed, fmt.Sprintf("%s: %s", params.Title, err.Error())
+	case outcome == importCreated:
+		r.job.Imported++
+	case outcome == importUpdated:
+		r.job.Updated++
+	default:
+		r.job.Skipped++
+	}
+	if err := r.q.InsertImportJobItem(context.Background(), item); err != nil {
+		slog.Error("save import item", "job", r.job.ID, "error", err)
+	}
+	r.save(r.job.Message)
+}
+
+// save stores the job's counts and a new status message.
+func (r *importRun) save(message string) {
+	r.job.Message = message
+	err := r.q.UpdateImportJobProgress(context.Background(), dbgen.UpdateImportJobProgressParams{
+		NextPage: r.job.NextPage,
+		Total:    r.job.Total,
+		Seen:     r.job.Seen,
+		Imported: r.job.Imported,
+		Updated:  r.job.Updated,
+		Skipped:  r.job.Skipped,
+		Failed:   r.job.Failed,
+		Message:  message,
+		ID:       r.job.ID,
+	})
+	if err != nil {
+		slog.Error("save import progress", "job", r.job.ID, "error", err)
+	}
+}
+
+// setMessage updates the status message alone, such as while waiting.
+func (r *importRun) setMessage(message string) {
+	r.job.Message = message
+	if err := r.q.SetImportJobMessage(context.Background(), dbgen.SetImportJobMessageParams{Message: message, ID: r.job.ID}); err != nil {
+		slog.Error("save import progress", "job", r.job.ID, "error", err)
+	}
+}
+
+// runJSON imports pasted products, carrying on after the ones already
+// done if the job is resumed.
+func (r *importRun) runJSON(ctx context.Context) error {
+	var products []MeeshoProduct
+	if err := json.Unmarshal([]byte(r.job.Payload), &products); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	r.job.Total = int64(len(products))
+	for _, mp := range products[min(r.job.Seen, r.job.Total):] {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		r.job.Message = fmt.Sprintf("Processing %d/%d: %s", r.job.Seen+1, r.job.Total, mp.Name)
+		r.importItem(ctx, meeshoProductParams(mp))
+	}
+	return nil
+}
+
+// importJobStatus is a job as the admin panel polls it.
+type importJobStatus struct {
+	dbgen.ImportJob
+	Running bool     `json:"running"` // queued or running
+	Errors  []string `json:"errors"`
+}
+
+func (s *Server) importJobStatus(ctx context.Context, job dbgen.ImportJob) importJobStatus {
+	st := importJobStatus{ImportJob: job, Running: job.State == jobQueued || job.State == jobRunning}
+	st.Payload = ""
+	st.Errors, _ = dbgen.New(s.DB).ListImportJobErrors(ctx, dbgen.ListImportJobErrorsParams{JobID: job.ID, Limit: 20})
+	if job.State == jobFailed {
+		st.Errors = append([]string{job.Message}, st.Errors...)
+	}
+	return st
+}
+
+// handleBulkImportStatus returns the status of import ?id=, or of the
+// latest import.
+func (s *Server) handleBulkImportStatus(w http.ResponseWriter, r *http.Request) {
+	q := dbgen.New(s.DB)
+	var job dbgen.ImportJob
+	var err error
+	if v := r.URL.Query().Get("id"); v != "" {
+		id, perr := strconv.ParseInt(v, 10, 64)
+		if perr != nil {
+			jsonError(w, "Invalid ID", 400)
+			return
+		}
+		job, err = q.GetImportJob(r.Context(), id)
+	} else {
+		job, err = q.GetLatestImportJob(r.Context())
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonError(w, "No such import", 404)
+		return
+	}
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.importJobStatus(r.Context(), job))
+}
+
+func (s *Server) handleImportJobCancel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid ID", 400)
+		return
+	}
+	// A running job finishes as cancelled once its current product is
+	// done.
+	if !s.imports.cancel(id) {
+		n, err := dbgen.New(s.DB).CancelWaitingImportJob(r.Context(), id)
+		if err != nil {
+			jsonError(w, err.Error(), 500)
+			return
+		}
+		if n == 0 {
+			jsonError(w, "This import isn't queued, running or waiting for review", 409)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true})
+}
+
+func (s *Server) handleImportJobRetry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid ID", 400)
+		return
+	}
+	n, err := dbgen.New(s.DB).RetryImportJob(r.Context(), id)
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	if n == 0 {
+		jsonError(w, "Only failed or cancelled imports can be retried", 409)
+		return
+	}
+	s.imports.signal()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true})
+}
+
+// handleImportJobs lists recent imports, and the products one of them
+// looked at with ?job=.
+func (s *Server) handleImportJobs(w http.ResponseWriter, r *http.Request) {
+	q := dbgen.New(s.DB)
+	jobs, err := q.ListImportJobs(r.Context(), 50)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	active := false
+	for _, j := range jobs {
+		active = active || j.State == jobQueued || j.State == jobRunning
+	}
+	data := map[string]any{
+		"Nav":            "imports",
+		"CSRFToken":      s.csrfToken(w, r),
+		"CanEditCatalog": true,
+		"SignedIn":       adminUser(r.Context()) != nil,
+		"Jobs":           jobs,
+		"Active":         active,
+	}
+	if id, err := strconv.ParseInt(r.URL.Query().Get("job"), 10, 64); err == nil {
+		job, err := q.GetImportJob(r.Context(), id)
+		if err != nil {
+			http.Error(w, "Import not found", 404)
+			return
+		}
+		items, _ := q.ListImportJobItems(r.Context(), id)
+		data["Job"], data["Items"] = job, items
+	}
+	s.templates.render(w, "imports.html", data)
+}
+
+// previewItem is a staged product as the review table shows it.
+type previewItem struct {
+	ID        int64         `json:"id"`
+	Title     string        `json:"title"`
+	URL       string        `json:"url"`
+	ImageURL  string        `json:"image_url"`
+	Price     Money         `json:"price"`
+	Category  string        `json:"category"` // proposed for a new product
+	Outcome   string        `json:"outcome"`  // what committing would do now
+	ProductID int64         `json:"product_id,omitempty"`
+	Changes   []auditChange `json:"changes,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Decision  string        `json:"decision"`
+}
+
+// handleImportJobItems returns a preview's staged products, compared with
+// the catalogue as it is now rather than when they were staged.
+func (s *Server) handleImportJobItems(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid ID", 400)
+		return
+	}
+	q := dbgen.New(s.DB)
+	job, err := q.GetImportJob(r.Context(), id)
+	if err != nil {
+		jsonError(w, "Import not found", 404)
+		return
+	}
+	if job.Preview == 0 {
+		jsonError(w, "This import wasn't a preview", 400)
+		return
+	}
+	items, err := q.ListImportJobItems(r.Context(), id)
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	out := make([]previewItem, 0, len(items))
+	for _, it := range items {
+		v := previewItem{ID: it.ID, Title: it.Title, URL: it.Url, Outcome: it.Outcome, Error: it.Error, Decision: it.Decision}
+		var params dbgen.InsertProductParams
+		if json.Unmarshal([]byte(it.Params), &params) == nil {
+			v.ImageURL, v.Price, v.Category = params.ImageUrl, Money(params.PricePaise), params.Category
+			if job.State == jobReview && it.Error == "" {
+				var diff string
+				v.Outcome, v.ProductID, diff, err = previewImport(r.Context(), q, params)
+				if err != nil {
+					v.Outcome, v.Error = importFailed, err.Error()
+				}
+				v.Changes = auditChanges(diff)
+			}
+		}
+		if v.ProductID == 0 && it.ProductID != nil {
+			v.ProductID = *it.ProductID
+		}
+		out = append(out, v)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "job": s.importJobStatus(r.Context(), job), "items": out})
+}
+
+// reviewDecision is the admin's decision on one staged product, with any
+// edits to it.
+type reviewDecision struct {
+	ID       int64  `json:"id"`
+	Decision string `json:"decision"` // accepted or rejected
+	Title    string `json:"title"`
+	Category string `json:"category"`
+	Price    string `json:"price"`
+}
+
+// handleImportJobCommit imports a preview's accepted products, with the
+// admin's edits, in one transaction: if any fails, none are imported.
+// Items without a decision are rejected.
+func (s *Server) handleImportJobCommit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid ID", 400)
+		return
+	}
+	var req struct {
+		Items []reviewDecision `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid JSON: "+err.Error(), 400)
+		return
+	}
+	decisions := map[int64]reviewDecision{}
+	for _, d := range req.Items {
+		decisions[d.ID] = d
+	}
+
+	tx, err := s.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		jsonError(w, "Failed to import: "+err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	q := dbgen.New(tx)
+	job, err := q.GetImportJob(r.Context(), id)
+	if err != nil {
+		jsonError(w, "Import not found", 404)
+		return
+	}
+	if job.State != jobReview {
+		jsonError(w, "This import isn't waiting for review", 409)
+		return
+	}
+	items, err := q.ListImportJobItems(r.Context(), id)
+	if err != nil {
+		jsonError(w, "Failed to import: "+err.Error(), 500)
+		return
+	}
+
+	actor := s.auditActor(r)
+	var imported, updated, skipped, rejected int64
+	for _, it := range items {
+		d, ok := decisions[it.ID]
+		upd := dbgen.UpdateImportJobItemParams{
+			Title:     it.Title,
+			Outcome:   it.Outcome,
+			ProductID: it.ProductID,
+			Error:     it.Error,
+			Params:    it.Params,
+			Decision:  decisionRejected,
+			ID:        it.ID,
+		}
+		if ok && d.Decision == decisionAccepted && it.Error == "" {
+			var params dbgen.InsertProductParams
+			if err := json.Unmarshal([]byte(it.Params), &params); err != nil {
+				jsonError(w, fmt.Sprintf("%s: corrupt staged product: %s", it.Title, err.Error()), 500)
+				return
+			}
+			if d.Title != "" {
+				params.Title = d.Title
+			}
+			if d.Category != "" {
+				params.Category = d.Category
+			}
+			if d.Price != "" {
+				price, err := ParseMoney(d.Price)
+				if err != nil || price <= 0 {
+					jsonError(w, fmt.Sprintf("%s: invalid price %q", params.Title, d.Price), 400)
+					return
+				}
+				params.PricePaise = price.Paise()
+				if params.OriginalPricePaise <= params.PricePaise {
+					params.OriginalPricePaise = 0
+				}
+			}
+			outcome, productID, err := importProductTx(r.Context(), q, actor, params)
+			if err != nil {
+				jsonError(w, fmt.Sprintf("%s: %s. Nothing was imported.", params.Title, err.Error()), 400)
+				return
+			}
+			b, _ := json.Marshal(params)
+			upd.Title, upd.Outcome, upd.ProductID, upd.Params, upd.Decision = params.Title, outcome, &productID, string(b), decisionAccepted
+			switch outcome {
+			case importCreated:
+				imported++
+			case importUpdated:
+				updated++
+			default:
+				skipped++
+			}
+		} else {
+			rejected++
+		}
+		if err := q.UpdateImportJobItem(r.Context(), upd); err != nil {
+			jsonError(w, "Failed to import: "+err.Error(), 500)
+			return
+		}
+	}
+	message := fmt.Sprintf("Done! Imported %d new, updated %d, %d already up to date, rejected %d", imported, updated, skipped, rejected)
+	err = q.FinishImportReview(r.Context(), dbgen.FinishImportReviewParams{
+		Imported: imported,
+		Updated:  updated,
+		Skipped:  skipped,
+		Failed:   job.Failed,
+		Message:  message,
+		ID:       id,
+	})
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		jsonError(w, "Failed to import: "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "message": message, "imported": imported, "updated": updated, "skipped": skipped, "rejected": rejected})
+}
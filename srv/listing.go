@@ -0,0 +1,345 @@
+package srv
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// listPerPage is the number of products per page on category and search pages.
+const listPerPage = 24
+
+// listingFilter holds the facet, sort and page parameters shared by the
+// category and search pages. It round-trips through the URL query string, so
+// any filtered view can be bookmarked or shared:
+//
+//	/category/Nails%20%26%20Beauty?platform=Meesho&max_price=500&rating=4&sort=price-asc
+type listingFilter struct {
+	Query       string // search text, search page only
+	MinPrice    Money
+	MaxPrice    Money
+	MinRating   float64
+	Platform    string
+	MinDiscount int64
+	New         bool
+	Bestseller  bool
+	Sort        string
+	Page        int
+}
+
+func parseListingFilter(v url.Values) listingFilter {
+	f := listingFilter{
+		Query:    v.Get("q"),
+		Platform: v.Get("platform"),
+		Sort:     v.Get("sort"),
+	}
+	f.MinPrice, _ = ParseMoney(v.Get("min_price"))
+	f.MaxPrice, _ = ParseMoney(v.Get("max_price"))
+	f.MinRating, _ = strconv.ParseFloat(v.Get("rating"), 64)
+	f.MinDiscount, _ = strconv.ParseInt(v.Get("discount"), 10, 64)
+	f.New = v.Get("new") == "1"
+	f.Bestseller = v.Get("bestseller") == "1"
+	f.Page, _ = strconv.Atoi(v.Get("page"))
+	f.Page = max(f.Page, 1)
+	return f
+}
+
+func (f listingFilter) values() url.Values {
+	v := url.Values{}
+	set := func(k, val string) {
+		if val != "" && val != "0" {
+			v.Set(k, val)
+		}
+	}
+	set("q", f.Query)
+	set("min_price", f.MinPrice.Plain())
+	set("max_price", f.MaxPrice.Plain())
+	set("rating", strconv.FormatFloat(f.MinRating, 'f', -1, 64))
+	set("platform", f.Platform)
+	set("discount", strconv.FormatInt(f.MinDiscount, 10))
+	if f.New {
+		v.Set("new", "1")
+	}
+	if f.Bestseller {
+		v.Set("bestseller", "1")
+	}
+	set("sort", f.Sort)
+	if f.Page > 1 {
+		v.Set("page", strconv.Itoa(f.Page))
+	}
+	return v
+}
+
+// URL returns the query string ("?..." or a bare "?") for this filter with the given
+// key/value pairs changed; an empty value removes the key. Changing anything
+// other than the page goes back to page 1. Templates use it for every facet,
+// sort and pager link: {{.Filter.URL "platform" "Meesho"}}.
+func (f listingFilter) URL(kv ...string) string {
+	v := f.values()
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i] != "page" {
+			v.Del("page")
+		}
+		if kv[i+1] == "" {
+			v.Del(kv[i])
+		} else {
+			v.Set(kv[i], kv[i+1])
+		}
+	}
+	if len(v) == 0 {
+		return "?"
+	}
+	return "?" + v.Encode()
+}
+
+// Hidden returns the current parameters except the given keys and the page,
+// for hidden inputs in GET forms such as the custom price range.
+func (f listingFilter) Hidden(exclude ...string) map[string]string {
+	m := map[string]string{}
+	for k, vs := range f.values() {
+		if k != "page" && !slices.Contains(exclude, k) {
+			m[k] = vs[0]
+		}
+	}
+	return m
+}
+
+// Active reports whether any facet (not sort or page) is applied.
+func (f listingFilter) Active() bool {
+	return f.MinPrice != 0 || f.MaxPrice != 0 || f.MinRating != 0 || f.Platform != "" ||
+		f.MinDiscount != 0 || f.New || f.Bestseller
+}
+
+func (f listingFilter) offset() int64 {
+	return int64(f.Page-1) * listPerPage
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// facetCounts maps facet name to option value to product count, as returned
+// by CategoryFacetCounts and SearchFacetCounts.
+type facetCounts map[string]map[string]int64
+
+func (c facetCounts) add(facet, value string, n int64) {
+	if c[facet] == nil {
+		c[facet] = map[string]int64{}
+	}
+	c[facet][value] = n
+}
+
+type facetOption struct {
+	Label  string
+	URL    string
+	Count  int64
+	Active bool
+}
+
+type facetGroup struct {
+	Title   string
+	Options []facetOption
+}
+
+// priceBuckets mirror the CASE in the facet count queries. The price
+// filters include both ends, so each bucket stops a paisa short of the next
+// one's start, as the CASE does, and every product is listed under exactly
+// the bucket it is counted in. Unpriced products are in none, so the first
+// bucket starts at a paisa.
+var priceBuckets = []struct{ value, label, min, max string }{
+	{"0-200", "Under ₹200", "0.01", "199.99"},
+	{"200-500", "₹200 – ₹500", "200", "499.99"},
+	{"500-1000", "₹500 – ₹1,000", "500", "999.99"},
+	{"1000-", "₹1,000 & over", "1000", ""},
+}
+
+// facets builds the sidebar groups. Clicking an active option clears it.
+// Options with no matching products are left out unless active.
+func (f listingFilter) facets(counts facetCounts) []facetGroup {
+	cur := f.values()
+	var groups []facetGroup
+
+	price := facetGroup{Title: "Price"}
+	for _, b := range priceBuckets {
+		active := cur.Get("min_price") == b.min && cur.Get("max_price") == b.max
+		o := facetOption{Label: b.label, Count: counts["price"][b.value], Active: active}
+		if active {
+			o.URL = f.URL("min_price", "", "max_price", "")
+		} else {
+			o.URL = f.URL("min_price", b.min, "max_price", b.max)
+		}
+		price.Options = append(price.Options, o)
+	}
+	groups = append(groups, price)
+
+	platforms := facetGroup{Title: "Platform"}
+	names := make([]string, 0, len(counts["platform"]))
+	for name := range counts["platform"] {
+		names = append(names, name)
+	}
+	if f.Platform != "" && !slices.Contains(names, f.Platform) {
+		names = append(names, f.Platform)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		platforms.Options = append(platforms.Options, f.option(name, "platform", name, f.Platform == name, counts))
+	}
+	groups = append(groups, platforms)
+
+	rating := facetGroup{Title: "Rating"}
+	for _, r := range []string{"4", "3"} {
+		rating.Options = append(rating.Options, f.option(r+"★ & up", "rating", r, cur.Get("rating") == r, counts))
+	}
+	groups = append(groups, rating)
+
+	discount := facetGroup{Title: "Discount"}
+	for _, d := range []string{"50", "25", "10"} {
+		discount.Options = append(discount.Options, f.option(d+"% or more", "discount", d, cur.Get("discount") == d, counts))
+	}
+	groups = append(groups, discount)
+
+	groups = append(groups, facetGroup{Title: "Collections", Options: []facetOption{
+		f.option("✨ New Arrivals", "new", "1", f.New, counts),
+		f.option("🔥 Best Sellers", "bestseller", "1", f.Bestseller, counts),
+	}})
+
+	for i := range groups {
+		groups[i].Options = slices.DeleteFunc(groups[i].Options, func(o facetOption) bool {
+			return o.Count == 0 && !o.Active
+		})
+	}
+	return slices.DeleteFunc(groups, func(g facetGroup) bool { return len(g.Options) == 0 })
+}
+
+func (f listingFilter) option(label, key, value string, active bool, counts facetCounts) facetOption {
+	o := facetOption{Label: label, Count: counts[key][value], Active: active}
+	if active {
+		o.URL = f.URL(key, "")
+	} else {
+		o.URL = f.URL(key, value)
+	}
+	return o
+}
+
+// listCategory runs the filtered, sorted and paged category listing along
+// with its total and facet counts.
+func (s *Server) listCategory(ctx context.Context, category string, f listingFilter) ([]dbgen.Product, int64, facetCounts, error) {
+	q := dbgen.New(s.DB)
+	products, err := q.ListCategoryProducts(ctx, dbgen.ListCategoryProductsParams{
+		Category:     category,
+		MinPrice:     f.MinPrice.Paise(),
+		MaxPrice:     f.MaxPrice.Paise(),
+		MinRating:    f.MinRating,
+		Platform:     f.Platform,
+		MinDiscount:  f.MinDiscount,
+		IsNew:        boolInt(f.New),
+		IsBestseller: boolInt(f.Bestseller),
+		StockPolicy:  s.OutOfStock,
+		Sort:         f.Sort,
+		Limit:        listPerPage,
+		Offset:       f.offset(),
+	})
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	total, err := q.CountCategoryProducts(ctx, dbgen.CountCategoryProductsParams{
+		Category:     category,
+		MinPrice:     f.MinPrice.Paise(),
+		MaxPrice:     f.MaxPrice.Paise(),
+		MinRating:    f.MinRating,
+		Platform:     f.Platform,
+		MinDiscount:  f.MinDiscount,
+		IsNew:        boolInt(f.New),
+		IsBestseller: boolInt(f.Bestseller),
+		StockPolicy:  s.OutOfStock,
+	})
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	rows, err := q.CategoryFacetCounts(ctx, dbgen.CategoryFacetCountsParams{
+		MinPrice:     f.MinPrice.Paise(),
+		MaxPrice:     f.MaxPrice.Paise(),
+		MinRating:    f.MinRating,
+		Platform:     f.Platform,
+		MinDiscount:  f.MinDiscount,
+		IsNew:        boolInt(f.New),
+		IsBestseller: boolInt(f.Bestseller),
+		Category:     category,
+		StockPolicy:  s.OutOfStock,
+	})
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	counts := facetCounts{}
+	for _, r := range rows {
+		counts.add(r.Facet, r.Value, r.N)
+	}
+	return products, total, counts, nil
+}
+
+// searchListing is listCategory for full-text search; match is an FTS5
+// expression from ftsQuery.
+func (s *Server) searchListing(ctx context.Context, match string, f listingFilter) ([]searchResult, int64, facetCounts, error) {
+	q := dbgen.New(s.DB)
+	rows, err := q.SearchProducts(ctx, dbgen.SearchProductsParams{
+		Query:        match,
+		MinPrice:     f.MinPrice.Paise(),
+		MaxPrice:     f.MaxPrice.Paise(),
+		MinRating:    f.MinRating,
+		Platform:     f.Platform,
+		MinDiscount:  f.MinDiscount,
+		IsNew:        boolInt(f.New),
+		IsBestseller: boolInt(f.Bestseller),
+		StockPolicy:  s.OutOfStock,
+		Sort:         f.Sort,
+		Limit:        listPerPage,
+		Offset:       f.offset(),
+	})
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	total, err := q.CountSearchProducts(ctx, dbgen.CountSearchProductsParams{
+		Query:        match,
+		MinPrice:     f.MinPrice.Paise(),
+		MaxPrice:     f.MaxPrice.Paise(),
+		MinRating:    f.MinRating,
+		Platform:     f.Platform,
+		MinDiscount:  f.MinDiscount,
+		IsNew:        boolInt(f.New),
+		IsBestseller: boolInt(f.Bestseller),
+		StockPolicy:  s.OutOfStock,
+	})
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	frows, err := q.SearchFacetCounts(ctx, dbgen.SearchFacetCountsParams{
+		MinPrice:     f.MinPrice.Paise(),
+		MaxPrice:     f.MaxPrice.Paise(),
+		MinRating:    f.MinRating,
+		Platform:     f.Platform,
+		MinDiscount:  f.MinDiscount,
+		IsNew:        boolInt(f.New),
+		IsBestseller: boolInt(f.Bestseller),
+		Query:        match,
+		StockPolicy:  s.OutOfStock,
+	})
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	counts := facetCounts{}
+	for _, r := range frows {
+		counts.add(r.Facet, r.Value, r.N)
+	}
+	return toSearchResults(rows), total, counts, nil
+}
+
+// pageCount returns the number of pages needed for total products.
+func pageCount(total int64) int {
+	return int((total + listPerPage - 1) / listPerPage)
+}
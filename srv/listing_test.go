@@ -0,0 +1,51 @@
+package srv
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestListingFilterKeepsPaise(t *testing.T) {
+	f := parseListingFilter(url.Values{"min_price": {"199.50"}, "max_price": {"1000"}})
+	v := f.values()
+	if got := v.Get("min_price"); got != "199.50" {
+		t.Errorf("min_price = %q, want 199.50", got)
+	}
+	if got := v.Get("max_price"); got != "1000" {
+		t.Errorf("max_price = %q, want 1000", got)
+	}
+	if again := parseListingFilter(v); again.MinPrice != f.MinPrice || again.MaxPrice != f.MaxPrice {
+		t.Errorf("round trip gave %v–%v, want %v–%v", again.MinPrice, again.MaxPrice, f.MinPrice, f.MaxPrice)
+	}
+}
+
+// Each price bucket's link must list exactly the products its count
+// includes, including ones priced on a boundary.
+func TestPriceBucketsMatchCounts(t *testing.T) {
+	s := newTestServer(t)
+	// An unpriced product is in no bucket.
+	for _, paise := range []int64{0, 100, 19999, 20000, 49999, 50000, 99999, 100000, 250000} {
+		addProduct(t, s, dbgen.InsertProductParams{Title: "Item", PricePaise: paise, Category: "Buckets"})
+	}
+	ctx := context.Background()
+	_, _, counts, err := s.listCategory(ctx, "Buckets", listingFilter{Page: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range priceBuckets {
+		f := parseListingFilter(url.Values{"min_price": {b.min}, "max_price": {b.max}})
+		products, total, _, err := s.listCategory(ctx, "Buckets", f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != counts["price"][b.value] || int64(len(products)) != total {
+			t.Errorf("bucket %s: counted %d, listed %d (total %d)", b.value, counts["price"][b.value], len(products), total)
+		}
+		if total != 2 {
+			t.Errorf("bucket %s: %d products, want 2", b.value, total)
+		}
+	}
+}
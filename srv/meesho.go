@@ -1,14 +1,19 @@
 package srv
 
 import (
+	"cmp"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"srv.exe.dev/db/dbgen"
@@ -16,61 +21,97 @@ import (
 
 // MeeshoProduct represents a product scraped from Meesho
 type MeeshoProduct struct {
-	MeeshoID    int64    `json:"meesho_id"`
-	Name        string   `json:"name"`
-	Slug        string   `json:"slug"`
-	OrigSlug    string   `json:"original_slug"`
-	Price       int64    `json:"price"`
-	CatalogPrice int64   `json:"catalog_price"`
-	Description string   `json:"description"`
-	Image       string   `json:"image"`
-	Images      []string `json:"images"`
-	Category    string   `json:"category"`
-	Rating      string   `json:"rating"`
-	RatingCount int64    `json:"rating_count"`
-	URL         string   `json:"url"`
+	MeeshoID     int64    `json:"meesho_id"`
+	Name         string   `json:"name"`
+	Slug         string   `json:"slug"`
+	OrigSlug     string   `json:"original_slug"`
+	Price        int64    `json:"price"`
+	CatalogPrice int64    `json:"catalog_price"`
+	Description  string   `json:"description"`
+	Image        string   `json:"image"`
+	Images       []string `json:"images"`
+	Category     string   `json:"category"`
+	Rating       string   `json:"rating"`
+	RatingCount  int64    `json:"rating_count"`
+	URL          string   `json:"url"`
 }
 
-// BulkImportStatus tracks the progress of a bulk import
-type BulkImportStatus struct {
-	mu          sync.Mutex
-	Running     bool             `json:"running"`
-	Total       int              `json:"total"`
-	Imported    int              `json:"imported"`
-	Skipped     int              `json:"skipped"`
-	Failed      int              `json:"failed"`
-	Errors      []string         `json:"errors"`
-	Products    []MeeshoProduct  `json:"products,omitempty"`
-	Message     string           `json:"message"`
-	StartedAt   time.Time        `json:"started_at"`
-	FinishedAt  *time.Time       `json:"finished_at,omitempty"`
+// Store imports fetch one listing page after another, waiting
+// meeshoPageDelay (plus up to a second of jitter) in between so as not to
+// hammer Meesho. A page that is refused with 403, 429 or a server error is
+// retried up to meeshoMaxAttempts times, waiting meeshoRetryBase and then
+// twice as long each time, or as long as Retry-After asks.
+var (
+	meeshoPageDelay   = 2 * time.Second
+	meeshoRetryBase   = 5 * time.Second
+	meeshoMaxAttempts = 5
+	// meeshoMaxPages stops a runaway import if a store's listing never
+	// reports its size.
+	meeshoMaxPages = 500
+)
+
+// errNoMeeshoProducts means a listing page had no products, which past the
+// first page is the end of the listing.
+var errNoMeeshoProducts = errors.New("no products found")
+
+// meeshoStatusError is a Meesho page that came back with an error status.
+type meeshoStatusError struct {
+	Status     int
+	RetryAfter time.Duration
 }
 
-var bulkImportStatus = &BulkImportStatus{}
+func (e *meeshoStatusError) Error() string {
+	switch e.Status {
+	case http.StatusForbidden:
+		return "Meesho blocked the request (403)"
+	case http.StatusTooManyRequests:
+		return "Meesho is rate limiting requests (429)"
+	}
+	return fmt.Sprintf("Meesho returned %d %s", e.Status, http.StatusText(e.Status))
+}
 
-// scrapeMeeshoStorePage fetches a Meesho supplier page and extracts products from __NEXT_DATA__
-func scrapeMeeshoStorePage(storeURL string) ([]MeeshoProduct, int, error) {
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("GET", storeURL, nil)
-	if err != nil {
-		return nil, 0, err
+// retryable reports whether waiting might help: Meesho answers 403 as
+// well as 429 when it thinks it is being scraped too fast.
+func (e *meeshoStatusError) retryable() bool {
+	return e.Status == http.StatusForbidden || e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+// meeshoPageURL returns the URL of one page of a store listing.
+func meeshoPageURL(storeURL string, page int) string {
+	u, err := url.Parse(storeURL)
+	if err != nil || page <= 1 {
+		return storeURL
 	}
-	// Mobile UA works better with Meesho
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Linux; Android 13; SM-G991B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	q := u.Query()
+	q.Set("page", strconv.Itoa(page))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
 
-	resp, err := client.Do(req)
+// scrapeMeeshoStorePage fetches one page of a Meesho supplier listing and
+// extracts its products from __NEXT_DATA__, along with the store's total
+// product count.
+func scrapeMeeshoStorePage(ctx context.Context, storeURL string, page int) ([]MeeshoProduct, int, error) {
+	resp, err := meeshoFetcher.get(ctx, meeshoPageURL(storeURL, page), http.Header{
+		// Mobile UA works better with Meesho
+		"User-Agent":      {"Mozilla/5.0 (Linux; Android 13; SM-G991B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36"},
+		"Accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+		"Accept-Language": {"en-US,en;q=0.9"},
+	})
 	if err != nil {
 		return nil, 0, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == 403 {
-		return nil, 0, fmt.Errorf("Meesho blocked the request (403). Try again in a few minutes")
+	if resp.StatusCode != http.StatusOK {
+		e := &meeshoStatusError{Status: resp.StatusCode}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			e.RetryAfter = time.Duration(secs) * time.Second
+		}
+		return nil, 0, e
 	}
 
-	body, err := io.ReadAll(io.LimitReader(resp.Body, 5*1024*1024))
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -78,21 +119,56 @@ func scrapeMeeshoStorePage(storeURL string) ([]MeeshoProduct, int, error) {
 	return parseMeeshoPage(string(body))
 }
 
-// parseMeeshoPage extracts products and total count from Meesho HTML
-func parseMeeshoPage(html string) ([]MeeshoProduct, int, error) {
-	// Find __NEXT_DATA__ JSON
-	re := regexp.MustCompile(`__NEXT_DATA__[^>]*type="application/json">(.*?)</script>`)
-	m := re.FindStringSubmatch(html)
+// fetchMeeshoStorePage is scrapeMeeshoStorePage with retries and backoff,
+// telling notify what it is waiting for.
+func fetchMeeshoStorePage(ctx context.Context, storeURL string, page int, notify func(string)) ([]MeeshoProduct, int, error) {
+	wait := meeshoRetryBase
+	for attempt := 1; ; attempt++ {
+		products, total, err := scrapeMeeshoStorePage(ctx, storeURL, page)
+		var se *meeshoStatusError
+		if !errors.As(err, &se) || !se.retryable() || attempt == meeshoMaxAttempts {
+			return products, total, err
+		}
+		d := wait
+		if se.RetryAfter > d {
+			d = se.RetryAfter
+		}
+		notify(fmt.Sprintf("%s on page %d; retrying in %s (attempt %d of %d)...",
+			err.Error(), page, d.Round(time.Second), attempt+1, meeshoMaxAttempts))
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+		wait *= 2
+	}
+}
+
+var nextDataRe = regexp.MustCompile(`(?s)__NEXT_DATA__[^>]*type="application/json">(.*?)</script>`)
+
+// meeshoNextData returns the __NEXT_DATA__ JSON that Meesho pages render
+// from.
+func meeshoNextData(html string) (map[string]interface{}, error) {
+	m := nextDataRe.FindStringSubmatch(html)
 	if len(m) < 2 {
 		if strings.Contains(html, "Access Denied") {
-			return nil, 0, fmt.Errorf("Meesho blocked the request. Try again in a few minutes")
+			return nil, fmt.Errorf("Meesho blocked the request. Try again in a few minutes")
 		}
-		return nil, 0, fmt.Errorf("could not find product data on page")
+		return nil, fmt.Errorf("could not find product data on page")
 	}
 
 	var data map[string]interface{}
 	if err := json.Unmarshal([]byte(m[1]), &data); err != nil {
-		return nil, 0, fmt.Errorf("failed to parse page data: %w", err)
+		return nil, fmt.Errorf("failed to parse page data: %w", err)
+	}
+	return data, nil
+}
+
+// parseMeeshoPage extracts products and total count from Meesho HTML
+func parseMeeshoPage(html string) ([]MeeshoProduct, int, error) {
+	data, err := meeshoNextData(html)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	// Navigate: props.pageProps.initialState.shopListing.listing
@@ -118,7 +194,7 @@ func parseMeeshoPage(html string) ([]MeeshoProduct, int, error) {
 	// Get products array
 	pages, ok := listingMap["products"].([]interface{})
 	if !ok || len(pages) == 0 {
-		return nil, totalCount, fmt.Errorf("no products found")
+		return nil, totalCount, errNoMeeshoProducts
 	}
 
 	var products []MeeshoProduct
@@ -252,7 +328,8 @@ func mapMeeshoCategory(meeshoCat string) string {
 	}
 }
 
-// handleBulkImport starts a bulk import from a Meesho store
+// handleBulkImport queues a bulk import from a Meesho store, or with
+// preview=1 a preview of one to review first.
 func (s *Server) handleBulkImport(w http.ResponseWriter, r *http.Request) {
 	storeURL := r.FormValue("store_url")
 	if storeURL == "" {
@@ -264,206 +341,290 @@ func (s *Server) handleBulkImport(w http.ResponseWriter, r *http.Request) {
 		storeURL = "https://www.meesho.com/" + storeURL
 	}
 
-	bulkImportStatus.mu.Lock()
-	if bulkImportStatus.Running {
-		bulkImportStatus.mu.Unlock()
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]any{"error": "Import already running"})
+	actor := s.auditActor(r)
+	n, err := dbgen.New(s.DB).CountActiveStoreImports(r.Context(), storeURL)
+	if err != nil {
+		jsonError(w, "Failed to start import: "+err.Error(), 500)
+		return
+	}
+	if n > 0 {
+		jsonError(w, "This store is already being imported", 409)
+		return
+	}
+	job, err := s.enqueueImport(r.Context(), actor, importKindStore, storeURL, "", r.FormValue("preview") == "1")
+	if err != nil {
+		jsonError(w, "Failed to start import: "+err.Error(), 500)
 		return
 	}
-	bulkImportStatus.Running = true
-	bulkImportStatus.Total = 0
-	bulkImportStatus.Imported = 0
-	bulkImportStatus.Skipped = 0
-	bulkImportStatus.Failed = 0
-	bulkImportStatus.Errors = nil
-	bulkImportStatus.Products = nil
-	bulkImportStatus.Message = "Starting import..."
-	bulkImportStatus.StartedAt = time.Now()
-	bulkImportStatus.FinishedAt = nil
-	bulkImportStatus.mu.Unlock()
-
-	go s.runBulkImport(storeURL)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"ok": true, "message": "Import started"})
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "message": "Import queued", "job": s.importJobStatus(r.Context(), job)})
 }
 
-func (s *Server) runBulkImport(storeURL string) {
-	defer func() {
-		bulkImportStatus.mu.Lock()
-		bulkImportStatus.Running = false
-		now := time.Now()
-		bulkImportStatus.FinishedAt = &now
-		bulkImportStatus.mu.Unlock()
-	}()
+// runStoreImport walks a store's listing page by page from the job's
+// next page, importing each product it hasn't seen yet, until it has seen
+// as many products as the store says it has. It stops between products
+// when ctx is cancelled.
+func (s *Server) runStoreImport(ctx context.Context, run *importRun) error {
+	// Listings shift while we page through them, so the same product can
+	// turn up on two pages, or again when a page is resumed.
+	seen := map[string]bool{}
+	ids, err := run.q.ListImportJobSourceIDs(ctx, run.job.ID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		seen[id] = true
+	}
 
-	bulkImportStatus.mu.Lock()
-	bulkImportStatus.Message = "Fetching store page..."
-	bulkImportStatus.mu.Unlock()
+	start := int(run.job.NextPage)
+	for page := start; page <= meeshoMaxPages; page++ {
+		if page > start {
+			select {
+			case <-time.After(meeshoPageDelay + time.Duration(rand.Int64N(int64(time.Second)))):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		run.setMessage(fmt.Sprintf("Fetching page %d...", page))
 
-	products, totalCount, err := scrapeMeeshoStorePage(storeURL)
-	if err != nil {
-		bulkImportStatus.mu.Lock()
-		bulkImportStatus.Message = "Error: " + err.Error()
-		bulkImportStatus.Errors = append(bulkImportStatus.Errors, err.Error())
-		bulkImportStatus.mu.Unlock()
-		return
+		products, totalCount, err := fetchMeeshoStorePage(ctx, run.job.StoreUrl, page, run.setMessage)
+		if errors.Is(err, errNoMeeshoProducts) && page > 1 {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Error on page %d: %w", page, err)
+		}
+		if totalCount > 0 {
+			run.job.Total = int64(totalCount)
+		}
+
+		fresh := 0
+		for _, mp := range products {
+			params := meeshoProductParams(mp)
+			if params.SourceID != "" && seen[params.SourceID] {
+				continue
+			}
+			seen[params.SourceID] = true
+			fresh++
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			run.job.Message = fmt.Sprintf("Page %d: processing %d/%d: %s", page, run.job.Seen+1, run.job.Total, mp.Name)
+			run.importItem(ctx, params)
+		}
+
+		run.job.NextPage = int64(page + 1)
+		run.save(fmt.Sprintf("Finished page %d", page))
+
+		if fresh == 0 || (run.job.Total > 0 && run.job.Seen >= run.job.Total) {
+			break
+		}
 	}
+	return nil
+}
 
-	bulkImportStatus.mu.Lock()
-	bulkImportStatus.Total = len(products)
-	bulkImportStatus.Message = fmt.Sprintf("Found %d products (of %d total in store). Importing...", len(products), totalCount)
-	bulkImportStatus.mu.Unlock()
+// meeshoProductParams is the product row for a scraped Meesho product.
+func meeshoProductParams(mp MeeshoProduct) dbgen.InsertProductParams {
+	// Build images JSON
+	imagesJSON := "[]"
+	if len(mp.Images) > 0 {
+		b, _ := json.Marshal(mp.Images)
+		imagesJSON = string(b)
+	}
 
-	// Get existing product URLs to avoid duplicates
-	q := dbgen.New(s.DB)
-	ctx := context.Background()
-	existing, _ := q.ListProducts(ctx)
-	existingTitles := make(map[string]bool)
-	for _, p := range existing {
-		existingTitles[strings.ToLower(strings.TrimSpace(p.Title))] = true
+	// Main image
+	imageURL := mp.Image
+	if imageURL == "" && len(mp.Images) > 0 {
+		imageURL = mp.Images[0]
 	}
 
-	for i, mp := range products {
-		bulkImportStatus.mu.Lock()
-		bulkImportStatus.Message = fmt.Sprintf("Processing %d/%d: %s", i+1, len(products), mp.Name)
-		bulkImportStatus.mu.Unlock()
+	// Price
+	price := Rupees(mp.Price)
+	var origPrice Money
+	if mp.CatalogPrice > mp.Price {
+		origPrice = Rupees(mp.CatalogPrice)
+	}
 
-		// Skip if already exists
-		if existingTitles[strings.ToLower(strings.TrimSpace(mp.Name))] {
-			bulkImportStatus.mu.Lock()
-			bulkImportStatus.Skipped++
-			bulkImportStatus.mu.Unlock()
-			continue
-		}
+	var sourceID string
+	if mp.MeeshoID != 0 {
+		sourceID = strconv.FormatInt(mp.MeeshoID, 10)
+	}
 
-		// Map category
-		category := mapMeeshoCategory(mp.Category)
+	return dbgen.InsertProductParams{
+		Url:                mp.URL,
+		Platform:           "Meesho",
+		Title:              mp.Name,
+		PricePaise:         price.Paise(),
+		OriginalPricePaise: origPrice.Paise(),
+		ImageUrl:           imageURL,
+		Description:        mp.Description,
+		Rating:             mp.Rating,
+		Category:           mapMeeshoCategory(mp.Category),
+		Images:             imagesJSON,
+		SourcePlatform:     "Meesho",
+		SourceID:           sourceID,
+	}
+}
 
-		// Build images JSON
-		imagesJSON := "[]"
-		if len(mp.Images) > 0 {
-			b, _ := json.Marshal(mp.Images)
-			imagesJSON = string(b)
-		}
+// Outcomes of importing one product.
+const (
+	importCreated   = "created"
+	importUpdated   = "updated"
+	importUnchanged = "unchanged"
+)
 
-		// Main image
-		imageURL := mp.Image
-		if imageURL == "" && len(mp.Images) > 0 {
-			imageURL = mp.Images[0]
-		}
+// importProduct adds an imported product, or refreshes its price, images
+// and rating if it was imported before, and logs the change to the audit
+// log. It returns the outcome and the product's ID.
+func (s *Server) importProduct(ctx context.Context, actor auditActor, params dbgen.InsertProductParams) (string, int64, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	defer tx.Rollback()
+	outcome, id, err := importProductTx(ctx, dbgen.New(tx), actor, params)
+	if err != nil || outcome == importUnchanged {
+		return outcome, id, err
+	}
+	return outcome, id, tx.Commit()
+}
 
-		// Price
-		priceStr := fmt.Sprintf("\u20b9%d", mp.Price)
-		origPriceStr := ""
-		if mp.CatalogPrice > mp.Price {
-			origPriceStr = fmt.Sprintf("\u20b9%d", mp.CatalogPrice)
+// importProductTx is importProduct within the caller's transaction.
+func importProductTx(ctx context.Context, q *dbgen.Queries, actor auditActor, params dbgen.InsertProductParams) (string, int64, error) {
+	existing, err := findImportedProduct(ctx, q, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		p, err := q.InsertProduct(ctx, params)
+		if err != nil {
+			return "", 0, err
 		}
-
-		_, err := q.InsertProduct(ctx, dbgen.InsertProductParams{
-			Url:           mp.URL,
-			Platform:      "Meesho",
-			Title:         mp.Name,
-			Price:         priceStr,
-			OriginalPrice: origPriceStr,
-			ImageUrl:      imageURL,
-			Description:   mp.Description,
-			Rating:        mp.Rating,
-			Category:      category,
-			Images:        imagesJSON,
-		})
+		after, err := snapshotProduct(ctx, q, p.ID)
 		if err != nil {
-			bulkImportStatus.mu.Lock()
-			bulkImportStatus.Failed++
-			bulkImportStatus.Errors = append(bulkImportStatus.Errors, fmt.Sprintf("%s: %s", mp.Name, err.Error()))
-			bulkImportStatus.mu.Unlock()
-			continue
+			return "", 0, err
+		}
+		if err := logAudit(ctx, q, actor, auditImport, &p.ID, nil, after); err != nil {
+			return "", 0, err
 		}
+		return importCreated, p.ID, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
 
-		bulkImportStatus.mu.Lock()
-		bulkImportStatus.Imported++
-		bulkImportStatus.Products = append(bulkImportStatus.Products, mp)
-		existingTitles[strings.ToLower(strings.TrimSpace(mp.Name))] = true
-		bulkImportStatus.mu.Unlock()
+	upd, changed := importUpdate(existing, params)
+	if !changed {
+		return importUnchanged, existing.ID, nil
+	}
+	before, err := snapshotProduct(ctx, q, existing.ID)
+	if err != nil {
+		return "", 0, err
 	}
+	if err := q.UpdateImportedProduct(ctx, upd); err != nil {
+		return "", 0, err
+	}
+	after, err := snapshotProduct(ctx, q, existing.ID)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := logAudit(ctx, q, actor, auditImport, &existing.ID, before, after); err != nil {
+		return "", 0, err
+	}
+	return importUpdated, existing.ID, nil
+}
 
-	bulkImportStatus.mu.Lock()
-	bulkImportStatus.Message = fmt.Sprintf("Done! Imported %d, skipped %d (already exist), failed %d",
-		bulkImportStatus.Imported, bulkImportStatus.Skipped, bulkImportStatus.Failed)
-	bulkImportStatus.mu.Unlock()
+// importUpdate is the update re-importing existing would make, and
+// whether it changes anything. A listing that lost its images or rating
+// keeps the ones we have.
+func importUpdate(existing dbgen.Product, params dbgen.InsertProductParams) (dbgen.UpdateImportedProductParams, bool) {
+	upd := dbgen.UpdateImportedProductParams{
+		PricePaise:         params.PricePaise,
+		OriginalPricePaise: params.OriginalPricePaise,
+		ImageUrl:           cmp.Or(params.ImageUrl, existing.ImageUrl),
+		Images:             existing.Images,
+		Rating:             cmp.Or(params.Rating, existing.Rating),
+		Url:                cmp.Or(params.Url, existing.Url),
+		SourcePlatform:     params.SourcePlatform,
+		SourceID:           params.SourceID,
+		ID:                 existing.ID,
+	}
+	if params.Images != "" && params.Images != "[]" {
+		upd.Images = params.Images
+	}
+	changed := upd.PricePaise != existing.PricePaise || upd.OriginalPricePaise != existing.OriginalPricePaise ||
+		upd.ImageUrl != existing.ImageUrl || upd.Images != existing.Images || upd.Rating != existing.Rating ||
+		upd.Url != existing.Url || upd.SourcePlatform != existing.SourcePlatform || upd.SourceID != existing.SourceID
+	return upd, changed
 }
 
-// handleBulkImportStatus returns the current import status
-func (s *Server) handleBulkImportStatus(w http.ResponseWriter, r *http.Request) {
-	bulkImportStatus.mu.Lock()
-	defer bulkImportStatus.mu.Unlock()
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(bulkImportStatus)
+// previewImport reports what importProduct would do with params without
+// doing it: the outcome, the matching product's ID for an update, and
+// the changed fields as {"field": [before, after]}.
+func previewImport(ctx context.Context, q *dbgen.Queries, params dbgen.InsertProductParams) (string, int64, string, error) {
+	existing, err := findImportedProduct(ctx, q, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return importCreated, 0, "", nil
+	}
+	if err != nil {
+		return "", 0, "", err
+	}
+	upd, changed := importUpdate(existing, params)
+	if !changed {
+		return importUnchanged, existing.ID, "", nil
+	}
+	before, err := snapshotProduct(ctx, q, existing.ID)
+	if err != nil {
+		return "", 0, "", err
+	}
+	after := *before
+	after.URL, after.Price, after.OriginalPrice = upd.Url, Money(upd.PricePaise), Money(upd.OriginalPricePaise)
+	after.ImageURL, after.Images, after.Rating = upd.ImageUrl, upd.Images, upd.Rating
+	b, _ := auditJSON(before)
+	a, _ := auditJSON(&after)
+	diff, err := auditDiff(b, a)
+	return importUpdated, existing.ID, diff, err
+}
+
+// findImportedProduct returns the product an import refers to: the one
+// with the same source ID or, for products imported before source IDs
+// were recorded, the one with the same listing URL. It returns
+// sql.ErrNoRows for a new product.
+func findImportedProduct(ctx context.Context, q *dbgen.Queries, params dbgen.InsertProductParams) (dbgen.Product, error) {
+	if params.SourceID != "" {
+		p, err := q.GetProductBySource(ctx, dbgen.GetProductBySourceParams{SourcePlatform: params.SourcePlatform, SourceID: params.SourceID})
+		if !errors.Is(err, sql.ErrNoRows) {
+			return p, err
+		}
+	}
+	if params.Url == "" {
+		return dbgen.Product{}, sql.ErrNoRows
+	}
+	return q.GetUnsourcedProductByURL(ctx, dbgen.GetUnsourcedProductByURLParams{Platform: params.Platform, Url: params.Url})
 }
 
-// handleBulkImportJSON imports products from a JSON payload (for manual paste of scraped data)
+// handleBulkImportJSON queues an import of products pasted as JSON, for
+// when Meesho blocks the store import, or with ?preview=1 a preview of
+// one.
 func (s *Server) handleBulkImportJSON(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 10<<20))
+	if err != nil {
+		jsonError(w, "Failed to read JSON: "+err.Error(), 400)
+		return
+	}
 	var products []MeeshoProduct
-	if err := json.NewDecoder(r.Body).Decode(&products); err != nil {
+	if err := json.Unmarshal(body, &products); err != nil {
 		jsonError(w, "Invalid JSON: "+err.Error(), 400)
 		return
 	}
-
-	q := dbgen.New(s.DB)
-	existing, _ := q.ListProducts(r.Context())
-	existingTitles := make(map[string]bool)
-	for _, p := range existing {
-		existingTitles[strings.ToLower(strings.TrimSpace(p.Title))] = true
+	if len(products) == 0 {
+		jsonError(w, "No products in the JSON", 400)
+		return
 	}
 
-	imported, skipped := 0, 0
-	for _, mp := range products {
-		if existingTitles[strings.ToLower(strings.TrimSpace(mp.Name))] {
-			skipped++
-			continue
-		}
-
-		category := mapMeeshoCategory(mp.Category)
-		imagesJSON := "[]"
-		if len(mp.Images) > 0 {
-			b, _ := json.Marshal(mp.Images)
-			imagesJSON = string(b)
-		}
-		imageURL := mp.Image
-		if imageURL == "" && len(mp.Images) > 0 {
-			imageURL = mp.Images[0]
-		}
-		priceStr := fmt.Sprintf("₹%d", mp.Price)
-		origPriceStr := ""
-		if mp.CatalogPrice > mp.Price {
-			origPriceStr = fmt.Sprintf("₹%d", mp.CatalogPrice)
-		}
-
-		_, err := q.InsertProduct(r.Context(), dbgen.InsertProductParams{
-			Url:           mp.URL,
-			Platform:      "Meesho",
-			Title:         mp.Name,
-			Price:         priceStr,
-			OriginalPrice: origPriceStr,
-			ImageUrl:      imageURL,
-			Description:   mp.Description,
-			Rating:        mp.Rating,
-			Category:      category,
-			Images:        imagesJSON,
-		})
-		if err != nil {
-			continue
-		}
-		imported++
-		existingTitles[strings.ToLower(strings.TrimSpace(mp.Name))] = true
+	job, err := s.enqueueImport(r.Context(), s.auditActor(r), importKindJSON, "", string(body), r.URL.Query().Get("preview") == "1")
+	if err != nil {
+		jsonError(w, "Failed to start import: "+err.Error(), 500)
+		return
 	}
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{
-		"ok":       true,
-		"imported": imported,
-		"skipped":  skipped,
-		"total":    len(products),
-	})
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "message": "Import queued", "job": s.importJobStatus(r.Context(), job)})
 }
@@ -0,0 +1,171 @@
+package srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// Money is an amount in Indian rupees, stored as integer paise so that
+// sorting, discounts and filtering never depend on re-parsing display strings.
+type Money int64
+
+// Rupees returns the Money value for a whole number of rupees.
+func Rupees(n int64) Money {
+	return Money(n * 100)
+}
+
+// ParseMoney parses free-form prices such as "₹370", "Rs. 1,234.50",
+// "INR 999/-" or "1234". An empty string parses as zero.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	for _, prefix := range []string{"₹", "Rs.", "Rs", "INR"} {
+		s = strings.TrimPrefix(s, prefix)
+		s = strings.TrimSpace(s)
+	}
+	s = strings.TrimSuffix(s, "/-")
+	s = strings.ReplaceAll(s, ",", "")
+	s = strings.ReplaceAll(s, " ", "")
+	if s == "" {
+		return 0, nil
+	}
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" {
+		whole = "0"
+	}
+	rupees, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || rupees < 0 {
+		return 0, fmt.Errorf("invalid price %q", s)
+	}
+	var paise int64
+	if hasFrac {
+		if len(frac) > 2 {
+			frac = frac[:2]
+		}
+		for len(frac) < 2 {
+			frac += "0"
+		}
+		paise, err = strconv.ParseInt(frac, 10, 64)
+		if err != nil || paise < 0 {
+			return 0, fmt.Errorf("invalid price %q", s)
+		}
+	}
+	return Money(rupees*100 + paise), nil
+}
+
+// Paise returns the amount in paise.
+func (m Money) Paise() int64 {
+	return int64(m)
+}
+
+// IsZero reports whether no price is set.
+func (m Money) IsZero() bool {
+	return m == 0
+}
+
+// String formats the amount with Indian digit grouping, e.g. "₹1,23,456" or
+// "₹1,234.50". Paise are only shown when non-zero.
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	digits := strconv.FormatInt(v/100, 10)
+	var b strings.Builder
+	b.WriteString(sign + "₹")
+	if len(digits) > 3 {
+		head, tail := digits[:len(digits)-3], digits[len(digits)-3:]
+		for i, c := range head {
+			if i > 0 && (len(head)-i)%2 == 0 {
+				b.WriteByte(',')
+			}
+			b.WriteRune(c)
+		}
+		b.WriteByte(',')
+		b.WriteString(tail)
+	} else {
+		b.WriteString(digits)
+	}
+	if p := v % 100; p != 0 {
+		fmt.Fprintf(&b, ".%02d", p)
+	}
+	return b.String()
+}
+
+// Plain formats the amount as a bare number of rupees, with paise only when
+// non-zero, e.g. "1234" or "199.50", for URLs and spreadsheets.
+func (m Money) Plain() string {
+	if m%100 == 0 {
+		return strconv.FormatInt(int64(m)/100, 10)
+	}
+	return m.Decimal()
+}
+
+// Decimal formats the amount as a plain number of rupees with two decimal
+// places, e.g. "1299.00", for machine-readable markup such as Open Graph.
+func (m Money) Decimal() string {
+	v := int64(m)
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+// MarshalJSON encodes the amount as its display string so API clients keep
+// receiving "₹370"-style prices; the raw paise are exposed alongside.
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m == 0 {
+		return []byte(`""`), nil
+	}
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts either a display string ("₹370", "1,234.50") or a
+// bare number of rupees.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n json.Number
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("invalid price %s", b)
+		}
+		s = n.String()
+	}
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// apiProduct is the JSON shape of a product returned by the /api endpoints.
+type apiProduct struct {
+	dbgen.Product
+	Price         Money        `json:"price"`
+	OriginalPrice Money        `json:"original_price"`
+	Variants      []apiVariant `json:"variants,omitempty"`
+}
+
+func toAPIProduct(p dbgen.Product) apiProduct {
+	return apiProduct{
+		Product:       p,
+		Price:         Money(p.PricePaise),
+		OriginalPrice: Money(p.OriginalPricePaise),
+	}
+}
+
+func toAPIProducts(ps []dbgen.Product) []apiProduct {
+	out := make([]apiProduct, 0, len(ps))
+	for _, p := range ps {
+		out = append(out, toAPIProduct(p))
+	}
+	return out
+}
@@ -1,117 +1,243 @@
 package srv
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
-	"time"
 )
 
+// ProductInfo is what a Scraper found on a product page.
 type ProductInfo struct {
 	URL           string
 	Platform      string
 	Title         string
-	Price         string
-	OriginalPrice string
+	Price         Money
+	OriginalPrice Money // MRP, if the page shows one
 	ImageURL      string
+	Images        []string // every product image, ImageURL first
 	Description   string
 	Rating        string
+	RatingCount   int64
+	Category      string // the platform's own category name
 }
 
-func ScrapeProduct(rawURL string) (*ProductInfo, error) {
+// Scraper extracts product details from one platform's product pages.
+type Scraper interface {
+	// Platform is the name stored in products.platform.
+	Platform() string
+	// Hosts are the host names its product pages and short links are
+	// served from, matched exactly.
+	Hosts() []string
+	// Extract reads a fetched product page. pageURL is where the page was
+	// finally served from, after redirects.
+	Extract(pageURL, body string) (*ProductInfo, error)
+}
+
+// scrapers are tried in order; pages from any other site get the generic
+// scraper's structured data and meta-tag heuristics.
+var scrapers = []Scraper{
+	meeshoScraper{},
+	amazonScraper{},
+	flipkartScraper{},
+}
+
+// scraperFor returns the scraper for a product URL.
+func scraperFor(rawURL string) Scraper {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return genericScraper{}
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	for _, sc := range scrapers {
+		if slices.Contains(sc.Hosts(), host) {
+			return sc
+		}
+	}
+	return genericScraper{}
+}
+
+// ScrapeProduct fetches a product page and extracts its details with the
+// scraper for the page's platform. Short links are followed first, so an
+// amzn.to link is read as the Amazon page it leads to.
+func ScrapeProduct(ctx context.Context, rawURL string) (*ProductInfo, error) {
 	rawURL = strings.TrimSpace(rawURL)
 	if rawURL == "" {
 		return nil, fmt.Errorf("empty URL")
 	}
-
-	platform := detectPlatform(rawURL)
-	if platform == "" {
-		return nil, fmt.Errorf("unsupported platform — use Meesho or Amazon URLs")
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("not a web address: %s", rawURL)
 	}
 
-	body, err := fetchPage(rawURL)
+	body, finalURL, err := fetchPage(ctx, rawURL)
 	if err != nil {
 		return nil, fmt.Errorf("fetch page: %w", err)
 	}
 
-	p := &ProductInfo{URL: rawURL, Platform: platform}
+	p, err := scraperFor(finalURL).Extract(finalURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if p.ImageURL == "" && len(p.Images) > 0 {
+		p.ImageURL = p.Images[0]
+	}
+	if p.Title == "" {
+		p.Title = "Product from " + p.Platform
+	}
+	return p, nil
+}
+
+// detectPlatform names the platform of a product URL without fetching it,
+// "Other" if no scraper claims it. Short links count as their platform.
+func detectPlatform(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	return scraperFor(rawURL).Platform()
+}
+
+// genericScraper reads the Open Graph and other meta tags most shops
+// publish. The platform scrapers start from its result and fill in what
+// their pages carry beyond that.
+type genericScraper struct{}
+
+func (genericScraper) Platform() string { return "Other" }
+
+func (genericScraper) Hosts() []string { return nil }
+
+func (genericScraper) Extract(pageURL, body string) (*ProductInfo, error) {
+	return extractGeneric(pageURL, body, "Other"), nil
+}
+
+func extractGeneric(pageURL, body, platform string) *ProductInfo {
+	p := extractStructured(pageURL, body)
+	if p == nil {
+		p = &ProductInfo{URL: pageURL}
+	}
+	p.Platform = platform
 
-	// Extract from meta tags (og: tags, standard meta)
+	// Meta tags (og: tags, standard meta) fill whatever structured data
+	// didn't have.
 	p.Title = firstNonEmpty(
+		p.Title,
 		extractMeta(body, `og:title`),
 		extractMeta(body, `twitter:title`),
 		extractTag(body, `<title>`, `</title>`),
 	)
 	p.Description = firstNonEmpty(
+		p.Description,
 		extractMeta(body, `og:description`),
 		extractMeta(body, `description`),
 		extractMeta(body, `twitter:description`),
 	)
-	p.ImageURL = firstNonEmpty(
-		extractMeta(body, `og:image`),
-		extractMeta(body, `twitter:image`),
-	)
+	if len(p.Images) == 0 {
+		p.setImages([]string{firstNonEmpty(
+			extractMeta(body, `og:image`),
+			extractMeta(body, `twitter:image`),
+		)})
+	}
 
-	// Price extraction
-	p.Price = firstNonEmpty(
-		extractMeta(body, `og:price:amount`),
-		extractMeta(body, `product:price:amount`),
-		extractPriceFromBody(body, platform),
-	)
-	p.OriginalPrice = firstNonEmpty(
-		extractMeta(body, `product:original_price:amount`),
-	)
-	p.Rating = extractRating(body)
+	// The page-wide price and rating regexes are a last resort: they match
+	// the first price or rating anywhere, often another product's.
+	if p.Price == 0 {
+		p.Price, _ = ParseMoney(firstNonEmpty(
+			extractMeta(body, `og:price:amount`),
+			extractMeta(body, `product:price:amount`),
+			extractPriceFromBody(body, platform),
+		))
+	}
+	if p.OriginalPrice == 0 {
+		p.OriginalPrice, _ = ParseMoney(firstNonEmpty(
+			extractMeta(body, `product:original_price:amount`),
+		))
+	}
+	if p.Rating == "" {
+		p.Rating = extractRating(body)
+	}
 
 	// Clean up title (remove site names)
 	p.Title = cleanTitle(p.Title, platform)
+	return p
+}
 
-	if p.Title == "" {
-		p.Title = "Product from " + platform
+// setImages replaces p's images with imgs, if there are any, keeping the
+// first as the main image.
+func (p *ProductInfo) setImages(imgs []string) {
+	var out []string
+	seen := map[string]bool{}
+	for _, img := range imgs {
+		img = strings.TrimSpace(img)
+		if img != "" && !seen[img] {
+			seen[img] = true
+			out = append(out, img)
+		}
+	}
+	if len(out) > 0 {
+		p.Images = out
+		p.ImageURL = out[0]
 	}
-
-	return p, nil
 }
 
-func detectPlatform(url string) string {
-	l := strings.ToLower(url)
-	switch {
-	case strings.Contains(l, "meesho.com"):
-		return "Meesho"
-	case strings.Contains(l, "amazon.in"), strings.Contains(l, "amazon.com"),
-		strings.Contains(l, "amzn.in"), strings.Contains(l, "amzn.to"),
-		strings.Contains(l, "amzn.eu"):
-		return "Amazon"
-	case strings.Contains(l, "flipkart.com"), strings.Contains(l, "fkrt.it"):
-		return "Flipkart"
-	default:
-		return "Other"
+// productCategory picks one of our categories for a scraped product, from
+// the platform's category when it maps to one and the title otherwise.
+func productCategory(p *ProductInfo) string {
+	if p.Category != "" {
+		if c := mapMeeshoCategory(p.Category); c != "Other" {
+			return c
+		}
 	}
+	return autoCategory(p.Title)
 }
 
-func fetchPage(url string) (string, error) {
-	client := &http.Client{Timeout: 15 * time.Second}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9,hi;q=0.8")
+var countRe = regexp.MustCompile(`\d[\d,]*`)
+
+// parseCount reads the first number in text such as "1,234 ratings".
+func parseCount(s string) int64 {
+	n, _ := strconv.ParseInt(strings.ReplaceAll(countRe.FindString(s), ",", ""), 10, 64)
+	return n
+}
 
-	resp, err := client.Do(req)
+// fetchPage fetches a product page with pageFetcher.
+func fetchPage(ctx context.Context, pageURL string) (body, finalURL string, err error) {
+	resp, err := pageFetcher.get(ctx, pageURL, http.Header{
+		"User-Agent":      {"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"},
+		"Accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+		"Accept-Language": {"en-US,en;q=0.9,hi;q=0.8"},
+	})
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", &pageStatusError{Host: resp.Request.URL.Host, Status: resp.StatusCode}
+	}
 
-	b, err := io.ReadAll(io.LimitReader(resp.Body, 2*1024*1024))
+	b, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-	return string(b), nil
+	return string(b), resp.Request.URL.String(), nil
+}
+
+// pageStatusError is a product page that answered with something other
+// than 200 OK.
+type pageStatusError struct {
+	Host   string
+	Status int
+}
+
+func (e *pageStatusError) Error() string {
+	return fmt.Sprintf("%s returned %d %s", e.Host, e.Status, http.StatusText(e.Status))
+}
+
+// gone reports whether the listing has been taken down for good.
+func (e *pageStatusError) gone() bool {
+	return e.Status == http.StatusNotFound || e.Status == http.StatusGone
 }
 
 var metaPatterns = []*regexp.Regexp{
@@ -0,0 +1,98 @@
+package srv
+
+import (
+	"regexp"
+	"strings"
+)
+
+// amazonScraper reads Amazon product pages, which carry few meta tags but
+// stable element IDs and the image gallery as JSON in a script.
+type amazonScraper struct{}
+
+func (amazonScraper) Platform() string { return "Amazon" }
+
+func (amazonScraper) Hosts() []string {
+	return []string{
+		"www.amazon.in", "amazon.in", "m.amazon.in",
+		"www.amazon.com", "amazon.com",
+		// Short links from the app's share button.
+		"amzn.in", "amzn.to", "amzn.eu",
+	}
+}
+
+var (
+	amazonTitleRe       = regexp.MustCompile(`(?s)<span[^>]+id="productTitle"[^>]*>(.*?)</span>`)
+	amazonPriceRe       = regexp.MustCompile(`(?s)class="a-price[^"]*priceToPay[^"]*"[^>]*>\s*<span class="a-offscreen">([^<]+)</span>`)
+	amazonPriceWholeRe  = regexp.MustCompile(`<span class="a-price-whole">([\d,]+)`)
+	amazonMRPRe         = regexp.MustCompile(`(?s)data-a-strike="true"[^>]*>\s*<span class="a-offscreen">([^<]+)</span>`)
+	amazonHiResRe       = regexp.MustCompile(`"hiRes"\s*:\s*"(https://[^"]+)"`)
+	amazonLargeRe       = regexp.MustCompile(`"large"\s*:\s*"(https://[^"]+)"`)
+	amazonOldHiresRe    = regexp.MustCompile(`data-old-hires="(https://[^"]+)"`)
+	amazonRatingCountRe = regexp.MustCompile(`(?s)id="acrCustomerReviewText"[^>]*>([^<]+)<`)
+	amazonBreadcrumbsRe = regexp.MustCompile(`(?s)id="wayfinding-breadcrumbs_feature_div".*?</ul>`)
+	amazonCrumbRe       = regexp.MustCompile(`(?s)<a[^>]*>(.*?)</a>`)
+	amazonBulletsRe     = regexp.MustCompile(`(?s)id="feature-bullets".*?</ul>`)
+	amazonBulletRe      = regexp.MustCompile(`(?s)<span class="a-list-item">(.*?)</span>`)
+)
+
+func (sc amazonScraper) Extract(pageURL, body string) (*ProductInfo, error) {
+	p := extractGeneric(pageURL, body, sc.Platform())
+	if m := amazonTitleRe.FindStringSubmatch(body); m != nil {
+		p.Title = cleanTitle(htmlDecode(strings.TrimSpace(m[1])), sc.Platform())
+	}
+
+	price := ""
+	if m := amazonPriceRe.FindStringSubmatch(body); m != nil {
+		price = m[1]
+	} else if m := amazonPriceWholeRe.FindStringSubmatch(body); m != nil {
+		price = "₹" + m[1]
+	}
+	if v, err := ParseMoney(price); err == nil && v > 0 {
+		p.Price = v
+	}
+	if m := amazonMRPRe.FindStringSubmatch(body); m != nil {
+		if v, err := ParseMoney(m[1]); err == nil && v > p.Price {
+			p.OriginalPrice = v
+		}
+	}
+
+	// The gallery script lists each image as hiRes, or only large for
+	// small originals.
+	var imgs []string
+	for _, m := range amazonHiResRe.FindAllStringSubmatch(body, -1) {
+		imgs = append(imgs, m[1])
+	}
+	if len(imgs) == 0 {
+		for _, m := range amazonLargeRe.FindAllStringSubmatch(body, -1) {
+			imgs = append(imgs, m[1])
+		}
+	}
+	if len(imgs) == 0 {
+		if m := amazonOldHiresRe.FindStringSubmatch(body); m != nil {
+			imgs = append(imgs, m[1])
+		}
+	}
+	p.setImages(imgs)
+
+	if m := amazonRatingCountRe.FindStringSubmatch(body); m != nil {
+		p.RatingCount = parseCount(m[1])
+	}
+	// The last breadcrumb is the most specific category.
+	if crumbs := amazonBreadcrumbsRe.FindString(body); crumbs != "" {
+		if ms := amazonCrumbRe.FindAllStringSubmatch(crumbs, -1); len(ms) > 0 {
+			p.Category = htmlDecode(strings.TrimSpace(ms[len(ms)-1][1]))
+		}
+	}
+	if bullets := amazonBulletsRe.FindString(body); bullets != "" {
+		var lines []string
+		for _, m := range amazonBulletRe.FindAllStringSubmatch(bullets, -1) {
+			if l := htmlDecode(strings.TrimSpace(m[1])); l != "" {
+				lines = append(lines, l)
+			}
+		}
+		if len(lines) > 0 {
+			p.Description = strings.Join(lines, "\n")
+		}
+	}
+	return p, nil
+}
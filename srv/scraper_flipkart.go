@@ -0,0 +1,53 @@
+package srv
+
+import (
+	"regexp"
+	"strings"
+)
+
+// flipkartScraper reads Flipkart product pages. Their class names change
+// with every deploy, so it relies on the JSON-LD Flipkart publishes for
+// search engines, which extractGeneric reads, and on the image CDN's URL
+// scheme for the full gallery.
+type flipkartScraper struct{}
+
+func (flipkartScraper) Platform() string { return "Flipkart" }
+
+func (flipkartScraper) Hosts() []string {
+	return []string{
+		"www.flipkart.com", "flipkart.com", "dl.flipkart.com",
+		// Short links from the app's share button.
+		"fkrt.it", "fkrt.cc",
+	}
+}
+
+// flipkartCDNHost matches the hosts Flipkart serves product images from,
+// which are numbered shards.
+const flipkartCDNHost = `rukminim\d*\.flixcart\.com`
+
+var (
+	// flipkartCDNHostRe is flipkartCDNHost on its own, for imageFetcher.
+	flipkartCDNHostRe = regexp.MustCompile(`^` + flipkartCDNHost + `$`)
+	// Gallery thumbnails are the only 128×128 images on the page;
+	// recommendations further down use other sizes.
+	flipkartThumbRe = regexp.MustCompile(`https://` + flipkartCDNHost + `/image/128/128/[^"'?\s]+`)
+	flipkartMRPRe   = regexp.MustCompile(`class="(?:yRaY8j|_3I9_wc)[^"]*">₹(?:<!-- -->)?([\d,]+)`)
+)
+
+func (sc flipkartScraper) Extract(pageURL, body string) (*ProductInfo, error) {
+	p := extractGeneric(pageURL, body, sc.Platform())
+
+	var gallery []string
+	for _, u := range flipkartThumbRe.FindAllString(body, -1) {
+		gallery = append(gallery, strings.Replace(u, "/image/128/128/", "/image/832/832/", 1))
+	}
+	p.setImages(gallery)
+
+	// The JSON-LD offer has only the selling price.
+	if m := flipkartMRPRe.FindStringSubmatch(body); m != nil && p.OriginalPrice == 0 {
+		if v, err := ParseMoney(m[1]); err == nil && v > p.Price {
+			p.OriginalPrice = v
+		}
+	}
+	return p, nil
+}
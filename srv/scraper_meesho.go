@@ -0,0 +1,89 @@
+package srv
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// meeshoScraper reads Meesho product pages from the __NEXT_DATA__ JSON the
+// page is rendered from, which has every image and the MRP that the meta
+// tags leave out.
+type meeshoScraper struct{}
+
+func (meeshoScraper) Platform() string { return "Meesho" }
+
+func (meeshoScraper) Hosts() []string { return []string{"www.meesho.com", "meesho.com"} }
+
+// meeshoProductPaths are where product pages have kept the product object
+// in __NEXT_DATA__.
+var meeshoProductPaths = [][]string{
+	{"props", "pageProps", "initialState", "product", "details", "data"},
+	{"props", "pageProps", "initialState", "product", "details"},
+	{"props", "pageProps", "productDetails"},
+}
+
+func (sc meeshoScraper) Extract(pageURL, body string) (*ProductInfo, error) {
+	p := extractGeneric(pageURL, body, sc.Platform())
+	data, err := meeshoNextData(body)
+	if err != nil {
+		// Meta tags are better than nothing when the JSON moves.
+		if p.Title == "" {
+			return nil, err
+		}
+		return p, nil
+	}
+	var prod map[string]interface{}
+	for _, path := range meeshoProductPaths {
+		if v, err := navigateJSON(data, path...); err == nil {
+			if m, ok := v.(map[string]interface{}); ok && m["name"] != nil {
+				prod = m
+				break
+			}
+		}
+	}
+	if prod == nil {
+		if p.Title == "" {
+			return nil, fmt.Errorf("could not find product data on page")
+		}
+		return p, nil
+	}
+
+	mp := parseMeeshoProduct(prod)
+	p.Title = firstNonEmpty(mp.Name, p.Title)
+	p.Description = firstNonEmpty(mp.Description, p.Description)
+	p.Category = mp.Category
+	p.setImages(append([]string{mp.Image}, mp.Images...))
+
+	price := mp.Price
+	if v, ok := prod["price"].(float64); ok && v > 0 {
+		price = int64(v)
+	}
+	if price > 0 {
+		p.Price = Rupees(price)
+	}
+	mrp := mp.CatalogPrice
+	if v, err := navigateJSON(prod, "mrp_details", "mrp"); err == nil {
+		if f, ok := v.(float64); ok {
+			mrp = int64(f)
+		}
+	} else if v, ok := prod["original_price"].(float64); ok {
+		mrp = int64(v)
+	}
+	if mrp > price {
+		p.OriginalPrice = Rupees(mrp)
+	}
+
+	p.Rating = firstNonEmpty(mp.Rating, p.Rating)
+	p.RatingCount = mp.RatingCount
+	if rs, err := navigateJSON(prod, "review_summary", "data"); err == nil {
+		if m, ok := rs.(map[string]interface{}); ok {
+			if v, ok := m["average_rating"].(float64); ok && v > 0 {
+				p.Rating = strconv.FormatFloat(v, 'f', 1, 64)
+			}
+			if v, ok := m["rating_count"].(float64); ok {
+				p.RatingCount = int64(v)
+			}
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,215 @@
+package srv
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubPages points pageFetcher at h for the rest of the test, whatever
+// host a URL names, as if every shop's pages were served by h over HTTPS.
+// The test server's certificate is checked as example.com's, the name it
+// was made for.
+func stubPages(t *testing.T, h http.Handler) {
+	t.Helper()
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+	tr := ts.Client().Transport.(*http.Transport).Clone()
+	tr.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, ts.Listener.Addr().String())
+	}
+	tr.TLSClientConfig = &tls.Config{RootCAs: tr.TLSClientConfig.RootCAs, ServerName: "example.com"}
+	f := newFetcher(5*time.Second, pageFetcher.maxBytes, pageFetcher.contentTypes, pageFetcher.hosts)
+	f.client.Transport = tr
+	old := pageFetcher
+	pageFetcher = f
+	t.Cleanup(func() { pageFetcher = old })
+}
+
+// The pages in testdata are product pages cut down to the parts the
+// scrapers read, plus decoys such as other products' prices that they
+// should skip. Each is served at its page URL and read with ScrapeProduct,
+// so the fetch, any short link's redirect and the choice of scraper are
+// tested along with the extraction.
+func TestScrapeProduct(t *testing.T) {
+	tests := []struct {
+		file string
+		// link is what the admin pastes, if not pageURL: a short link
+		// that redirects to it.
+		link        string
+		pageURL     string
+		platform    string
+		title       string
+		price       int64 // paise
+		original    int64
+		images      []string
+		rating      string
+		ratingCount int64
+		category    string
+	}{
+		{
+			// __NEXT_DATA__ JSON.
+			file:     "meesho_next_data.html",
+			pageURL:  "https://www.meesho.com/trendy-cotton-kurti/p/101",
+			platform: "Meesho",
+			title:    "Trendy Cotton Kurti",
+			price:    34900,
+			original: 59900,
+			images: []string{
+				"https://images.meesho.com/images/products/101/main_512.webp",
+				"https://images.meesho.com/images/products/101/back_512.webp",
+			},
+			rating:      "4.1",
+			ratingCount: 1234,
+			category:    "Kurtis",
+		},
+		{
+			// No __NEXT_DATA__: meta tags, then the page-wide regexes.
+			file:     "meesho_meta_only.html",
+			pageURL:  "https://www.meesho.com/floral-print-dupatta/p/202",
+			platform: "Meesho",
+			title:    "Floral Print Dupatta",
+			price:    22900,
+			images:   []string{"https://images.meesho.com/images/products/202/dupatta_512.jpg"},
+			rating:   "3.9",
+		},
+		{
+			file:     "amazon.html",
+			link:     "https://amzn.to/3bottle",
+			pageURL:  "https://www.amazon.in/dp/B0BOTTLE01",
+			platform: "Amazon",
+			title:    "Stainless Steel Water Bottle 1L",
+			price:    129900,
+			original: 249900,
+			images: []string{
+				"https://m.media-amazon.com/images/I/71bottle1._SL1500_.jpg",
+				"https://m.media-amazon.com/images/I/71bottle2._SL1500_.jpg",
+			},
+			rating:      "4.3",
+			ratingCount: 2345,
+			category:    "Water Bottles",
+		},
+		{
+			// a-price-whole and data-old-hires, from before the gallery
+			// script.
+			file:     "amazon_old_layout.html",
+			pageURL:  "https://www.amazon.in/dp/B0LAMP0001",
+			platform: "Amazon",
+			title:    "LED Desk Lamp",
+			price:    84900,
+			images:   []string{"https://m.media-amazon.com/images/I/61lamp._SL1200_.jpg"},
+		},
+		{
+			// JSON-LD, with the gallery from the thumbnail URLs.
+			file:     "flipkart.html",
+			link:     "https://fkrt.it/kurta",
+			pageURL:  "https://www.flipkart.com/men-printed-cotton-kurta/p/itm123",
+			platform: "Flipkart",
+			title:    "Men Printed Cotton Kurta",
+			price:    79900,
+			original: 199900,
+			images: []string{
+				"https://rukminim2.flixcart.com/image/832/832/xif0q/kurta/m/1/a/l-kurta-front.jpeg",
+				"https://rukminim2.flixcart.com/image/832/832/xif0q/kurta/m/1/a/l-kurta-back.jpeg",
+			},
+			rating:      "4.2",
+			ratingCount: 1520,
+			category:    "Men's Kurtas",
+		},
+		{
+			// JSON-LD @graph, relative images, a list price and
+			// breadcrumbs ending with the product.
+			file:     "shop_jsonld.html",
+			pageURL:  "https://claycorner.example.com/products/mug",
+			platform: "Other",
+			title:    "Hand-painted Ceramic Mug",
+			price:    44950,
+			original: 69900,
+			images: []string{
+				"https://claycorner.example.com/cdn/mug-front.jpg",
+				"https://claycorner.example.com/cdn/mug-side.jpg",
+			},
+			rating:      "4.6",
+			ratingCount: 87,
+			category:    "Mugs",
+		},
+		{
+			file:        "shop_microdata.html",
+			pageURL:     "https://puja.example.com/brass-diya-set",
+			platform:    "Other",
+			title:       "Brass Diya Set",
+			price:       119900,
+			images:      []string{"https://puja.example.com/img/diya-set.jpg"},
+			rating:      "4.8",
+			ratingCount: 56,
+			category:    "Puja Essentials",
+		},
+		{
+			// Nothing structured: Open Graph and the page-wide regexes.
+			file:     "shop_plain.html",
+			pageURL:  "https://craft.example.com/jute-bag",
+			platform: "Other",
+			title:    "Handmade Jute Bag",
+			price:    129900,
+			images:   []string{"https://craft.example.com/images/jute-bag.jpg"},
+			rating:   "4.2",
+		},
+	}
+	mux := http.NewServeMux()
+	for _, tt := range tests {
+		mux.HandleFunc(strings.TrimPrefix(tt.pageURL, "https://"), func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			http.ServeFile(w, r, "testdata/"+tt.file)
+		})
+		if tt.link != "" {
+			mux.Handle(strings.TrimPrefix(tt.link, "https://"), http.RedirectHandler(tt.pageURL, http.StatusMovedPermanently))
+		}
+	}
+	stubPages(t, mux)
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			p, err := ScrapeProduct(context.Background(), cmp.Or(tt.link, tt.pageURL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.URL != tt.pageURL {
+				t.Errorf("url = %q, want %q", p.URL, tt.pageURL)
+			}
+			if p.Platform != tt.platform {
+				t.Errorf("platform = %q, want %q", p.Platform, tt.platform)
+			}
+			if p.Title != tt.title {
+				t.Errorf("title = %q, want %q", p.Title, tt.title)
+			}
+			if p.Price.Paise() != tt.price {
+				t.Errorf("price_paise = %d, want %d", p.Price.Paise(), tt.price)
+			}
+			if p.OriginalPrice.Paise() != tt.original {
+				t.Errorf("original_price_paise = %d, want %d", p.OriginalPrice.Paise(), tt.original)
+			}
+			if !slices.Equal(p.Images, tt.images) {
+				t.Errorf("images = %q, want %q", p.Images, tt.images)
+			}
+			if len(tt.images) > 0 && p.ImageURL != tt.images[0] {
+				t.Errorf("image_url = %q, want %q", p.ImageURL, tt.images[0])
+			}
+			if p.Rating != tt.rating {
+				t.Errorf("rating = %q, want %q", p.Rating, tt.rating)
+			}
+			if p.RatingCount != tt.ratingCount {
+				t.Errorf("rating count = %d, want %d", p.RatingCount, tt.ratingCount)
+			}
+			if p.Category != tt.category {
+				t.Errorf("category = %q, want %q", p.Category, tt.category)
+			}
+		})
+	}
+}
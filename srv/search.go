@@ -0,0 +1,53 @@
+package srv
+
+import (
+	"html"
+	"html/template"
+	"strings"
+	"unicode"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// searchResult is a product plus its highlighted title and snippet, already
+// HTML-escaped with matches wrapped in <mark>.
+type searchResult struct {
+	dbgen.Product
+	TitleHTML   template.HTML
+	SnippetHTML template.HTML
+}
+
+// ftsQuery turns free text into an FTS5 MATCH expression. Every word must
+// match, in any order and any column, and each word also matches as a
+// prefix: "pink nail" becomes `"pink"* "nail"*` and finds "Nail Art Pink".
+// Quoting each word keeps FTS5 operators and punctuation in user input from
+// being interpreted as query syntax. It returns "" when there are no words.
+func ftsQuery(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, w := range words {
+		words[i] = `"` + w + `"*`
+	}
+	return strings.Join(words, " ")
+}
+
+// markHighlights escapes FTS5 highlight()/snippet() output and replaces the
+// \x02/\x03 markers used by SearchProducts with <mark> tags.
+func markHighlights(s string) template.HTML {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, "\x02", "<mark>")
+	return template.HTML(strings.ReplaceAll(s, "\x03", "</mark>"))
+}
+
+func toSearchResults(rows []dbgen.SearchProductsRow) []searchResult {
+	out := make([]searchResult, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, searchResult{
+			Product:     r.Product,
+			TitleHTML:   markHighlights(r.TitleHighlight),
+			SnippetHTML: markHighlights(r.Snippet),
+		})
+	}
+	return out
+}
@@ -1,39 +1,54 @@
 package srv
 
 import (
-	"cmp"
-	"crypto/rand"
-	"crypto/sha256"
+	"context"
 	"database/sql"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"html/template"
+	"io/fs"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
-	"slices"
 	"strconv"
 	"strings"
-	"text/template"
+	"sync/atomic"
+	"time"
 
 	"srv.exe.dev/db"
 	"srv.exe.dev/db/dbgen"
 )
 
 type Server struct {
-	DB           *sql.DB
+	DB             *sql.DB
 	Hostname       string
-	TemplatesDir   string
-	StaticDir      string
 	UploadsDir     string
-	AdminPassword  string
-	adminTokenHash [32]byte
+	OutOfStock     string        // StockShow, StockDemote or StockHide
+	Proxy          string        // ProxyNone, ProxyFly, ProxyRender or ProxyXFF
+	SyncEvery      time.Duration // how often to re-scrape the catalogue, 0 for never
+	ImportWorkers  int           // imports that can run at once
+	ImageCacheSize int64         // bytes of disk for images cached by /img
+	ImageMemory    int64         // bytes of memory for an image being resized or uploaded
+
+	assets    fs.FS // templates/ and static/, see assetFS
+	dev       bool  // reload assets when they change on disk
+	templates *templateSet
+	static    *staticFiles
+
+	syncRunning  atomic.Bool
+	imports      *importQueue
+	images       *imageCache
+	placeholders *placeholders
 }
 
-func New(dbPath, hostname, adminPassword string) (*Server, error) {
+// New opens the database and loads the built-in templates and static
+// files, overridden by any in themeDir. With dev set they are read from
+// the source tree and reloaded as they change.
+func New(dbPath, hostname, adminPassword, themeDir string, dev bool) (*Server, error) {
 	_, thisFile, _, _ := runtime.Caller(0)
 	baseDir := filepath.Dir(thisFile)
 	uploadsDir := filepath.Join(filepath.Dir(baseDir), "uploads")
@@ -42,47 +57,39 @@ func New(dbPath, hostname, adminPassword string) (*Server, error) {
 	}
 	os.MkdirAll(uploadsDir, 0755)
 	srv := &Server{
-		Hostname:      hostname,
-		TemplatesDir:  filepath.Join(baseDir, "templates"),
-		StaticDir:     filepath.Join(baseDir, "static"),
-		UploadsDir:    uploadsDir,
-		AdminPassword: adminPassword,
-	}
-	// Generate a stable session token from the password
-	srv.adminTokenHash = sha256.Sum256([]byte("shukarsh-admin-" + adminPassword))
-	if err := srv.setUpDatabase(dbPath); err != nil {
+		Hostname:       hostname,
+		UploadsDir:     uploadsDir,
+		OutOfStock:     StockDemote,
+		Proxy:          ProxyNone,
+		ImportWorkers:  2,
+		ImageCacheSize: 256 << 20,
+		ImageMemory:    96 << 20,
+		imports:        newImportQueue(),
+		placeholders:   newPlaceholders(),
+		assets:         assetFS(themeDir, dev),
+		dev:            dev,
+	}
+	staticFS, err := fs.Sub(srv.assets, "static")
+	if err != nil {
 		return nil, err
 	}
-	return srv, nil
-}
-
-func (s *Server) adminToken() string {
-	return hex.EncodeToString(s.adminTokenHash[:16])
-}
-
-func (s *Server) isAdminAuthed(r *http.Request) bool {
-	if s.AdminPassword == "" {
-		return true // no password set, open access
+	if srv.static, err = loadStatic(staticFS); err != nil {
+		return nil, fmt.Errorf("static files: %w", err)
 	}
-	c, err := r.Cookie("admin_token")
+	srv.templates, err = loadTemplates(srv.assets, template.FuncMap{
+		"asset":  srv.static.URL,
+		"imgSet": srv.imgSet,
+	})
 	if err != nil {
-		return false
+		return nil, fmt.Errorf("templates: %w", err)
 	}
-	return c.Value == s.adminToken()
-}
-
-func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if !s.isAdminAuthed(r) {
-			if r.Header.Get("Content-Type") == "application/json" || strings.HasPrefix(r.URL.Path, "/api/") {
-				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
-				return
-			}
-			http.Redirect(w, r, "/admin/login", http.StatusFound)
-			return
-		}
-		next(w, r)
+	if err := srv.setUpDatabase(dbPath); err != nil {
+		return nil, err
 	}
+	if err := srv.bootstrapOwner(context.Background(), adminPassword); err != nil {
+		return nil, fmt.Errorf("create owner account: %w", err)
+	}
+	return srv, nil
 }
 
 func (s *Server) setUpDatabase(dbPath string) error {
@@ -112,63 +119,94 @@ func (s *Server) trackView(r *http.Request, productID *int64) {
 	})
 }
 
+// Serve starts the background workers and serves the site on addr.
 func (s *Server) Serve(addr string) error {
+	if s.dev {
+		go s.watchAssets(time.Second)
+	}
+	s.images = newImageCache(filepath.Join(s.UploadsDir, "cache"), s.ImageCacheSize)
+	s.startPlaceholders()
+	s.startImportWorkers()
+	if s.SyncEvery > 0 {
+		go s.scheduleSync()
+	}
+	slog.Info("starting server", "addr", addr)
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+// Handler returns the site's routes.
+func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /{$}", s.handleHome)
 	mux.HandleFunc("GET /product/{id}", s.handleProductDetail)
 	mux.HandleFunc("GET /search", s.handleSearch)
 	mux.HandleFunc("GET /category/{name}", s.handleCategory)
-	mux.HandleFunc("GET /admin", s.requireAdmin(s.handleAdmin))
-	mux.HandleFunc("GET /admin/analytics", s.requireAdmin(s.handleAnalytics))
+	mux.HandleFunc("GET /admin", s.requireAdmin(permEditCatalog, s.handleAdmin))
+	mux.HandleFunc("GET /admin/analytics", s.requireAdmin(permViewAnalytics, s.handleAnalytics))
 	mux.HandleFunc("POST /api/wa-click", s.handleWAClick)
 	mux.HandleFunc("GET /admin/login", s.handleAdminLogin)
 	mux.HandleFunc("POST /admin/login", s.handleAdminLoginPost)
-	mux.HandleFunc("GET /admin/logout", s.handleAdminLogout)
-	mux.HandleFunc("POST /api/add", s.requireAdmin(s.handleAddProduct))
-	mux.HandleFunc("POST /api/update/{id}", s.requireAdmin(s.handleUpdateProduct))
-	mux.HandleFunc("POST /api/delete/{id}", s.requireAdmin(s.handleDeleteProduct))
+	mux.HandleFunc("GET /admin/login/2fa", s.handleAdminLogin2FA)
+	mux.HandleFunc("POST /admin/login/2fa", s.handleAdminLogin2FAPost)
+	mux.HandleFunc("POST /admin/logout", s.handleAdminLogout)
+	mux.HandleFunc("GET /admin/account", s.requireAdmin(permOwnAccount, s.handleAccount))
+	mux.HandleFunc("GET /api/account/totp", s.requireAdmin(permOwnAccount, s.handleAccountTOTP))
+	mux.HandleFunc("POST /api/account/totp/setup", s.requireAdmin(permOwnAccount, s.handleAccountTOTPSetup))
+	mux.HandleFunc("POST /api/account/totp/enable", s.requireAdmin(permOwnAccount, s.handleAccountTOTPEnable))
+	mux.HandleFunc("POST /api/account/totp/disable", s.requireAdmin(permOwnAccount, s.handleAccountTOTPDisable))
+	mux.HandleFunc("POST /api/account/recovery-codes", s.requireAdmin(permOwnAccount, s.handleAccountRecoveryCodes))
+	mux.HandleFunc("POST /api/add", s.requireAdmin(permEditCatalog, s.handleAddProduct))
+	mux.HandleFunc("POST /api/update/{id}", s.requireAdmin(permEditCatalog, s.handleUpdateProduct))
+	mux.HandleFunc("POST /api/delete/{id}", s.requireAdmin(permEditCatalog, s.handleDeleteProduct))
+	mux.HandleFunc("POST /api/stock/{id}", s.requireAdmin(permEditCatalog, s.handleStockAdjust))
+	mux.HandleFunc("GET /api/stock/{id}", s.requireAdmin(permEditCatalog, s.handleStockLog))
+	mux.HandleFunc("GET /api/users", s.requireAdmin(permManageUsers, s.handleListUsers))
+	mux.HandleFunc("POST /api/users", s.requireAdmin(permManageUsers, s.handleAddUser))
+	mux.HandleFunc("POST /api/users/{id}", s.requireAdmin(permManageUsers, s.handleUpdateUser))
+	mux.HandleFunc("POST /api/users/{id}/delete", s.requireAdmin(permManageUsers, s.handleDeleteUser))
+	mux.HandleFunc("POST /api/sessions/{id}/revoke", s.requireAdmin(permManageUsers, s.handleRevokeSession))
+	mux.HandleFunc("GET /admin/audit", s.requireAdmin(permEditCatalog, s.handleAudit))
+	mux.HandleFunc("POST /api/audit/{id}/revert", s.requireAdmin(permEditCatalog, s.handleAuditRevert))
+	mux.HandleFunc("GET /admin/sync", s.requireAdmin(permEditCatalog, s.handleSync))
+	mux.HandleFunc("POST /api/sync/run", s.requireAdmin(permEditCatalog, s.handleSyncRun))
+	mux.HandleFunc("GET /api/login-attempts", s.requireAdmin(permManageUsers, s.handleLoginAttempts))
 	mux.HandleFunc("GET /api/products", s.handleListProducts)
 	mux.HandleFunc("GET /api/product/{id}", s.handleGetProduct)
-	mux.HandleFunc("GET /img", handleImageProxy)
+	mux.HandleFunc("GET /img", s.handleImageProxy)
 	mux.HandleFunc("GET /api/qr", handleQRCode)
-	mux.HandleFunc("POST /api/upload", s.requireAdmin(s.handleUploadImage))
-	mux.HandleFunc("POST /api/bulk-import", s.requireAdmin(s.handleBulkImport))
-	mux.HandleFunc("GET /api/bulk-import/status", s.handleBulkImportStatus)
-	mux.HandleFunc("POST /api/bulk-import/json", s.requireAdmin(s.handleBulkImportJSON))
+	mux.HandleFunc("POST /api/upload", s.requireAdmin(permEditCatalog, s.handleUploadImage))
+	mux.HandleFunc("POST /api/bulk-import", s.requireAdmin(permEditCatalog, s.handleBulkImport))
+	mux.HandleFunc("GET /api/bulk-import/status", s.requireAdmin(permEditCatalog, s.handleBulkImportStatus))
+	mux.HandleFunc("POST /api/bulk-import/json", s.requireAdmin(permEditCatalog, s.handleBulkImportJSON))
+	mux.HandleFunc("GET /api/export.csv", s.requireAdmin(permEditCatalog, s.handleExportCatalog))
+	mux.HandleFunc("GET /api/export.xlsx", s.requireAdmin(permEditCatalog, s.handleExportCatalog))
+	mux.HandleFunc("POST /api/catalog/import", s.requireAdmin(permEditCatalog, s.handleImportCatalog))
+	mux.HandleFunc("GET /admin/imports", s.requireAdmin(permEditCatalog, s.handleImportJobs))
+	mux.HandleFunc("POST /api/import-jobs/{id}/cancel", s.requireAdmin(permEditCatalog, s.handleImportJobCancel))
+	mux.HandleFunc("POST /api/import-jobs/{id}/retry", s.requireAdmin(permEditCatalog, s.handleImportJobRetry))
+	mux.HandleFunc("GET /api/import-jobs/{id}/items", s.requireAdmin(permEditCatalog, s.handleImportJobItems))
+	mux.HandleFunc("POST /api/import-jobs/{id}/commit", s.requireAdmin(permEditCatalog, s.handleImportJobCommit))
 	mux.HandleFunc("GET /sitemap.xml", s.handleSitemap)
 	mux.HandleFunc("GET /robots.txt", s.handleRobotsTxt)
 	mux.HandleFunc("GET /ads.txt", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, filepath.Join(s.StaticDir, "ads.txt"))
+		http.ServeFileFS(w, r, s.static.fsys, "ads.txt")
 	})
-	mux.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir(s.UploadsDir))))
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(s.StaticDir))))
-	slog.Info("starting server", "addr", addr)
-	return http.ListenAndServe(addr, mux)
-}
-
-// parsePrice extracts a numeric price from strings like "₹370", "Rs. 1,234", etc.
-func parsePrice(s string) float64 {
-	var buf strings.Builder
-	for _, c := range s {
-		if (c >= '0' && c <= '9') || c == '.' {
-			buf.WriteRune(c)
-		}
-	}
-	v, _ := strconv.ParseFloat(buf.String(), 64)
-	return v
+	uploads := http.StripPrefix("/uploads/", http.FileServer(http.Dir(s.UploadsDir)))
+	mux.Handle("/uploads/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Files uploaded before uploads were checked could be anything
+		// named .png; this keeps browsers from reading them as HTML.
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		uploads.ServeHTTP(w, r)
+	}))
+	// The image cache lives in UploadsDir but is only served through /img.
+	mux.Handle("/uploads/cache/", http.NotFoundHandler())
+	mux.Handle("/static/", s.static)
+	return mux
 }
 
 var funcMap = template.FuncMap{
 	"lower": strings.ToLower,
-	"mul": func(a, b int) int { return a * b },
-	"discountPct": func(price, origPrice string) int {
-		p := parsePrice(price)
-		o := parsePrice(origPrice)
-		if o <= 0 || p <= 0 || o <= p {
-			return 0
-		}
-		return int(((o - p) / o) * 100)
-	},
+	"mul":   func(a, b int) int { return a * b },
 	"catEmoji": func(cat string) string {
 		switch cat {
 		case "Nails & Beauty":
@@ -217,27 +255,35 @@ var funcMap = template.FuncMap{
 		json.Unmarshal([]byte(s), &imgs)
 		return imgs
 	},
-	"json": func(v any) string {
-		b, _ := json.Marshal(v)
-		return string(b)
-	},
-	"fmtPrice": func(price string) string {
-		if price == "" {
+	"fmtPrice": func(paise int64) string {
+		if paise == 0 {
 			return ""
 		}
-		p := strings.TrimSpace(price)
-		if strings.HasPrefix(p, "₹") || strings.HasPrefix(p, "Rs") {
-			return p
+		return Money(paise).String()
+	},
+	// decimalPrice is the amount as "1299.00", for meta tags.
+	"decimalPrice": func(paise int64) string {
+		return Money(paise).Decimal()
+	},
+	"imgSrc": func(u string) string {
+		if strings.HasPrefix(u, "/uploads/") || strings.HasPrefix(u, "/static/") {
+			return u
 		}
-		return "₹" + p
+		return "/img?url=" + url.QueryEscape(u)
 	},
-	"imgSrc": func(url string) string {
-		if strings.HasPrefix(url, "/uploads/") || strings.HasPrefix(url, "/static/") {
-			return url
+	// thumbSrc is imgSrc for a square thumbnail of side w pixels, twice
+	// the size shown so it stays sharp on high-density screens.
+	"thumbSrc": func(u string, w int) string {
+		if strings.HasPrefix(u, "/static/") {
+			return u
 		}
-		return "/img?url=" + url
+		return fmt.Sprintf("/img?url=%s&w=%d&h=%d&fit=cover", url.QueryEscape(u), w, w)
+	},
+	"add":          func(a, b int) int { return a + b },
+	"variantLabel": variantLabel,
+	"soldOut": func(stock *int64) bool {
+		return stock != nil && *stock <= 0
 	},
-	"add": func(a, b int) int { return a + b },
 	"truncate": func(s string, n int) string {
 		if len(s) <= n {
 			return s
@@ -254,6 +300,7 @@ func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 500)
 		return
 	}
+	products = s.applyStockPolicy(products)
 	catMap := map[string][]dbgen.Product{}
 	catOrder := []string{}
 	for _, p := range products {
@@ -268,24 +315,21 @@ func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 	}
 	newArrivals, _ := q.ListNewArrivals(r.Context())
 	bestSellers, _ := q.ListBestSellers(r.Context())
+	newArrivals = s.applyStockPolicy(newArrivals)
+	bestSellers = s.applyStockPolicy(bestSellers)
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	tmpl, err := template.New("home.html").Funcs(funcMap).ParseFiles(filepath.Join(s.TemplatesDir, "home.html"))
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
-	}
-	// Build featured products for hero carousel (bestsellers + new arrivals, deduplicated)
+	// Build featured products for hero carousel (bestsellers + new arrivals, deduplicated,
+	// never sold out)
 	featuredMap := map[int64]bool{}
 	var featured []dbgen.Product
 	for _, p := range bestSellers {
-		if !featuredMap[p.ID] {
+		if !featuredMap[p.ID] && p.InStock == 1 {
 			featuredMap[p.ID] = true
 			featured = append(featured, p)
 		}
 	}
 	for _, p := range newArrivals {
-		if !featuredMap[p.ID] {
+		if !featuredMap[p.ID] && p.InStock == 1 {
 			featuredMap[p.ID] = true
 			featured = append(featured, p)
 		}
@@ -295,7 +339,7 @@ func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 		if len(featured) >= 5 {
 			break
 		}
-		if !featuredMap[p.ID] {
+		if !featuredMap[p.ID] && p.InStock == 1 {
 			featuredMap[p.ID] = true
 			featured = append(featured, p)
 		}
@@ -310,7 +354,7 @@ func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 	uniqueVisitors, _ := q.UniqueVisitors(r.Context())
 	waClicks, _ := q.TotalWAClicks(r.Context())
 
-	tmpl.Execute(w, map[string]any{
+	s.templates.render(w, "home.html", map[string]any{
 		"Products":       products,
 		"Categories":     catOrder,
 		"ByCategory":     catMap,
@@ -345,7 +389,7 @@ func (s *Server) handleProductDetail(w http.ResponseWriter, r *http.Request) {
 	}
 	// Filter out current product and limit to 4
 	var filteredRelated []dbgen.Product
-	for _, rp := range related {
+	for _, rp := range s.applyStockPolicy(related) {
 		if rp.ID != product.ID {
 			filteredRelated = append(filteredRelated, rp)
 		}
@@ -362,82 +406,59 @@ func (s *Server) handleProductDetail(w http.ResponseWriter, r *http.Request) {
 	if len(images) == 0 && product.ImageUrl != "" {
 		images = []string{product.ImageUrl}
 	}
+	variants, _ := q.ListProductVariants(r.Context(), id)
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	tmpl, err := template.New("product.html").Funcs(funcMap).ParseFiles(filepath.Join(s.TemplatesDir, "product.html"))
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
-	}
-	tmpl.Execute(w, map[string]any{
+	s.templates.render(w, "product.html", map[string]any{
 		"Product":  product,
 		"Images":   images,
+		"Variants": variants,
 		"Related":  filteredRelated,
 	})
 }
 
 func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 	go s.trackView(r, nil)
-	query := r.URL.Query().Get("q")
-	var products []dbgen.Product
-	if query != "" {
-		q := dbgen.New(s.DB)
-		like := "%" + query + "%"
-		products, _ = q.SearchProducts(r.Context(), dbgen.SearchProductsParams{
-			Title:       like,
-			Description: like,
-			Category:    like,
-		})
-	}
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	tmpl, err := template.New("search.html").Funcs(funcMap).ParseFiles(filepath.Join(s.TemplatesDir, "search.html"))
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+	f := parseListingFilter(r.URL.Query())
+	var results []searchResult
+	var total int64
+	var counts facetCounts
+	if match := ftsQuery(f.Query); match != "" {
+		var err error
+		results, total, counts, err = s.searchListing(r.Context(), match, f)
+		if err != nil {
+			slog.Warn("search", "query", f.Query, "err", err)
+		}
 	}
-	tmpl.Execute(w, map[string]any{
-		"Query":    query,
-		"Products": products,
-		"Count":    len(products),
+	s.templates.render(w, "search.html", map[string]any{
+		"Query":    f.Query,
+		"Products": results,
+		"Count":    total,
+		"Filter":   f,
+		"Facets":   f.facets(counts),
+		"Page":     f.Page,
+		"Pages":    pageCount(total),
 	})
 }
 
 func (s *Server) handleCategory(w http.ResponseWriter, r *http.Request) {
 	go s.trackView(r, nil)
 	catName := r.PathValue("name")
-	q := dbgen.New(s.DB)
-	products, _ := q.ListProductsByCategory(r.Context(), catName)
-	categories, _ := q.ListCategories(r.Context())
-
-	sort := r.URL.Query().Get("sort")
-	switch sort {
-	case "price-asc":
-		slices.SortFunc(products, func(a, b dbgen.Product) int {
-			return cmp.Compare(parsePrice(a.Price), parsePrice(b.Price))
-		})
-	case "price-desc":
-		slices.SortFunc(products, func(a, b dbgen.Product) int {
-			return cmp.Compare(parsePrice(b.Price), parsePrice(a.Price))
-		})
-	case "newest":
-		// already sorted by added_at DESC from query
-	case "bestseller":
-		slices.SortFunc(products, func(a, b dbgen.Product) int {
-			return cmp.Compare(b.IsBestseller, a.IsBestseller)
-		})
-	}
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	tmpl, err := template.New("category.html").Funcs(funcMap).ParseFiles(filepath.Join(s.TemplatesDir, "category.html"))
+	f := parseListingFilter(r.URL.Query())
+	products, total, counts, err := s.listCategory(r.Context(), catName, f)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+		slog.Warn("category listing", "category", catName, "err", err)
 	}
-	tmpl.Execute(w, map[string]any{
+	categories, _ := dbgen.New(s.DB).ListCategories(r.Context())
+
+	s.templates.render(w, "category.html", map[string]any{
 		"Category":   catName,
 		"Products":   products,
-		"Count":      len(products),
-		"Sort":       sort,
+		"Count":      total,
+		"Sort":       f.Sort,
+		"Filter":     f,
+		"Facets":     f.facets(counts),
+		"Page":       f.Page,
+		"Pages":      pageCount(total),
 		"Categories": categories,
 	})
 }
@@ -450,11 +471,17 @@ func (s *Server) handleWAClick(w http.ResponseWriter, r *http.Request) {
 			pid = &id
 		}
 	}
+	var vid *int64
+	if v := r.FormValue("variant_id"); v != "" {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			vid = &id
+		}
+	}
 	clickType := r.FormValue("type")
 	if clickType == "" {
 		clickType = "order"
 	}
-	q.InsertWAClick(r.Context(), dbgen.InsertWAClickParams{ProductID: pid, ClickType: clickType})
+	q.InsertWAClick(r.Context(), dbgen.InsertWAClickParams{ProductID: pid, ClickType: clickType, VariantID: vid})
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"ok":true}`))
 }
@@ -474,13 +501,10 @@ func (s *Server) handleAnalytics(w http.ResponseWriter, r *http.Request) {
 		productCount = len(products)
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	tmpl, err := template.New("analytics.html").Funcs(funcMap).ParseFiles(filepath.Join(s.TemplatesDir, "analytics.html"))
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
-	}
-	tmpl.Execute(w, map[string]any{
+	u := adminUser(r.Context())
+	s.templates.render(w, "analytics.html", map[string]any{
+		"Nav":            "analytics",
+		"CSRFToken":      s.csrfToken(w, r),
 		"ViewsPerDay":    viewsPerDay,
 		"TopProducts":    topProducts,
 		"TotalViews":     totalViews,
@@ -490,15 +514,32 @@ func (s *Server) handleAnalytics(w http.ResponseWriter, r *http.Request) {
 		"UniqueVisitors": uniqueVisitors,
 		"WAByType":       waByType,
 		"ProductCount":   productCount,
+		"CanEditCatalog": u == nil || roleAllows(u.Role, permEditCatalog),
+		"SignedIn":       u != nil,
 	})
 }
 
 func (s *Server) handleAdminLogin(w http.ResponseWriter, r *http.Request) {
-	if s.AdminPassword == "" || s.isAdminAuthed(r) {
+	if _, ok := s.currentSession(r); ok || s.adminOpen(r.Context()) {
 		http.Redirect(w, r, "/admin", http.StatusFound)
 		return
 	}
-	errMsg := r.URL.Query().Get("error")
+	csrf := s.csrfToken(w, r)
+	writeLoginPage(w, r.URL.Query().Get("error"), `  <form method="POST" action="/admin/login">
+    <input type="hidden" name="csrf_token" value="`+template.HTMLEscapeString(csrf)+`">
+    <div class="field">
+      <input type="text" name="username" placeholder="Username" autocomplete="username" autofocus required>
+    </div>
+    <div class="field">
+      <input type="password" name="password" placeholder="Password" autocomplete="current-password" required>
+    </div>
+    <button type="submit" class="btn">Login →</button>
+  </form>`)
+}
+
+// writeLoginPage renders the login card with an optional error and the
+// given form, for both steps of the login.
+func writeLoginPage(w http.ResponseWriter, errMsg, form string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	fmt.Fprintf(w, `<!DOCTYPE html>
 <html lang="en">
@@ -531,12 +572,7 @@ body{font-family:'Nunito',sans-serif;background:var(--bg);min-height:100vh;displ
   <div class="logo">Shukarsh</div>
   <div class="sub">Admin Panel</div>
   %s
-  <form method="POST" action="/admin/login">
-    <div class="field">
-      <input type="password" name="password" placeholder="Enter admin password" autofocus required>
-    </div>
-    <button type="submit" class="btn">Login →</button>
-  </form>
+%s
   <a href="/" class="back">← Back to Store</a>
 </div>
 </body>
@@ -546,29 +582,71 @@ body{font-family:'Nunito',sans-serif;background:var(--bg);min-height:100vh;displ
 				return `<div class="error">❌ ` + template.HTMLEscapeString(errMsg) + `</div>`
 			}
 			return ""
-		}())
+		}(), form)
 }
 
 func (s *Server) handleAdminLoginPost(w http.ResponseWriter, r *http.Request) {
-	password := r.FormValue("password")
-	if password != s.AdminPassword {
-		http.Redirect(w, r, "/admin/login?error=Wrong+password", http.StatusFound)
+	if !validCSRF(r, nil) {
+		http.Redirect(w, r, "/admin/login?error="+url.QueryEscape("Login form expired, please try again"), http.StatusFound)
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     "admin_token",
-		Value:    s.adminToken(),
-		Path:     "/",
-		MaxAge:   86400 * 7, // 7 days
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	})
-	http.Redirect(w, r, "/admin", http.StatusFound)
+	ip := s.clientIP(r)
+	username := strings.TrimSpace(r.FormValue("username"))
+	wait, err := s.loginWait(r.Context(), ip, username)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if wait > 0 {
+		s.recordLogin(r, ip, username, "throttled")
+		msg := fmt.Sprintf("Too many failed attempts, try again in %s", wait.Round(time.Second))
+		http.Redirect(w, r, "/admin/login?error="+url.QueryEscape(msg), http.StatusFound)
+		return
+	}
+	s.slowLogins(r.Context())
+	u, err := s.authenticate(r.Context(), username, r.FormValue("password"))
+	if err != nil {
+		reason := "error"
+		switch err {
+		case errUnknownUser:
+			reason = "unknown user"
+		case errWrongPassword:
+			reason = "wrong password"
+		case errAccountDisabled:
+			reason = "disabled"
+		}
+		s.recordLogin(r, ip, username, reason)
+		http.Redirect(w, r, "/admin/login?error="+url.QueryEscape(err.Error()), http.StatusFound)
+		return
+	}
+	if u.TotpEnabled == 1 {
+		// The attempt is only logged as a success after the second step, so
+		// a known password doesn't reset the failure count for code guesses.
+		if err := s.startSession(w, r, u, true); err != nil {
+			http.Error(w, "Failed to start session: "+err.Error(), 500)
+			return
+		}
+		http.Redirect(w, r, "/admin/login/2fa", http.StatusFound)
+		return
+	}
+	s.recordLogin(r, ip, u.Username, "")
+	if err := s.startSession(w, r, u, false); err != nil {
+		http.Error(w, "Failed to start session: "+err.Error(), 500)
+		return
+	}
+	s.redirectAfterLogin(w, r, u)
 }
 
 func (s *Server) handleAdminLogout(w http.ResponseWriter, r *http.Request) {
+	if sess, ok := s.currentSession(r); ok {
+		if !validCSRF(r, sess) {
+			http.Error(w, "invalid or missing CSRF token", http.StatusForbidden)
+			return
+		}
+		dbgen.New(s.DB).RevokeSession(r.Context(), sess.Session.ID)
+	}
 	http.SetCookie(w, &http.Cookie{
-		Name:   "admin_token",
+		Name:   sessionCookie,
 		Value:  "",
 		Path:   "/",
 		MaxAge: -1,
@@ -579,13 +657,13 @@ func (s *Server) handleAdminLogout(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
 	q := dbgen.New(s.DB)
 	products, _ := q.ListProducts(r.Context())
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	tmpl, err := template.ParseFiles(filepath.Join(s.TemplatesDir, "admin.html"))
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
-	}
-	tmpl.Execute(w, map[string]any{"Products": products})
+	u := adminUser(r.Context())
+	s.templates.render(w, "admin.html", map[string]any{
+		"CSRFToken":      s.csrfToken(w, r),
+		"Products":       products,
+		"User":           u,
+		"CanManageUsers": u == nil || roleAllows(u.Role, permManageUsers),
+	})
 }
 
 func (s *Server) handleAddProduct(w http.ResponseWriter, r *http.Request) {
@@ -593,18 +671,28 @@ func (s *Server) handleAddProduct(w http.ResponseWriter, r *http.Request) {
 	var params dbgen.InsertProductParams
 
 	if mode == "manual" {
+		price, err := ParseMoney(r.FormValue("price"))
+		if err != nil {
+			jsonError(w, "Invalid price: "+err.Error(), 400)
+			return
+		}
+		origPrice, err := ParseMoney(r.FormValue("original_price"))
+		if err != nil {
+			jsonError(w, "Invalid original price: "+err.Error(), 400)
+			return
+		}
 		params = dbgen.InsertProductParams{
-			Url:             r.FormValue("url"),
-			Platform:        r.FormValue("platform"),
-			Title:           r.FormValue("title"),
-			Price:           r.FormValue("price"),
-			OriginalPrice:   r.FormValue("original_price"),
-			ImageUrl:        r.FormValue("image_url"),
-			Description:     r.FormValue("description"),
-			Rating:          r.FormValue("rating"),
-			Category:        r.FormValue("category"),
-			Images:          r.FormValue("images"),
-			LongDescription: r.FormValue("long_description"),
+			Url:                r.FormValue("url"),
+			Platform:           r.FormValue("platform"),
+			Title:              r.FormValue("title"),
+			PricePaise:         price.Paise(),
+			OriginalPricePaise: origPrice.Paise(),
+			ImageUrl:           r.FormValue("image_url"),
+			Description:        r.FormValue("description"),
+			Rating:             r.FormValue("rating"),
+			Category:           r.FormValue("category"),
+			Images:             r.FormValue("images"),
+			LongDescription:    r.FormValue("long_description"),
 		}
 		if params.Title == "" {
 			jsonError(w, "Title is required", 400)
@@ -622,32 +710,69 @@ func (s *Server) handleAddProduct(w http.ResponseWriter, r *http.Request) {
 			jsonError(w, "URL is required", 400)
 			return
 		}
-		info, err := ScrapeProduct(url)
+		info, err := ScrapeProduct(r.Context(), url)
 		if err != nil {
 			jsonError(w, "Failed to scrape: "+err.Error(), 400)
 			return
 		}
+		images := "[]"
+		if len(info.Images) > 0 {
+			b, _ := json.Marshal(info.Images)
+			images = string(b)
+		}
 		params = dbgen.InsertProductParams{
-			Url:           info.URL,
-			Platform:      info.Platform,
-			Title:         info.Title,
-			Price:         info.Price,
-			OriginalPrice: info.OriginalPrice,
-			ImageUrl:      info.ImageURL,
-			Description:   info.Description,
-			Rating:        info.Rating,
-			Category:      autoCategory(info.Title),
+			Url:                info.URL,
+			Platform:           info.Platform,
+			Title:              info.Title,
+			PricePaise:         info.Price.Paise(),
+			OriginalPricePaise: info.OriginalPrice.Paise(),
+			ImageUrl:           info.ImageURL,
+			Description:        info.Description,
+			Rating:             info.Rating,
+			Category:           productCategory(info),
+			Images:             images,
 		}
 	}
 
-	q := dbgen.New(s.DB)
+	variants, _, err := parseVariants(r)
+	if err != nil {
+		jsonError(w, err.Error(), 400)
+		return
+	}
+
+	tx, err := s.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		jsonError(w, "Failed to save: "+err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	q := dbgen.New(tx)
 	p, err := q.InsertProduct(r.Context(), params)
 	if err != nil {
 		jsonError(w, "Failed to save: "+err.Error(), 500)
 		return
 	}
+	if err := saveVariants(r.Context(), q, p.ID, variants); err != nil {
+		jsonError(w, "Failed to save variants: "+err.Error(), 400)
+		return
+	}
+	pvs, _ := q.ListProductVariants(r.Context(), p.ID)
+	after, err := snapshotProduct(r.Context(), q, p.ID)
+	if err == nil {
+		err = logAudit(r.Context(), q, s.auditActor(r), auditAdd, &p.ID, nil, after)
+	}
+	if err != nil {
+		jsonError(w, "Failed to save: "+err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to save: "+err.Error(), 500)
+		return
+	}
+	ap := toAPIProduct(p)
+	ap.Variants = toAPIVariants(pvs)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"ok": true, "product": p})
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "product": ap})
 }
 
 func (s *Server) handleUpdateProduct(w http.ResponseWriter, r *http.Request) {
@@ -670,13 +795,19 @@ func (s *Server) handleUpdateProduct(w http.ResponseWriter, r *http.Request) {
 	if title == "" {
 		title = p.Title
 	}
-	price := r.FormValue("price")
-	if price == "" {
-		price = p.Price
+	price := Money(p.PricePaise)
+	if v := r.FormValue("price"); v != "" {
+		if price, err = ParseMoney(v); err != nil {
+			jsonError(w, "Invalid price: "+err.Error(), 400)
+			return
+		}
 	}
-	origPrice := r.FormValue("original_price")
-	if origPrice == "" {
-		origPrice = p.OriginalPrice
+	origPrice := Money(p.OriginalPricePaise)
+	if v := r.FormValue("original_price"); v != "" {
+		if origPrice, err = ParseMoney(v); err != nil {
+			jsonError(w, "Invalid original price: "+err.Error(), 400)
+			return
+		}
 	}
 	imageUrl := r.FormValue("image_url")
 	if imageUrl == "" {
@@ -720,30 +851,69 @@ func (s *Server) handleUpdateProduct(w http.ResponseWriter, r *http.Request) {
 		isBestseller, _ = strconv.ParseInt(v, 10, 64)
 	}
 
-	err = q.UpdateProduct(r.Context(), dbgen.UpdateProductParams{
-		Title:           title,
-		Price:           price,
-		OriginalPrice:   origPrice,
-		ImageUrl:        imageUrl,
-		Description:     desc,
-		Rating:          rating,
-		Category:        category,
-		Images:          images,
-		LongDescription: longDesc,
-		Url:             url,
-		Platform:        platform,
-		IsNew:           isNew,
-		IsBestseller:    isBestseller,
-		ID:              id,
+	variants, setVariants, err := parseVariants(r)
+	if err != nil {
+		jsonError(w, err.Error(), 400)
+		return
+	}
+
+	tx, err := s.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		jsonError(w, "Failed to update: "+err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	qtx := q.WithTx(tx)
+	before, err := snapshotProduct(r.Context(), qtx, id)
+	if err != nil {
+		jsonError(w, "Failed to update: "+err.Error(), 500)
+		return
+	}
+	err = qtx.UpdateProduct(r.Context(), dbgen.UpdateProductParams{
+		Title:              title,
+		PricePaise:         price.Paise(),
+		OriginalPricePaise: origPrice.Paise(),
+		ImageUrl:           imageUrl,
+		Description:        desc,
+		Rating:             rating,
+		Category:           category,
+		Images:             images,
+		LongDescription:    longDesc,
+		Url:                url,
+		Platform:           platform,
+		IsNew:              isNew,
+		IsBestseller:       isBestseller,
+		ID:                 id,
 	})
 	if err != nil {
 		jsonError(w, "Failed to update: "+err.Error(), 500)
 		return
 	}
+	if setVariants {
+		if err := saveVariants(r.Context(), qtx, id, variants); err != nil {
+			jsonError(w, "Failed to save variants: "+err.Error(), 400)
+			return
+		}
+	}
+	after, err := snapshotProduct(r.Context(), qtx, id)
+	if err == nil {
+		err = logAudit(r.Context(), qtx, s.auditActor(r), auditUpdate, &id, before, after)
+	}
+	if err != nil {
+		jsonError(w, "Failed to update: "+err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to update: "+err.Error(), 500)
+		return
+	}
 
 	updated, _ := q.GetProduct(r.Context(), id)
+	pvs, _ := q.ListProductVariants(r.Context(), id)
+	ap := toAPIProduct(updated)
+	ap.Variants = toAPIVariants(pvs)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"ok": true, "product": updated})
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "product": ap})
 }
 
 func (s *Server) handleDeleteProduct(w http.ResponseWriter, r *http.Request) {
@@ -753,8 +923,34 @@ func (s *Server) handleDeleteProduct(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "Invalid ID", 400)
 		return
 	}
-	q := dbgen.New(s.DB)
+	tx, err := s.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		jsonError(w, "Failed to delete: "+err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	q := dbgen.New(tx)
+	before, err := snapshotProduct(r.Context(), q, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		jsonError(w, "Product not found", 404)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to delete: "+err.Error(), 500)
+		return
+	}
+	// foreign_keys is only enabled on one pooled connection, so don't rely on
+	// ON DELETE CASCADE.
+	q.DeleteProductVariants(r.Context(), id)
 	q.DeleteProduct(r.Context(), id)
+	err = logAudit(r.Context(), q, s.auditActor(r), auditDelete, &id, before, nil)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		jsonError(w, "Failed to delete: "+err.Error(), 500)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{"ok": true})
 }
@@ -772,8 +968,11 @@ func (s *Server) handleGetProduct(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, "Product not found", 404)
 		return
 	}
+	pvs, _ := q.ListProductVariants(r.Context(), id)
+	ap := toAPIProduct(p)
+	ap.Variants = toAPIVariants(pvs)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(p)
+	json.NewEncoder(w).Encode(ap)
 }
 
 func (s *Server) handleListProducts(w http.ResponseWriter, r *http.Request) {
@@ -783,49 +982,20 @@ func (s *Server) handleListProducts(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, err.Error(), 500)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(products)
-}
-
-func (s *Server) handleUploadImage(w http.ResponseWriter, r *http.Request) {
-	// 10 MB max
-	r.ParseMultipartForm(10 << 20)
-
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		jsonError(w, "No file uploaded", 400)
-		return
-	}
-	defer file.Close()
-
-	// Validate extension
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	allowed := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
-	if !allowed[ext] {
-		jsonError(w, "Only jpg, png, gif, webp allowed", 400)
-		return
-	}
-
-	// Generate unique filename
-	b := make([]byte, 12)
-	rand.Read(b)
-	filename := hex.EncodeToString(b) + ext
-
-	dst, err := os.Create(filepath.Join(s.UploadsDir, filename))
-	if err != nil {
-		jsonError(w, "Failed to save file", 500)
-		return
+	byProduct := map[int64][]dbgen.ProductVariant{}
+	if all, err := q.ListAllProductVariants(r.Context()); err == nil {
+		for _, v := range all {
+			byProduct[v.ProductID] = append(byProduct[v.ProductID], v)
+		}
 	}
-	defer dst.Close()
-
-	if _, err := io.Copy(dst, file); err != nil {
-		jsonError(w, "Failed to write file", 500)
-		return
+	out := toAPIProducts(products)
+	for i := range out {
+		if vs := byProduct[out[i].ID]; len(vs) > 0 {
+			out[i].Variants = toAPIVariants(vs)
+		}
 	}
-
-	url := "/uploads/" + filename
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"ok": true, "url": url})
+	json.NewEncoder(w).Encode(out)
 }
 
 func jsonError(w http.ResponseWriter, msg string, code int) {
@@ -0,0 +1,153 @@
+package srv
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+func TestMain(m *testing.M) {
+	// Migrations and logins log at Info; keep test output to failures.
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// testPassword is the owner account's password on test servers.
+const testPassword = "correct horse battery"
+
+// newTestServer returns a server on a fresh database in a temporary
+// directory, with an owner account "admin" using testPassword.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("UPLOADS_DIR", filepath.Join(dir, "uploads"))
+	s, err := New(filepath.Join(dir, "db.sqlite3"), "shop.test", testPassword, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.DB.Close() })
+	return s
+}
+
+// addProduct inserts a product, filling in what p leaves empty.
+func addProduct(t *testing.T, s *Server, p dbgen.InsertProductParams) dbgen.Product {
+	t.Helper()
+	if p.Platform == "" {
+		p.Platform = "Meesho"
+	}
+	if p.Category == "" {
+		p.Category = "Testing"
+	}
+	if p.Images == "" {
+		p.Images = "[]"
+	}
+	got, err := dbgen.New(s.DB).InsertProduct(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+// testClient is a browser for a test server: it keeps cookies and doesn't
+// follow redirects.
+type testClient struct {
+	t    *testing.T
+	base string
+	http *http.Client
+}
+
+func newTestClient(t *testing.T, s *Server) *testClient {
+	t.Helper()
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	jar, _ := cookiejar.New(nil)
+	return &testClient{t: t, base: ts.URL, http: &http.Client{
+		Jar:           jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}}
+}
+
+// do sends a request and returns the response with its body read.
+func (c *testClient) do(req *http.Request) (*http.Response, string) {
+	c.t.Helper()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func (c *testClient) get(path string) (*http.Response, string) {
+	c.t.Helper()
+	req, err := http.NewRequest("GET", c.base+path, nil)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return c.do(req)
+}
+
+// postForm posts a form with extra headers, e.g. Sec-Fetch-Site.
+func (c *testClient) postForm(path string, form url.Values, header http.Header) (*http.Response, string) {
+	c.t.Helper()
+	req, err := http.NewRequest("POST", c.base+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return c.do(req)
+}
+
+var (
+	csrfFieldRE = regexp.MustCompile(`name="csrf_token" value="([0-9a-f]{64})"`)
+	csrfMetaRE  = regexp.MustCompile(`<meta name="csrf-token" content="([0-9a-f]{64})"`)
+)
+
+// loginToken loads the login form and returns its CSRF token.
+func (c *testClient) loginToken() string {
+	c.t.Helper()
+	_, body := c.get("/admin/login")
+	m := csrfFieldRE.FindStringSubmatch(body)
+	if m == nil {
+		c.t.Fatal("login form has no CSRF token")
+	}
+	return m[1]
+}
+
+// login signs in as the test server's owner and returns the session's CSRF
+// token.
+func (c *testClient) login() string {
+	c.t.Helper()
+	resp, _ := c.postForm("/admin/login", url.Values{
+		"username":   {"admin"},
+		"password":   {testPassword},
+		"csrf_token": {c.loginToken()},
+	}, nil)
+	if loc := resp.Header.Get("Location"); resp.StatusCode != http.StatusFound || loc != "/admin" {
+		c.t.Fatalf("login: %d to %q, want 302 to /admin", resp.StatusCode, loc)
+	}
+	_, body := c.get("/admin")
+	m := csrfMetaRE.FindStringSubmatch(body)
+	if m == nil {
+		c.t.Fatal("admin page has no CSRF token")
+	}
+	return m[1]
+}
@@ -107,5 +107,3 @@ Disallow: /img
 Sitemap: %s/sitemap.xml
 `, baseURL)
 }
-
-
@@ -0,0 +1,181 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// Out-of-stock policies for storefront listings (home, category, search and
+// related products). Sold-out items always carry a badge; the policy decides
+// where, or whether, they appear.
+const (
+	StockShow   = "show"   // leave sold-out items where they are
+	StockDemote = "demote" // move sold-out items to the end of each list
+	StockHide   = "hide"   // drop sold-out items from listings
+)
+
+// applyStockPolicy filters or reorders a product listing according to
+// s.OutOfStock. Product pages stay reachable either way.
+func (s *Server) applyStockPolicy(ps []dbgen.Product) []dbgen.Product {
+	switch s.OutOfStock {
+	case StockHide:
+		return slices.DeleteFunc(ps, func(p dbgen.Product) bool { return p.InStock == 0 })
+	case StockDemote:
+		slices.SortStableFunc(ps, func(a, b dbgen.Product) int { return int(b.InStock - a.InStock) })
+	}
+	return ps
+}
+
+// handleStockAdjust changes the stock of a product or one of its variants and
+// logs the change. Form fields:
+//
+//	variant_id  optional; required when the product has variants
+//	delta       signed change, e.g. "-2" after two offline sales
+//	set         absolute count, used instead of delta after a stock take
+//	reason      required
+//
+// Stock never goes below zero. For products with variants the product stock
+// is the sum of its variants'.
+func (s *Server) handleStockAdjust(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid ID", 400)
+		return
+	}
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		jsonError(w, "Reason is required", 400)
+		return
+	}
+	var delta, set int64
+	setMode := r.FormValue("set") != ""
+	if setMode {
+		set, err = strconv.ParseInt(r.FormValue("set"), 10, 64)
+		if err != nil || set < 0 {
+			jsonError(w, "Invalid stock count", 400)
+			return
+		}
+	} else {
+		delta, err = strconv.ParseInt(r.FormValue("delta"), 10, 64)
+		if err != nil || delta == 0 {
+			jsonError(w, "Provide a non-zero delta or a set count", 400)
+			return
+		}
+	}
+	var variantID *int64
+	if v := r.FormValue("variant_id"); v != "" {
+		vid, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			jsonError(w, "Invalid variant ID", 400)
+			return
+		}
+		variantID = &vid
+	}
+
+	tx, err := s.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	q := dbgen.New(tx)
+	p, err := q.GetProduct(r.Context(), id)
+	if err != nil {
+		jsonError(w, "Product not found", 404)
+		return
+	}
+	variants, err := q.ListProductVariants(r.Context(), id)
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+
+	current := p.Stock
+	if variantID != nil {
+		v, err := q.GetProductVariant(r.Context(), dbgen.GetProductVariantParams{ID: *variantID, ProductID: id})
+		if err != nil {
+			jsonError(w, "Variant not found", 404)
+			return
+		}
+		current = v.Stock
+	} else if len(variants) > 0 {
+		jsonError(w, "This product has variants; adjust a variant's stock instead", 400)
+		return
+	}
+
+	var before int64
+	if current != nil {
+		before = *current
+	}
+	after := before + delta
+	if setMode {
+		after = set
+	}
+	after = max(after, 0)
+
+	if variantID != nil {
+		err = q.SetVariantStock(r.Context(), dbgen.SetVariantStockParams{Stock: &after, ID: *variantID, ProductID: id})
+		if err == nil {
+			err = q.SyncProductStockFromVariants(r.Context(), id)
+		}
+	} else {
+		err = q.SetProductStock(r.Context(), dbgen.SetProductStockParams{Stock: &after, ID: id})
+	}
+	if err != nil {
+		jsonError(w, "Failed to update stock: "+err.Error(), 500)
+		return
+	}
+	adj, err := q.InsertStockAdjustment(r.Context(), dbgen.InsertStockAdjustmentParams{
+		ProductID:  id,
+		VariantID:  variantID,
+		Delta:      after - before,
+		StockAfter: after,
+		Reason:     reason,
+	})
+	if err != nil {
+		jsonError(w, "Failed to log adjustment: "+err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+
+	p, _ = dbgen.New(s.DB).GetProduct(r.Context(), id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "stock": p.Stock, "in_stock": p.InStock == 1, "adjustment": adj})
+}
+
+// handleStockLog returns a product's current stock, per-variant stock and
+// the most recent adjustments.
+func (s *Server) handleStockLog(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid ID", 400)
+		return
+	}
+	q := dbgen.New(s.DB)
+	p, err := q.GetProduct(r.Context(), id)
+	if err != nil {
+		jsonError(w, "Product not found", 404)
+		return
+	}
+	variants, _ := q.ListProductVariants(r.Context(), id)
+	log, err := q.ListStockAdjustments(r.Context(), id)
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"stock":    p.Stock,
+		"in_stock": p.InStock == 1,
+		"variants": toAPIVariants(variants),
+		"log":      log,
+	})
+}
@@ -0,0 +1,334 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// extractStructured reads the schema.org Product a page describes, from
+// application/ld+json blocks or else from microdata, and returns nil if
+// the page has neither. Unlike a regex over the whole page it only sees
+// the page's own product, not ones in carousels or recommendations.
+func extractStructured(pageURL, body string) *ProductInfo {
+	ld, items := scanStructured(body)
+	var product, crumbs map[string]any
+	for _, source := range [][]map[string]any{ld, items} {
+		for _, node := range source {
+			switch {
+			case product == nil && hasType(node, "Product"):
+				product = node
+			case crumbs == nil && hasType(node, "BreadcrumbList"):
+				crumbs = node
+			}
+		}
+		if product != nil {
+			break
+		}
+	}
+	if product == nil {
+		return nil
+	}
+
+	p := &ProductInfo{
+		URL:         pageURL,
+		Title:       ldString(product["name"]),
+		Description: ldString(product["description"]),
+		Category:    ldString(product["category"]),
+	}
+	base, _ := url.Parse(pageURL)
+	var imgs []string
+	for _, img := range ldList(product["image"]) {
+		if m, ok := img.(map[string]any); ok {
+			img = firstNonEmpty(ldString(m["url"]), ldString(m["contentUrl"]))
+		}
+		if s := ldString(img); s != "" {
+			imgs = append(imgs, resolveURL(base, s))
+		}
+	}
+	p.setImages(imgs)
+
+	for _, o := range ldList(product["offers"]) {
+		offer, ok := o.(map[string]any)
+		if !ok {
+			continue
+		}
+		price := firstNonEmpty(ldString(offer["price"]), ldString(offer["lowPrice"]))
+		for _, ps := range ldList(offer["priceSpecification"]) {
+			spec, ok := ps.(map[string]any)
+			if !ok {
+				continue
+			}
+			// A list or strikethrough price is the MRP; any other
+			// specification is the selling price.
+			v := ldString(spec["price"])
+			if t := ldString(spec["priceType"]); strings.HasSuffix(t, "ListPrice") || strings.HasSuffix(t, "StrikethroughPrice") {
+				p.OriginalPrice, _ = ParseMoney(v)
+			} else if price == "" {
+				price = v
+			}
+		}
+		if v, err := ParseMoney(price); err == nil && v > 0 {
+			p.Price = v
+			break
+		}
+	}
+	if p.OriginalPrice <= p.Price {
+		p.OriginalPrice = 0
+	}
+
+	if r, ok := product["aggregateRating"].(map[string]any); ok {
+		p.Rating = ldString(r["ratingValue"])
+		p.RatingCount = parseCount(firstNonEmpty(ldString(r["ratingCount"]), ldString(r["reviewCount"])))
+	}
+
+	// Shops that leave out category usually publish breadcrumbs, ending
+	// with the product itself.
+	if p.Category == "" && crumbs != nil {
+		var names []string
+		for _, el := range ldList(crumbs["itemListElement"]) {
+			if m, ok := el.(map[string]any); ok {
+				name := ldString(m["name"])
+				if item, ok := m["item"].(map[string]any); ok {
+					name = firstNonEmpty(ldString(item["name"]), name)
+				}
+				names = append(names, name)
+			}
+		}
+		if n := len(names); n >= 2 && names[n-1] == p.Title {
+			names = names[:n-1]
+		}
+		if n := len(names); n >= 1 {
+			p.Category = names[n-1]
+		}
+	}
+	return p
+}
+
+// scanStructured tokenizes body once, returning the top-level JSON-LD
+// nodes (with @graph flattened) and the top-level microdata items, each
+// item converted to the same shape as JSON-LD so one reader handles both.
+func scanStructured(body string) (ld, items []map[string]any) {
+	// open is one element that hasn't been closed yet.
+	type open struct {
+		tag   atom.Atom
+		item  map[string]any // the item this element starts, if itemscope
+		props []string       // itemprops whose value is this element's text
+		text  strings.Builder
+	}
+	var stack []*open
+	parent := func() map[string]any {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].item != nil {
+				return stack[i].item
+			}
+		}
+		return nil
+	}
+	inLD := false
+
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ld, items
+		case html.TextToken:
+			if inLD {
+				ld = append(ld, parseLD(z.Text())...)
+				continue
+			}
+			text := z.Text()
+			for _, o := range stack {
+				if o.props != nil {
+					o.text.Write(text)
+				}
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			attrs := map[string]string{}
+			scoped := false
+			for _, a := range tok.Attr {
+				attrs[a.Key] = a.Val
+				if a.Key == "itemscope" {
+					scoped = true
+				}
+			}
+			if tok.DataAtom == atom.Br {
+				for _, o := range stack {
+					if o.props != nil {
+						o.text.WriteByte(' ')
+					}
+				}
+			}
+			inLD = tok.DataAtom == atom.Script && strings.EqualFold(strings.TrimSpace(attrs["type"]), "application/ld+json")
+			props := strings.Fields(attrs["itemprop"])
+			o := &open{tag: tok.DataAtom}
+			if scoped {
+				o.item = map[string]any{}
+				if t := attrs["itemtype"]; t != "" {
+					o.item["@type"] = t[strings.LastIndexAny(t, "/#")+1:]
+				}
+				if p := parent(); p != nil && len(props) > 0 {
+					for _, name := range props {
+						addProp(p, name, o.item)
+					}
+				} else {
+					items = append(items, o.item)
+				}
+			} else if p := parent(); p != nil && len(props) > 0 {
+				if v, ok := microdataValue(tok.DataAtom, attrs); ok {
+					for _, name := range props {
+						addProp(p, name, v)
+					}
+				} else {
+					o.props = props
+				}
+			}
+			if tok.Type == html.StartTagToken && !voidElements[tok.DataAtom] {
+				stack = append(stack, o)
+			}
+		case html.EndTagToken:
+			inLD = false
+			tag := z.Token().DataAtom
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].tag != tag {
+					continue
+				}
+				// Close this element and any left open inside it.
+				for j := len(stack) - 1; j >= i; j-- {
+					o := stack[j]
+					stack = stack[:j]
+					if o.props != nil {
+						if p := parent(); p != nil {
+							for _, name := range o.props {
+								addProp(p, name, strings.Join(strings.Fields(o.text.String()), " "))
+							}
+						}
+					}
+				}
+				break
+			}
+		}
+	}
+}
+
+var voidElements = map[atom.Atom]bool{
+	atom.Area: true, atom.Base: true, atom.Br: true, atom.Col: true, atom.Embed: true,
+	atom.Hr: true, atom.Img: true, atom.Input: true, atom.Link: true, atom.Meta: true,
+	atom.Source: true, atom.Track: true, atom.Wbr: true,
+}
+
+// microdataValue returns an itemprop's value when it comes from an
+// attribute rather than the element's text.
+func microdataValue(tag atom.Atom, attrs map[string]string) (string, bool) {
+	if v, ok := attrs["content"]; ok {
+		return v, true
+	}
+	switch tag {
+	case atom.A, atom.Link, atom.Area:
+		return attrs["href"], true
+	case atom.Img, atom.Source, atom.Video, atom.Audio, atom.Embed, atom.Iframe:
+		return attrs["src"], true
+	case atom.Data, atom.Meter:
+		return attrs["value"], true
+	case atom.Time:
+		if v, ok := attrs["datetime"]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// addProp sets a microdata property, turning repeats into a list the way
+// JSON-LD writes them.
+func addProp(item map[string]any, name string, v any) {
+	switch old := item[name].(type) {
+	case nil:
+		item[name] = v
+	case []any:
+		item[name] = append(old, v)
+	default:
+		item[name] = []any{old, v}
+	}
+}
+
+// parseLD decodes one ld+json block into its top-level nodes. Blocks that
+// don't parse are skipped; plenty of shops publish broken JSON-LD.
+func parseLD(b []byte) []map[string]any {
+	var v any
+	if json.Unmarshal(b, &v) != nil {
+		return nil
+	}
+	var nodes []map[string]any
+	for _, n := range ldList(v) {
+		m, ok := n.(map[string]any)
+		if !ok {
+			continue
+		}
+		if g, ok := m["@graph"]; ok {
+			for _, gn := range ldList(g) {
+				if gm, ok := gn.(map[string]any); ok {
+					nodes = append(nodes, gm)
+				}
+			}
+			continue
+		}
+		nodes = append(nodes, m)
+	}
+	return nodes
+}
+
+// hasType reports whether a node's @type, a name or a list of names,
+// includes typ.
+func hasType(node map[string]any, typ string) bool {
+	for _, t := range ldList(node["@type"]) {
+		if s, ok := t.(string); ok && (s == typ || strings.HasSuffix(s, "/"+typ)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ldList returns v as a list, since JSON-LD allows a single value wherever
+// a list is allowed.
+func ldList(v any) []any {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		return v
+	default:
+		return []any{v}
+	}
+}
+
+// ldString returns a text or number value as a string, or the first of a
+// list of them.
+func ldString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(htmlDecode(v))
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		if len(v) > 0 {
+			return ldString(v[0])
+		}
+	}
+	return ""
+}
+
+func resolveURL(base *url.URL, ref string) string {
+	if base == nil {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
@@ -0,0 +1,324 @@
+package srv
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// The catalogue sync re-scrapes every product that has a listing URL,
+// including those a store import added, and brings its price, MRP,
+// rating and images up to date. Titles, descriptions and categories are
+// left alone since admins often rewrite them. A listing that answers 404
+// or 410 marks its product delisted, which shows it as unavailable until
+// the listing comes back.
+
+// Sync triggers, stored in sync_runs.trigger.
+const (
+	syncScheduled = "scheduled"
+	syncManual    = "manual"
+)
+
+// Outcomes of syncing one product.
+const (
+	syncUnchanged = "unchanged"
+	syncUpdated   = "updated"
+	syncDelisted  = "delisted"
+)
+
+// Sync tuning, variables so they can be shortened when trying things out.
+var (
+	syncProductDelay = 3 * time.Second // between products, to stay polite
+	syncMaxErrors    = 20              // errors kept per run
+	syncSaveEvery    = 10              // products between progress saves
+)
+
+// syncActor is who sync changes are attributed to in the audit log.
+var syncActor = auditActor{Name: "(sync)"}
+
+// scheduleSync runs a sync every s.SyncEvery, counted from the start of
+// the last run so restarts don't reset the clock. It never returns.
+func (s *Server) scheduleSync() {
+	ctx := context.Background()
+	for {
+		wait := time.Duration(0)
+		last, err := dbgen.New(s.DB).GetLastSyncRun(ctx)
+		switch {
+		case err == nil:
+			wait = time.Until(last.StartedAt.Add(s.SyncEvery))
+		case !errors.Is(err, sql.ErrNoRows):
+			slog.Error("look up last sync", "error", err)
+			wait = time.Minute
+		}
+		if wait > 0 {
+			time.Sleep(wait)
+			continue
+		}
+		if !s.syncRunning.CompareAndSwap(false, true) {
+			// A sync started by hand; it becomes the last run.
+			time.Sleep(time.Minute)
+			continue
+		}
+		err = s.syncCatalog(ctx, syncScheduled)
+		s.syncRunning.Store(false)
+		if err != nil {
+			slog.Error("sync catalogue", "error", err)
+			time.Sleep(time.Minute)
+		}
+	}
+}
+
+// syncCatalog checks every product with a listing URL, stalest first,
+// recording the run in sync_runs. The caller must hold s.syncRunning.
+func (s *Server) syncCatalog(ctx context.Context, trigger string) error {
+	q := dbgen.New(s.DB)
+	run, err := q.InsertSyncRun(ctx, trigger)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := q.FinishSyncRun(ctx, run.ID); err != nil {
+			slog.Error("save sync run", "error", err)
+		}
+	}()
+	products, err := q.ListSyncableProducts(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("sync started", "trigger", trigger, "products", len(products))
+
+	errs := []string{}
+	save := func() {
+		b, _ := json.Marshal(errs)
+		err := q.UpdateSyncRun(ctx, dbgen.UpdateSyncRunParams{
+			Checked:  run.Checked,
+			Updated:  run.Updated,
+			Delisted: run.Delisted,
+			Failed:   run.Failed,
+			Errors:   string(b),
+			ID:       run.ID,
+		})
+		if err != nil {
+			slog.Error("save sync run", "error", err)
+		}
+	}
+	for i, p := range products {
+		if i > 0 {
+			time.Sleep(syncProductDelay + time.Duration(rand.Int64N(int64(time.Second))))
+		}
+		outcome, err := s.syncProduct(ctx, p)
+		run.Checked++
+		switch {
+		case err != nil:
+			run.Failed++
+			if len(errs) < syncMaxErrors {
+				errs = append(errs, fmt.Sprintf("#%d %s: %v", p.ID, p.Title, err))
+			}
+		case outcome == syncUpdated:
+			run.Updated++
+		case outcome == syncDelisted:
+			run.Delisted++
+		}
+		if run.Checked%int64(syncSaveEvery) == 0 {
+			save()
+		}
+	}
+	save()
+	slog.Info("sync finished", "checked", run.Checked, "updated", run.Updated, "delisted", run.Delisted, "failed", run.Failed)
+	return nil
+}
+
+// syncProduct re-scrapes one product's listing and saves what changed,
+// adding to its price history when the price moved.
+func (s *Server) syncProduct(ctx context.Context, p dbgen.Product) (string, error) {
+	q := dbgen.New(s.DB)
+	info, err := ScrapeProduct(ctx, p.Url)
+	var status *pageStatusError
+	if errors.As(err, &status) && status.gone() {
+		if err := q.DelistProduct(ctx, p.ID); err != nil {
+			return "", err
+		}
+		if p.DelistedAt != nil {
+			return syncUnchanged, nil
+		}
+		slog.Info("product delisted", "id", p.ID, "url", p.Url)
+		return syncDelisted, nil
+	}
+	if err != nil {
+		// Counts as checked, so a run that is cut short doesn't keep
+		// starting with the products that fail.
+		q.MarkProductSynced(ctx, p.ID)
+		return "", err
+	}
+
+	// Anything the page didn't show keeps the value we have. Uploaded
+	// images are the admin's own choice and are never replaced.
+	upd := dbgen.UpdateSyncedProductParams{
+		PricePaise:         p.PricePaise,
+		OriginalPricePaise: p.OriginalPricePaise,
+		Rating:             cmp.Or(info.Rating, p.Rating),
+		ImageUrl:           p.ImageUrl,
+		Images:             p.Images,
+		ID:                 p.ID,
+	}
+	if info.Price > 0 {
+		upd.PricePaise = info.Price.Paise()
+		upd.OriginalPricePaise = info.OriginalPrice.Paise()
+		if upd.OriginalPricePaise == 0 && p.OriginalPricePaise > upd.PricePaise {
+			upd.OriginalPricePaise = p.OriginalPricePaise
+		}
+	}
+	if !strings.HasPrefix(p.ImageUrl, "/uploads/") && len(info.Images) > 0 {
+		b, _ := json.Marshal(info.Images)
+		upd.ImageUrl, upd.Images = info.ImageURL, string(b)
+	}
+	if upd.PricePaise == p.PricePaise && upd.OriginalPricePaise == p.OriginalPricePaise &&
+		upd.Rating == p.Rating && upd.ImageUrl == p.ImageUrl && upd.Images == p.Images && p.DelistedAt == nil {
+		return syncUnchanged, q.MarkProductSynced(ctx, p.ID)
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	q = dbgen.New(tx)
+	before, err := snapshotProduct(ctx, q, p.ID)
+	if err != nil {
+		return "", err
+	}
+	if err := q.UpdateSyncedProduct(ctx, upd); err != nil {
+		return "", err
+	}
+	if upd.PricePaise != p.PricePaise {
+		if err := recordPriceChange(ctx, q, p, upd.PricePaise, upd.OriginalPricePaise); err != nil {
+			return "", err
+		}
+	}
+	after, err := snapshotProduct(ctx, q, p.ID)
+	if err != nil {
+		return "", err
+	}
+	if err := logAudit(ctx, q, syncActor, auditSync, &p.ID, before, after); err != nil {
+		return "", err
+	}
+	return syncUpdated, tx.Commit()
+}
+
+// recordPriceChange adds a product's new price to its history, first
+// recording the price it had since it was added if it has no history yet.
+func recordPriceChange(ctx context.Context, q *dbgen.Queries, p dbgen.Product, price, originalPrice int64) error {
+	n, err := q.CountPriceHistory(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		err := q.InsertPriceHistory(ctx, dbgen.InsertPriceHistoryParams{
+			ProductID:          p.ID,
+			PricePaise:         p.PricePaise,
+			OriginalPricePaise: p.OriginalPricePaise,
+			RecordedAt:         p.AddedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return q.InsertPriceHistory(ctx, dbgen.InsertPriceHistoryParams{
+		ProductID:          p.ID,
+		PricePaise:         price,
+		OriginalPricePaise: originalPrice,
+		RecordedAt:         time.Now().UTC(),
+	})
+}
+
+// syncRunView is a sync run with its errors decoded for the admin page.
+type syncRunView struct {
+	dbgen.SyncRun
+	ErrorList []string
+}
+
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	q := dbgen.New(s.DB)
+	runs, err := q.ListSyncRuns(r.Context(), 10)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	views := make([]syncRunView, 0, len(runs))
+	for _, run := range runs {
+		v := syncRunView{SyncRun: run}
+		json.Unmarshal([]byte(run.Errors), &v.ErrorList)
+		views = append(views, v)
+	}
+	delisted, _ := q.ListDelistedProducts(r.Context())
+	changes, _ := q.ListRecentPriceChanges(r.Context(), 20)
+
+	var next *time.Time
+	if s.SyncEvery > 0 {
+		t := time.Now()
+		if len(runs) > 0 && runs[0].StartedAt.Add(s.SyncEvery).After(t) {
+			t = runs[0].StartedAt.Add(s.SyncEvery)
+		}
+		next = &t
+	}
+	s.templates.render(w, "sync.html", map[string]any{
+		"Nav":            "sync",
+		"CSRFToken":      s.csrfToken(w, r),
+		"CanEditCatalog": true,
+		"SignedIn":       adminUser(r.Context()) != nil,
+		"Every":          syncInterval(s.SyncEvery),
+		"NextRun":        next,
+		"Running":        s.syncRunning.Load(),
+		"Runs":           views,
+		"Delisted":       delisted,
+		"PriceChanges":   changes,
+	})
+}
+
+// syncInterval describes the sync schedule, such as "6 hours".
+func syncInterval(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return ""
+	case d%(24*time.Hour) == 0:
+		return plural(int64(d/(24*time.Hour)), "day")
+	case d%time.Hour == 0:
+		return plural(int64(d/time.Hour), "hour")
+	case d%time.Minute == 0:
+		return plural(int64(d/time.Minute), "minute")
+	}
+	return d.String()
+}
+
+func plural(n int64, unit string) string {
+	if n == 1 {
+		return unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// handleSyncRun starts a sync in the background.
+func (s *Server) handleSyncRun(w http.ResponseWriter, r *http.Request) {
+	if !s.syncRunning.CompareAndSwap(false, true) {
+		jsonError(w, "A sync is already running", 409)
+		return
+	}
+	go func() {
+		defer s.syncRunning.Store(false)
+		if err := s.syncCatalog(context.Background(), syncManual); err != nil {
+			slog.Error("sync catalogue", "error", err)
+		}
+	}()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "message": "Sync started"})
+}
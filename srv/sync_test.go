@@ -0,0 +1,176 @@
+package srv
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// stubListings serves product pages from testdata by path, or a bare
+// status, and can be changed between syncs.
+type stubListings struct {
+	mu    sync.Mutex
+	pages map[string]string // host and path: a testdata file or a status code
+}
+
+func (l *stubListings) set(pageURL, page string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pages[strings.TrimPrefix(pageURL, "https://")] = page
+}
+
+func (l *stubListings) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	page, ok := l.pages[r.Host+r.URL.Path]
+	l.mu.Unlock()
+	switch {
+	case !ok:
+		http.NotFound(w, r)
+	case strings.HasSuffix(page, ".html"):
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeFile(w, r, "testdata/"+page)
+	default:
+		status, _ := strconv.Atoi(page)
+		http.Error(w, http.StatusText(status), status)
+	}
+}
+
+// priceHistory returns a product's recorded prices, oldest first.
+func priceHistory(t *testing.T, s *Server, id int64) (prices []int64, times []time.Time) {
+	t.Helper()
+	rows, err := s.DB.Query("SELECT price_paise, recorded_at FROM price_history WHERE product_id = ? ORDER BY id", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p int64
+		var at time.Time
+		if err := rows.Scan(&p, &at); err != nil {
+			t.Fatal(err)
+		}
+		prices, times = append(prices, p), append(times, at)
+	}
+	return prices, times
+}
+
+func TestSyncCatalog(t *testing.T) {
+	defer func(d time.Duration) { syncProductDelay = d }(syncProductDelay)
+	syncProductDelay = 0
+
+	s := newTestServer(t)
+	ctx := context.Background()
+	q := dbgen.New(s.DB)
+	// Only the products below are synced.
+	if _, err := s.DB.Exec("UPDATE products SET url = ''"); err != nil {
+		t.Fatal(err)
+	}
+	listings := &stubListings{pages: map[string]string{}}
+	stubPages(t, listings)
+
+	// The page has dropped the price from ₹399 to ₹349.
+	repriced := addProduct(t, s, dbgen.InsertProductParams{
+		Title: "Trendy Cotton Kurti", Url: "https://www.meesho.com/trendy-cotton-kurti/p/101",
+		PricePaise: 39900, OriginalPricePaise: 59900, Rating: "4.1",
+	})
+	listings.set(repriced.Url, "meesho_next_data.html")
+	// Shops without a scraper of their own are synced too.
+	shop := addProduct(t, s, dbgen.InsertProductParams{
+		Title: "Ceramic Mug", Url: "https://claycorner.example.com/products/mug", PricePaise: 49900,
+	})
+	listings.set(shop.Url, "shop_jsonld.html")
+	gone := addProduct(t, s, dbgen.InsertProductParams{
+		Title: "Floral Print Dupatta", Url: "https://www.meesho.com/floral-print-dupatta/p/202", PricePaise: 22900,
+	})
+	listings.set(gone.Url, "404")
+	// Delisted by an earlier sync: still gone, so not counted again.
+	stillGone := addProduct(t, s, dbgen.InsertProductParams{
+		Title: "Old Lamp", Url: "https://www.amazon.in/dp/B0OLDLAMP1", PricePaise: 84900,
+	})
+	listings.set(stillGone.Url, "410")
+	if err := q.DelistProduct(ctx, stillGone.ID); err != nil {
+		t.Fatal(err)
+	}
+	broken := addProduct(t, s, dbgen.InsertProductParams{
+		Title: "Steel Bottle", Url: "https://www.amazon.in/dp/B0BOTTLE01", PricePaise: 129900,
+	})
+	listings.set(broken.Url, "503")
+
+	if err := s.syncCatalog(ctx, syncManual); err != nil {
+		t.Fatal(err)
+	}
+	run, err := q.GetLastSyncRun(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Checked != 5 || run.Updated != 2 || run.Delisted != 1 || run.Failed != 1 || run.FinishedAt == nil {
+		t.Errorf("run: %d checked, %d updated, %d delisted, %d failed, finished %v; want 5, 2, 1, 1 and finished",
+			run.Checked, run.Updated, run.Delisted, run.Failed, run.FinishedAt)
+	}
+	if !strings.Contains(run.Errors, "Steel Bottle") {
+		t.Errorf("run errors %s, want the failed product", run.Errors)
+	}
+
+	got, _ := q.GetProduct(ctx, repriced.ID)
+	if got.PricePaise != 34900 || got.OriginalPricePaise != 59900 || got.ImageUrl != "https://images.meesho.com/images/products/101/main_512.webp" {
+		t.Errorf("repriced: %d, %d, %q", got.PricePaise, got.OriginalPricePaise, got.ImageUrl)
+	}
+	// The first change records the price the product had since it was
+	// added, then the new one.
+	prices, times := priceHistory(t, s, repriced.ID)
+	if len(prices) != 2 || prices[0] != 39900 || prices[1] != 34900 || !times[0].Equal(repriced.AddedAt) {
+		t.Errorf("price history %v at %v, want 39900 from %v, then 34900", prices, times, repriced.AddedAt)
+	}
+	got, _ = q.GetProduct(ctx, shop.ID)
+	if got.PricePaise != 44950 || got.OriginalPricePaise != 69900 || got.Title != "Ceramic Mug" {
+		t.Errorf("shop product: %q at %d, MRP %d; want the title kept and 44950, 69900", got.Title, got.PricePaise, got.OriginalPricePaise)
+	}
+	got, _ = q.GetProduct(ctx, gone.ID)
+	if got.DelistedAt == nil || got.InStock != 0 {
+		t.Errorf("404 listing: delisted at %v, in stock %d; want it delisted", got.DelistedAt, got.InStock)
+	}
+	got, _ = q.GetProduct(ctx, broken.ID)
+	if got.DelistedAt != nil || got.PricePaise != 129900 || got.SyncedAt == nil {
+		t.Errorf("failed listing: delisted at %v, price %d, synced at %v; want it left as it was but checked",
+			got.DelistedAt, got.PricePaise, got.SyncedAt)
+	}
+
+	// The delisted listing comes back.
+	listings.set(gone.Url, "meesho_meta_only.html")
+	p, _ := q.GetProduct(ctx, gone.ID)
+	if outcome, err := s.syncProduct(ctx, p); err != nil || outcome != syncUpdated {
+		t.Fatalf("relisted: %q, %v; want updated", outcome, err)
+	}
+	got, _ = q.GetProduct(ctx, gone.ID)
+	if got.DelistedAt != nil || got.InStock != 1 {
+		t.Errorf("relisted: delisted at %v, in stock %d; want it listed again", got.DelistedAt, got.InStock)
+	}
+	if prices, _ := priceHistory(t, s, gone.ID); len(prices) != 0 {
+		t.Errorf("relisted at the same price: history %v, want none", prices)
+	}
+
+	// Our price differs from the page again; history already has its
+	// starting row.
+	if _, err := s.DB.Exec("UPDATE products SET price_paise = 29900 WHERE id = ?", repriced.ID); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = q.GetProduct(ctx, repriced.ID)
+	if outcome, err := s.syncProduct(ctx, p); err != nil || outcome != syncUpdated {
+		t.Fatalf("second change: %q, %v; want updated", outcome, err)
+	}
+	if prices, _ := priceHistory(t, s, repriced.ID); len(prices) != 3 || prices[2] != 34900 {
+		t.Errorf("after a second change: history %v, want one more 34900 and no second seed", prices)
+	}
+
+	// Nothing changed since: no new history, nothing updated.
+	p, _ = q.GetProduct(ctx, repriced.ID)
+	if outcome, err := s.syncProduct(ctx, p); err != nil || outcome != syncUnchanged {
+		t.Errorf("unchanged page: %q, %v; want unchanged", outcome, err)
+	}
+}
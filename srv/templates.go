@@ -0,0 +1,95 @@
+package srv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"sync"
+)
+
+// templateSet holds every page in templates/, parsed once together with
+// the shared partials in templates/partials. Each page is its own template
+// tree, so pages can define blocks with the same names.
+type templateSet struct {
+	fsys  fs.FS
+	funcs template.FuncMap // added to funcMap, e.g. "asset"
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+}
+
+func loadTemplates(fsys fs.FS, funcs template.FuncMap) (*templateSet, error) {
+	ts := &templateSet{fsys: fsys, funcs: funcs}
+	return ts, ts.load()
+}
+
+// load parses the templates again, keeping the previous ones on error.
+func (ts *templateSet) load() error {
+	pages, err := parseTemplates(ts.fsys, ts.funcs)
+	if err != nil {
+		return err
+	}
+	ts.mu.Lock()
+	ts.pages = pages
+	ts.mu.Unlock()
+	return nil
+}
+
+// parseTemplates parses and escapes every page so that both syntax errors
+// and html/template context errors surface at startup instead of on the
+// first visit.
+func parseTemplates(fsys fs.FS, funcs template.FuncMap) (map[string]*template.Template, error) {
+	files, err := fs.Glob(fsys, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no templates found")
+	}
+	partials, err := fs.Glob(fsys, "templates/partials/*.html")
+	if err != nil {
+		return nil, err
+	}
+	pages := map[string]*template.Template{}
+	for _, file := range files {
+		name := path.Base(file)
+		t, err := template.New(name).Funcs(funcMap).Funcs(funcs).ParseFS(fsys, append([]string{file}, partials...)...)
+		if err != nil {
+			return nil, err
+		}
+		// Execute escapes the whole tree before running anything; with no
+		// data the run itself then fails, which is expected and ignored.
+		var escErr *template.Error
+		if err := t.Execute(io.Discard, nil); errors.As(err, &escErr) {
+			return nil, err
+		}
+		pages[name] = t
+	}
+	return pages, nil
+}
+
+// render executes page name into a buffer first, so a failing template
+// returns a clean 500 instead of half a page.
+func (ts *templateSet) render(w http.ResponseWriter, name string, data any) {
+	ts.mu.RLock()
+	t := ts.pages[name]
+	ts.mu.RUnlock()
+	if t == nil {
+		http.Error(w, "no template "+name, 500)
+		return
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		slog.Error("render template", "template", name, "error", err)
+		http.Error(w, "Something went wrong rendering this page", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
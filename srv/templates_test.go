@@ -0,0 +1,90 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// Scraped product data is attacker-controlled. Each payload below would
+// run script if a template wrote it out unescaped; alert(n) tells which
+// field got through.
+const (
+	hostileTitle    = `Kurta </script><script>alert(1)</script> "quoted" 'single'`
+	hostileURL      = `javascript:alert(2)`
+	hostileImage    = `javascript:alert(3)"><script>alert(4)</script>`
+	hostileDesc     = `<script>alert(5)</script><img src=x onerror=alert(6)>`
+	hostileLongDesc = `</textarea></script><script>alert(7)</script>`
+	hostileCategory = `Kurtas"><script>alert(8)</script>`
+	hostileQuery    = `"><script>alert(9)</script>`
+)
+
+var (
+	// liveScriptRE matches a payload that would run: a script element, an
+	// event handler attribute or a javascript: URL the browser will load.
+	liveScriptRE = regexp.MustCompile(`(?i)<script>alert|<img src=x onerror|(href|src|action)="\s*javascript:`)
+	// escapedRE matches the payloads written out as text.
+	escapedRE = regexp.MustCompile(`&lt;script&gt;alert\(|\\u003cscript\\u003ealert\(|%3Cscript%3Ealert\(`)
+)
+
+func TestTemplatesEscapeHostileProducts(t *testing.T) {
+	s := newTestServer(t)
+	images, _ := json.Marshal([]string{hostileImage, hostileURL, `/uploads/x.jpg"><script>alert(10)</script>`})
+	p := addProduct(t, s, dbgen.InsertProductParams{
+		Title:           hostileTitle,
+		Url:             hostileURL,
+		ImageUrl:        hostileImage,
+		Description:     hostileDesc,
+		LongDescription: hostileLongDesc,
+		Category:        hostileCategory,
+		Images:          string(images),
+		PricePaise:      49900,
+		Rating:          `4.5"><script>alert(11)</script>`,
+	})
+	// Featured on the home page too.
+	err := dbgen.New(s.DB).UpdateProductTags(context.Background(), dbgen.UpdateProductTagsParams{IsNew: 1, IsBestseller: 1, ID: p.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(t, s)
+	c.login()
+	tests := []struct {
+		name string
+		path string
+		// zgotmpl is whether the page links to the product's own URL, which
+		// must come out as html/template's "#ZgotmplZ" for unsafe schemes.
+		zgotmpl bool
+	}{
+		{"home", "/", false},
+		{"product", fmt.Sprintf("/product/%d", p.ID), true},
+		{"search", "/search?q=" + url.QueryEscape("kurta"), false},
+		{"search query", "/search?q=" + url.QueryEscape(hostileQuery), false},
+		{"category", "/category/" + url.PathEscape(hostileCategory), false},
+		{"admin", "/admin", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := c.get(tt.path)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d, want 200", resp.StatusCode)
+			}
+			if m := liveScriptRE.FindAllString(body, -1); m != nil {
+				t.Errorf("unescaped payloads in output: %q", m)
+			}
+			if !escapedRE.MatchString(body) {
+				t.Error("no escaped payload in output; did the hostile product render?")
+			}
+			if tt.zgotmpl && !strings.Contains(body, `href="#ZgotmplZ"`) {
+				t.Error(`javascript: product URL wasn't replaced with "#ZgotmplZ"`)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// Login throttling. Failed attempts are recorded in login_attempts and
+// counted per username and client IP since that username's last
+// successful login from the IP:
+//
+//	fewer than loginFreeTries   no delay
+//	up to loginLockoutAfter     exponential backoff, 1s, 2s, 4s, ... after the last failure
+//	loginLockoutAfter or more   locked out for loginLockout after the last failure
+//
+// Locking out only that username from that IP means nobody else can lock
+// staff out of the panel by guessing at their accounts. Failures from one
+// IP across all usernames back off the same way, capped at loginIPMaxWait
+// rather than locking out, so spraying many usernames stays slow too.
+//
+// On top of that, while there are more than loginGlobalMax failures across
+// all IPs within loginGlobalWindow, every attempt is held for
+// loginGlobalDelay before its password is checked. That slows distributed
+// guessing without refusing anyone.
+const (
+	loginFreeTries    = 3
+	loginLockoutAfter = 10
+	loginLockout      = 15 * time.Minute
+	loginIPMaxWait    = time.Minute
+	loginGlobalMax    = 100
+	loginGlobalWindow = time.Minute
+	loginGlobalDelay  = 2 * time.Second
+)
+
+// Proxy modes for clientIP, set with the -proxy flag.
+const (
+	ProxyNone   = "none"   // use the TCP peer address
+	ProxyFly    = "fly"    // Fly.io: Fly-Client-IP
+	ProxyRender = "render" // Render: True-Client-IP
+	ProxyXFF    = "xff"    // one trusted reverse proxy: last X-Forwarded-For entry
+)
+
+// clientIP returns the visitor's IP address. Forwarding headers are only
+// trusted when s.Proxy says a proxy that sets them sits in front of us;
+// otherwise anyone could pick their own IP and dodge the login limits.
+func (s *Server) clientIP(r *http.Request) string {
+	var ip string
+	switch s.Proxy {
+	case ProxyFly:
+		ip = r.Header.Get("Fly-Client-IP")
+	case ProxyRender:
+		ip = r.Header.Get("True-Client-IP")
+	case ProxyXFF:
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			parts := strings.Split(xff[len(xff)-1], ",")
+			ip = parts[len(parts)-1]
+		}
+	}
+	if parsed := net.ParseIP(strings.TrimSpace(ip)); parsed != nil {
+		return parsed.String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// sqliteWindow formats d as an SQLite datetime modifier reaching back d.
+func sqliteWindow(d time.Duration) string {
+	return fmt.Sprintf("-%d seconds", int64(d/time.Second))
+}
+
+// loginWait returns how long ip must wait before its next login attempt
+// as username, or zero if it may try now.
+func (s *Server) loginWait(ctx context.Context, ip, username string) (time.Duration, error) {
+	q := dbgen.New(s.DB)
+	window := sqliteWindow(loginLockout)
+	account, err := q.LoginFailuresByAccount(ctx, dbgen.LoginFailuresByAccountParams{Ip: ip, Username: username, Window: window})
+	if err != nil {
+		return 0, err
+	}
+	byIP, err := q.LoginFailuresByIP(ctx, dbgen.LoginFailuresByIPParams{Ip: ip, Window: window})
+	if err != nil {
+		return 0, err
+	}
+	return max(
+		loginBackoff(account.Failures, account.SecondsSinceLast, loginLockout),
+		loginBackoff(byIP.Failures, byIP.SecondsSinceLast, loginIPMaxWait),
+	), nil
+}
+
+// loginBackoff is the wait after failures, the last one secondsSince ago,
+// up to limit.
+func loginBackoff(failures, secondsSince int64, limit time.Duration) time.Duration {
+	var backoff time.Duration
+	switch {
+	case failures < loginFreeTries:
+		return 0
+	case failures < loginLockoutAfter:
+		backoff = time.Second << (failures - loginFreeTries)
+	default:
+		backoff = loginLockout
+	}
+	return max(min(backoff, limit)-time.Duration(secondsSince)*time.Second, 0)
+}
+
+// slowLogins holds a login attempt for loginGlobalDelay while failures
+// across all IPs are over loginGlobalMax. It returns early if the client
+// gives up.
+func (s *Server) slowLogins(ctx context.Context) {
+	n, err := dbgen.New(s.DB).CountRecentLoginFailures(ctx, sqliteWindow(loginGlobalWindow))
+	if err != nil || n < loginGlobalMax {
+		return
+	}
+	t := time.NewTimer(loginGlobalDelay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// recordLogin logs a login attempt; reason is empty for a success.
+func (s *Server) recordLogin(r *http.Request, ip, username, reason string) {
+	q := dbgen.New(s.DB)
+	err := q.InsertLoginAttempt(r.Context(), dbgen.InsertLoginAttemptParams{
+		Ip:        ip,
+		Username:  username,
+		Success:   boolInt(reason == ""),
+		Reason:    reason,
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		slog.Error("record login attempt", "error", err)
+	}
+	if reason == "" {
+		slog.Info("admin login", "ip", ip, "username", username)
+		q.DeleteOldLoginAttempts(r.Context())
+	} else {
+		slog.Warn("admin login refused", "ip", ip, "username", username, "reason", reason)
+	}
+}
+
+// handleLoginAttempts returns the most recent login attempts.
+func (s *Server) handleLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	attempts, err := dbgen.New(s.DB).ListLoginAttempts(r.Context())
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attempts)
+}
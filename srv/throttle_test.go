@@ -0,0 +1,70 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoginLockoutIsPerAccountAndIP(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	r := httptest.NewRequest("POST", "/admin/login", nil)
+	for range loginLockoutAfter {
+		s.recordLogin(r, "203.0.113.1", "admin", "wrong password")
+	}
+	// A flood from everywhere else, past the global limit.
+	for i := range loginGlobalMax {
+		s.recordLogin(r, fmt.Sprintf("198.51.100.%d", i%250), fmt.Sprintf("user%d", i), "unknown user")
+	}
+
+	tests := []struct {
+		ip, username string
+		min, max     time.Duration
+	}{
+		{"203.0.113.1", "admin", loginLockout - time.Minute, loginLockout},
+		{"203.0.113.1", "ADMIN", loginLockout - time.Minute, loginLockout},
+		// Other usernames from the same IP back off, but aren't locked out.
+		{"203.0.113.1", "someone", 1, loginIPMaxWait},
+		// Nobody else is locked out of the account.
+		{"192.0.2.7", "admin", 0, 0},
+	}
+	for _, tt := range tests {
+		wait, err := s.loginWait(ctx, tt.ip, tt.username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait < tt.min || wait > tt.max {
+			t.Errorf("loginWait(%s, %s) = %s, want %s to %s", tt.ip, tt.username, wait, tt.min, tt.max)
+		}
+	}
+
+	// The global limit delays rather than refusing.
+	start := time.Now()
+	s.slowLogins(ctx)
+	if d := time.Since(start); d < loginGlobalDelay {
+		t.Errorf("slowLogins returned after %s, want at least %s", d, loginGlobalDelay)
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	tests := []struct {
+		failures, since int64
+		limit           time.Duration
+		want            time.Duration
+	}{
+		{loginFreeTries - 1, 0, loginLockout, 0},
+		{loginFreeTries, 0, loginLockout, time.Second},
+		{loginFreeTries + 2, 1, loginLockout, 3 * time.Second},
+		{loginLockoutAfter, 60, loginLockout, loginLockout - time.Minute},
+		{loginLockoutAfter, 0, loginIPMaxWait, loginIPMaxWait},
+		{loginLockoutAfter, 3600, loginLockout, 0},
+	}
+	for _, tt := range tests {
+		if got := loginBackoff(tt.failures, tt.since, tt.limit); got != tt.want {
+			t.Errorf("loginBackoff(%d, %d, %s) = %s, want %s", tt.failures, tt.since, tt.limit, got, tt.want)
+		}
+	}
+}
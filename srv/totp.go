@@ -0,0 +1,356 @@
+package srv
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// TOTP parameters (RFC 6238 defaults, which every authenticator app
+// supports): HMAC-SHA1, 30 second steps, 6 digits. One step of clock skew
+// either way is accepted.
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1
+	totpIssuer        = "Shukarsh"
+	recoveryCodeCount = 10
+	mfaPendingTTL     = 5 * time.Minute
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func newTOTPSecret() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return totpEncoding.EncodeToString(b)
+}
+
+// totpCode computes the code for one time step (RFC 4226 HOTP).
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	n := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, n%1_000_000)
+}
+
+// totpVerify checks code against secret at time now and returns the step it
+// matched. Steps at or before lastStep are refused so a code works once.
+func totpVerify(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	cur := now.Unix() / totpPeriod
+	for step := cur - totpSkew; step <= cur+totpSkew; step++ {
+		if step > lastStep && subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURL is the otpauth:// URI authenticator apps read from the QR code.
+func totpURL(username, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", totpIssuer)
+	v.Set("period", fmt.Sprint(totpPeriod))
+	v.Set("digits", fmt.Sprint(totpDigits))
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+username) + "?" + v.Encode()
+}
+
+// newRecoveryCodes returns fresh codes formatted like "k3f9-x2mq-7hpa".
+func newRecoveryCodes() []string {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 12)
+		rand.Read(b)
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		codes[i] = string(b[:4]) + "-" + string(b[4:8]) + "-" + string(b[8:])
+	}
+	return codes
+}
+
+// recoveryCodeHash normalises a typed recovery code and hashes it. The codes
+// are random enough that a fast hash is fine.
+func recoveryCodeHash(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code for u, recording the use so neither works twice. u.TotpLastStep may
+// be stale by the time the code is recorded, so the update itself refuses
+// steps already used, and two logins racing with one code can't both pass.
+func (s *Server) checkSecondFactor(r *http.Request, u *dbgen.AdminUser, code string) (bool, error) {
+	q := dbgen.New(s.DB)
+	code = strings.TrimSpace(code)
+	if step, ok := totpVerify(u.TotpSecret, strings.ReplaceAll(code, " ", ""), u.TotpLastStep, time.Now()); ok {
+		n, err := q.SetTOTPLastStep(r.Context(), dbgen.SetTOTPLastStepParams{Step: step, ID: u.ID})
+		return n == 1, err
+	}
+	n, err := q.UseRecoveryCode(r.Context(), dbgen.UseRecoveryCodeParams{UserID: u.ID, CodeHash: recoveryCodeHash(code)})
+	return n == 1, err
+}
+
+// handleAdminLogin2FA shows the second login step for a session that passed
+// the password check.
+func (s *Server) handleAdminLogin2FA(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.pendingSession(r); !ok {
+		http.Redirect(w, r, "/admin/login", http.StatusFound)
+		return
+	}
+	csrf := s.csrfToken(w, r)
+	writeLoginPage(w, r.URL.Query().Get("error"), `  <form method="POST" action="/admin/login/2fa">
+    <input type="hidden" name="csrf_token" value="`+template.HTMLEscapeString(csrf)+`">
+    <div class="field">
+      <input type="text" name="code" placeholder="6-digit code or recovery code" inputmode="numeric" autocomplete="one-time-code" autofocus required>
+    </div>
+    <button type="submit" class="btn">Verify →</button>
+  </form>`)
+}
+
+func (s *Server) handleAdminLogin2FAPost(w http.ResponseWriter, r *http.Request) {
+	sess, ok := s.pendingSession(r)
+	if !ok {
+		http.Redirect(w, r, "/admin/login?error="+url.QueryEscape("Login expired, please sign in again"), http.StatusFound)
+		return
+	}
+	if !validCSRF(r, nil) {
+		http.Redirect(w, r, "/admin/login/2fa?error="+url.QueryEscape("Form expired, please try again"), http.StatusFound)
+		return
+	}
+	ip := s.clientIP(r)
+	u := &sess.AdminUser
+	wait, err := s.loginWait(r.Context(), ip, u.Username)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if wait > 0 {
+		s.recordLogin(r, ip, u.Username, "throttled")
+		msg := fmt.Sprintf("Too many failed attempts, try again in %s", wait.Round(time.Second))
+		http.Redirect(w, r, "/admin/login/2fa?error="+url.QueryEscape(msg), http.StatusFound)
+		return
+	}
+	s.slowLogins(r.Context())
+	ok, err = s.checkSecondFactor(r, u, r.FormValue("code"))
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if !ok {
+		s.recordLogin(r, ip, u.Username, "wrong code")
+		http.Redirect(w, r, "/admin/login/2fa?error="+url.QueryEscape("That code didn't work"), http.StatusFound)
+		return
+	}
+	dbgen.New(s.DB).RevokeSession(r.Context(), sess.Session.ID)
+	s.recordLogin(r, ip, u.Username, "")
+	if err := s.startSession(w, r, u, false); err != nil {
+		http.Error(w, "Failed to start session: "+err.Error(), 500)
+		return
+	}
+	s.redirectAfterLogin(w, r, u)
+}
+
+// handleAccount shows the signed-in user's own settings.
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	u := adminUser(r.Context())
+	if u == nil {
+		http.Error(w, "There are no accounts yet; add one under Team first", http.StatusNotFound)
+		return
+	}
+	left, _ := dbgen.New(s.DB).CountRecoveryCodes(r.Context(), u.ID)
+	s.templates.render(w, "account.html", map[string]any{
+		"Nav":               "account",
+		"SignedIn":          true,
+		"CSRFToken":         s.csrfToken(w, r),
+		"User":              u,
+		"RecoveryCodesLeft": left,
+		"CanEditCatalog":    roleAllows(u.Role, permEditCatalog),
+	})
+}
+
+// handleAccountTOTP reports the signed-in account's two-factor status.
+func (s *Server) handleAccountTOTP(w http.ResponseWriter, r *http.Request) {
+	u := adminUser(r.Context())
+	if u == nil {
+		jsonError(w, "Sign in to manage two-factor authentication", 400)
+		return
+	}
+	left, _ := dbgen.New(s.DB).CountRecoveryCodes(r.Context(), u.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"enabled": u.TotpEnabled == 1, "recovery_codes_left": left})
+}
+
+// handleAccountTOTPSetup starts enrolment: it stores a new secret and returns
+// it with a QR code to scan. Two-factor stays off until a code from the app
+// is confirmed with handleAccountTOTPEnable.
+func (s *Server) handleAccountTOTPSetup(w http.ResponseWriter, r *http.Request) {
+	u := adminUser(r.Context())
+	if u == nil {
+		jsonError(w, "Sign in to manage two-factor authentication", 400)
+		return
+	}
+	if u.TotpEnabled == 1 {
+		jsonError(w, "Two-factor authentication is already on; turn it off first", 400)
+		return
+	}
+	secret := newTOTPSecret()
+	if err := dbgen.New(s.DB).SetTOTPSecret(r.Context(), dbgen.SetTOTPSecretParams{TotpSecret: secret, ID: u.ID}); err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	uri := totpURL(u.Username, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		jsonError(w, "failed to generate QR code", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"secret": secret,
+		"url":    uri,
+		"qr":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// handleAccountTOTPEnable confirms enrolment with a code from the app and
+// returns a fresh set of recovery codes, which are only ever shown here.
+func (s *Server) handleAccountTOTPEnable(w http.ResponseWriter, r *http.Request) {
+	u := adminUser(r.Context())
+	if u == nil || u.TotpSecret == "" {
+		jsonError(w, "Start setup first", 400)
+		return
+	}
+	if u.TotpEnabled == 1 {
+		jsonError(w, "Two-factor authentication is already on", 400)
+		return
+	}
+	step, ok := totpVerify(u.TotpSecret, strings.TrimSpace(r.FormValue("code")), 0, time.Now())
+	if !ok {
+		jsonError(w, "That code didn't match; check the time on your phone and try again", 400)
+		return
+	}
+	tx, err := s.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	q := dbgen.New(tx)
+	if err := q.EnableTOTP(r.Context(), dbgen.EnableTOTPParams{TotpLastStep: step, ID: u.ID}); err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	codes, err := replaceRecoveryCodes(r.Context(), q, u.ID)
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "recovery_codes": codes})
+}
+
+// handleAccountRecoveryCodes replaces the account's recovery codes; it needs
+// a current code so a stolen session can't mint new ones.
+func (s *Server) handleAccountRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	u := adminUser(r.Context())
+	if u == nil || u.TotpEnabled == 0 {
+		jsonError(w, "Two-factor authentication is off", 400)
+		return
+	}
+	if ok, err := s.checkSecondFactor(r, u, r.FormValue("code")); err != nil || !ok {
+		jsonError(w, "That code didn't work", 400)
+		return
+	}
+	tx, err := s.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	codes, err := replaceRecoveryCodes(r.Context(), dbgen.New(tx), u.ID)
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "recovery_codes": codes})
+}
+
+// handleAccountTOTPDisable turns two-factor off after checking a current
+// code or recovery code.
+func (s *Server) handleAccountTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	u := adminUser(r.Context())
+	if u == nil || u.TotpEnabled == 0 {
+		jsonError(w, "Two-factor authentication is off", 400)
+		return
+	}
+	if ok, err := s.checkSecondFactor(r, u, r.FormValue("code")); err != nil || !ok {
+		jsonError(w, "That code didn't work", 400)
+		return
+	}
+	if err := resetTOTP(r.Context(), dbgen.New(s.DB), u.ID); err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true})
+}
+
+// resetTOTP turns two-factor off for an account and drops its recovery codes.
+func resetTOTP(ctx context.Context, q *dbgen.Queries, userID int64) error {
+	if err := q.DisableTOTP(ctx, userID); err != nil {
+		return err
+	}
+	return q.DeleteRecoveryCodes(ctx, userID)
+}
+
+func replaceRecoveryCodes(ctx context.Context, q *dbgen.Queries, userID int64) ([]string, error) {
+	if err := q.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+	codes := newRecoveryCodes()
+	for _, c := range codes {
+		if err := q.InsertRecoveryCode(ctx, dbgen.InsertRecoveryCodeParams{UserID: userID, CodeHash: recoveryCodeHash(c)}); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
@@ -0,0 +1,145 @@
+package srv
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// RFC 6238 appendix B, SHA-1, cut to our six digits.
+func TestTOTPVectors(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		step, ok := totpVerify(secret, tt.code, 0, time.Unix(tt.unix, 0))
+		if !ok || step != tt.unix/totpPeriod {
+			t.Errorf("at %d: code %s gave step %d, %v; want %d, true", tt.unix, tt.code, step, ok, tt.unix/totpPeriod)
+		}
+		if _, ok := totpVerify(secret, tt.code, tt.unix/totpPeriod, time.Unix(tt.unix, 0)); ok {
+			t.Errorf("at %d: code accepted again after its step was used", tt.unix)
+		}
+	}
+}
+
+// enrolTOTP turns on two-factor login for the test server's owner.
+func enrolTOTP(t *testing.T, s *Server) dbgen.AdminUser {
+	t.Helper()
+	ctx := context.Background()
+	q := dbgen.New(s.DB)
+	u, err := q.GetAdminUserByUsername(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.SetTOTPSecret(ctx, dbgen.SetTOTPSecretParams{TotpSecret: newTOTPSecret(), ID: u.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.EnableTOTP(ctx, dbgen.EnableTOTPParams{ID: u.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if u, err = q.GetAdminUserByUsername(ctx, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func currentTOTP(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(key, time.Now().Unix()/totpPeriod)
+}
+
+// Logins that read the account before either records the code must not
+// both get in with it.
+func TestTOTPConcurrentReplay(t *testing.T) {
+	s := newTestServer(t)
+	u := enrolTOTP(t, s)
+	code := currentTOTP(t, u.TotpSecret)
+
+	const logins = 8
+	var wg sync.WaitGroup
+	results := make(chan bool, logins)
+	for range logins {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stale := u // as loaded with the pending session
+			ok, err := s.checkSecondFactor(httptest.NewRequest("POST", "/admin/login/2fa", nil), &stale, code)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- ok
+		}()
+	}
+	wg.Wait()
+	close(results)
+	accepted := 0
+	for ok := range results {
+		if ok {
+			accepted++
+		}
+	}
+	if accepted != 1 {
+		t.Errorf("code accepted %d times, want once", accepted)
+	}
+}
+
+func TestRecoveryCodeSingleUse(t *testing.T) {
+	s := newTestServer(t)
+	u := enrolTOTP(t, s)
+	ctx := context.Background()
+	q := dbgen.New(s.DB)
+	codes := newRecoveryCodes()
+	for _, c := range codes {
+		if err := q.InsertRecoveryCode(ctx, dbgen.InsertRecoveryCodeParams{UserID: u.ID, CodeHash: recoveryCodeHash(c)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := httptest.NewRequest("POST", "/admin/login/2fa", nil)
+	check := func(code string) bool {
+		t.Helper()
+		ok, err := s.checkSecondFactor(r, &u, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	if !check(codes[0]) {
+		t.Fatal("unused recovery code refused")
+	}
+	if check(codes[0]) {
+		t.Error("recovery code accepted twice")
+	}
+	// Typed without dashes, in capitals, with spaces around it.
+	if !check("  " + strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")) + " ") {
+		t.Error("reformatted recovery code refused")
+	}
+	if check("abcd-efgh-jkmn") {
+		t.Error("made-up recovery code accepted")
+	}
+	left, err := q.CountRecoveryCodes(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left != recoveryCodeCount-2 {
+		t.Errorf("%d recovery codes left, want %d", left, recoveryCodeCount-2)
+	}
+}
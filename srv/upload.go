@@ -0,0 +1,310 @@
+package srv
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Uploaded images are served from our own origin, so nothing is kept as
+// it was sent. The bytes must sniff as an image and decode in full, then
+// are encoded again, which drops EXIF (GPS positions, camera serials) and
+// anything appended to the file. Files are named by the SHA-256 of what
+// is written, so uploading the same image twice gives the same URL.
+
+// Upload limits. The number of pixels is limited by Server.ImageMemory,
+// so /img can still resize what's uploaded.
+const (
+	maxUploadBytes = 10 << 20
+	maxUploadSide  = 8000
+)
+
+// uploadTypes are the content types accepted, as sniffed from the bytes,
+// and the image package's name for each.
+var uploadTypes = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// uploadError is a rejected upload, with the status and message for the
+// admin panel.
+type uploadError struct {
+	status int
+	msg    string
+}
+
+func (e *uploadError) Error() string { return e.msg }
+
+func rejectUpload(status int, format string, args ...any) error {
+	return &uploadError{status, fmt.Sprintf(format, args...)}
+}
+
+func (s *Server) handleUploadImage(w http.ResponseWriter, r *http.Request) {
+	// Room for the form's own fields and boundaries on top of the file.
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes+64<<10)
+	if err := r.ParseMultipartForm(maxUploadBytes); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			jsonError(w, "Image is too large: the limit is 10 MB", http.StatusRequestEntityTooLarge)
+			return
+		}
+		jsonError(w, "Upload must be a multipart form with the image in a \"file\" field", 400)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		jsonError(w, "No file uploaded", 400)
+		return
+	}
+	defer file.Close()
+	if header.Size > maxUploadBytes {
+		jsonError(w, "Image is too large: the limit is 10 MB", http.StatusRequestEntityTooLarge)
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		jsonError(w, "Failed to read upload", 500)
+		return
+	}
+
+	out, ext, err := sanitizeImage(data, s.maxDecodePixels())
+	var rejected *uploadError
+	if errors.As(err, &rejected) {
+		jsonError(w, rejected.msg, rejected.status)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to process image", 500)
+		return
+	}
+
+	sum := sha256.Sum256(out)
+	filename := hex.EncodeToString(sum[:]) + ext
+	path := filepath.Join(s.UploadsDir, filename)
+	_, err = os.Stat(path)
+	duplicate := err == nil
+	if !duplicate {
+		// Written under another name first, so a failed write never
+		// leaves a truncated image at the real one.
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, out, 0o644); err != nil {
+			os.Remove(tmp)
+			jsonError(w, "Failed to save file", 500)
+			return
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			jsonError(w, "Failed to save file", 500)
+			return
+		}
+	}
+
+	url := "/uploads/" + filename
+	s.logUpload(r, url, header.Filename, int64(len(out)))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "url": url, "duplicate": duplicate})
+}
+
+// sanitizeImage checks an uploaded image and encodes it again without its
+// metadata, returning the new bytes and their file extension. JPEGs stay
+// JPEG, turned upright first since their EXIF orientation goes with the
+// rest; opaque lossy WebPs stay WebP; everything else becomes PNG, so
+// lossless WebPs aren't made lossy. GIFs keep
+// only their first frame: product photos aren't animated, and every frame
+// of a hostile GIF would have to be held in memory. Images of more than
+// maxPixels pixels are refused.
+func sanitizeImage(data []byte, maxPixels int) ([]byte, string, error) {
+	contentType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	format, ok := uploadTypes[contentType]
+	if !ok {
+		return nil, "", rejectUpload(http.StatusUnsupportedMediaType,
+			"Only JPEG, PNG, GIF and WebP images are allowed, and this file is %s", contentType)
+	}
+	cfg, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decoded != format {
+		return nil, "", rejectUpload(400, "Image is damaged or isn't really a %s", format)
+	}
+	if cfg.Width < 1 || cfg.Height < 1 {
+		return nil, "", rejectUpload(400, "Image has no pixels")
+	}
+	if cfg.Width > maxUploadSide || cfg.Height > maxUploadSide {
+		return nil, "", rejectUpload(400, "Image is %d×%d pixels: the longest side can be at most %d",
+			cfg.Width, cfg.Height, maxUploadSide)
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, "", rejectUpload(400, "Image is %d×%d pixels: at most %.1f megapixels are allowed",
+			cfg.Width, cfg.Height, float64(maxPixels)/1e6)
+	}
+
+	decodeSlot <- struct{}{}
+	defer func() { <-decodeSlot }()
+	img, _, err := decodeImage(data)
+	if err != nil {
+		return nil, "", rejectUpload(400, "Image is damaged or incomplete: %v", err)
+	}
+
+	var buf bytes.Buffer
+	var ext string
+	switch {
+	case format == "jpeg":
+		img = orient(img, jpegOrientation(data))
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+		ext = ".jpg"
+	case format == "webp" && opaque(img) && !webpLossless(data):
+		err = encodeWebP(&buf, img, 90)
+		ext = ".webp"
+	default:
+		err = png.Encode(&buf, img)
+		ext = ".png"
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), ext, nil
+}
+
+// opaque reports whether an image has no transparent pixels, for the types
+// that can tell.
+func opaque(img image.Image) bool {
+	o, ok := img.(interface{ Opaque() bool })
+	return !ok || o.Opaque()
+}
+
+// webpLossless reports whether a WebP holds a lossless (VP8L) image, as
+// its first image chunk.
+func webpLossless(data []byte) bool {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return false
+	}
+	for i := 12; i+8 <= len(data); {
+		switch string(data[i : i+4]) {
+		case "VP8L":
+			return true
+		case "VP8 ":
+			return false
+		}
+		n := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if n < 0 || n > len(data) {
+			return false
+		}
+		// Chunks are padded to an even length.
+		i += 8 + n + n&1
+	}
+	return false
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG, 1 to 8, or 1 if
+// it has none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			// Start of the image data: metadata comes before it.
+			return 1
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			return 1
+		}
+		seg := data[i+4 : i+2+n]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return exifOrientation(seg[6:])
+		}
+		i += 2 + n
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of EXIF
+// data in TIFF layout.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := range count {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		// Tag 0x0112, a SHORT.
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient turns an image with the given EXIF orientation upright.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// Orientations 5 to 8 swap width and height.
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := range h {
+		for x := range w {
+			var dx, dy int
+			switch orientation {
+			case 2: // flip left to right
+				dx, dy = w-1-x, y
+			case 3: // turn 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // flip top to bottom
+				dx, dy = x, h-1-y
+			case 5: // flip along the main diagonal
+				dx, dy = y, x
+			case 6: // turn 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // flip along the other diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // turn 90° anticlockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
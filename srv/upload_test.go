@@ -0,0 +1,381 @@
+package srv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math/rand/v2"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// testMaxPixels is the pixel limit at the default image memory.
+var testMaxPixels = (&Server{ImageMemory: 96 << 20}).maxDecodePixels()
+
+// exifSecret stands in for the GPS position and camera serial number a
+// phone writes into a photo.
+const exifSecret = "GPS 12.9716N 77.5946E serial SN-48151623"
+
+// withEXIF returns a JPEG of img with an EXIF segment giving orientation,
+// laid out in order.
+func withEXIF(t *testing.T, img image.Image, orientation int, order binary.AppendByteOrder) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	tiff := []byte("MM")
+	if order == binary.AppendByteOrder(binary.LittleEndian) {
+		tiff = []byte("II")
+	}
+	tiff = order.AppendUint16(tiff, 42)
+	tiff = order.AppendUint32(tiff, 8) // first IFD
+	tiff = order.AppendUint16(tiff, 1) // entries
+	tiff = order.AppendUint16(tiff, 0x0112)
+	tiff = order.AppendUint16(tiff, 3) // SHORT
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, uint16(orientation))
+	tiff = order.AppendUint16(tiff, 0)
+	tiff = order.AppendUint32(tiff, 0) // no next IFD
+	tiff = append(tiff, exifSecret...)
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+
+	jpg := buf.Bytes()
+	out := append([]byte{}, jpg[:2]...) // SOI
+	out = append(out, 0xFF, 0xE1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(seg)+2))
+	out = append(out, seg...)
+	return append(out, jpg[2:]...)
+}
+
+// jpegMarkers lists the markers of a JPEG's segments up to the image data.
+func jpegMarkers(data []byte) []byte {
+	var markers []byte
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		markers = append(markers, data[i+1])
+		if data[i+1] == 0xDA {
+			break
+		}
+		i += 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+	}
+	return markers
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// noise is a w×h image of random colours, which compresses badly.
+func noise(w, h int) *image.RGBA {
+	rnd := rand.New(rand.NewPCG(3, 4))
+	return fillImage(w, h, func(x, y int) color.RGBA {
+		return color.RGBA{uint8(rnd.IntN(256)), uint8(rnd.IntN(256)), uint8(rnd.IntN(256)), 255}
+	})
+}
+
+func TestSanitizeImageStripsEXIF(t *testing.T) {
+	data := withEXIF(t, noise(32, 24), 1, binary.BigEndian)
+	if !bytes.Contains(data, []byte(exifSecret)) || !bytes.Contains(jpegMarkers(data), []byte{0xE1}) {
+		t.Fatal("test JPEG has no EXIF")
+	}
+	out, ext, err := sanitizeImage(data, testMaxPixels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext != ".jpg" {
+		t.Errorf("extension %q, want .jpg", ext)
+	}
+	if markers := jpegMarkers(out); bytes.Contains(markers, []byte{0xE1}) {
+		t.Errorf("output has an APP1 segment: markers % X", markers)
+	}
+	if bytes.Contains(out, []byte(exifSecret)) {
+		t.Error("output still holds the EXIF data")
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	for o := 1; o <= 8; o++ {
+		for _, order := range []binary.AppendByteOrder{binary.BigEndian, binary.LittleEndian} {
+			if got := jpegOrientation(withEXIF(t, noise(8, 8), o, order)); got != o {
+				t.Errorf("orientation %d (%T): read %d", o, order, got)
+			}
+		}
+	}
+	for _, o := range []int{0, 9} {
+		if got := jpegOrientation(withEXIF(t, noise(8, 8), o, binary.BigEndian)); got != 1 {
+			t.Errorf("out of range orientation %d: read %d, want 1", o, got)
+		}
+	}
+	if got := jpegOrientation([]byte("\xFF\xD8\xFF\xE1\x00")); got != 1 {
+		t.Errorf("truncated JPEG: read %d, want 1", got)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3×2 image with red and green as the first two stored pixels. Where
+	// they end up follows the EXIF definition of each orientation: which
+	// sides of the picture the stored first row and first column are on.
+	red := color.RGBA{255, 0, 0, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	src := fillImage(3, 2, func(x, y int) color.RGBA { return color.RGBA{255, 255, 255, 255} })
+	src.SetRGBA(0, 0, red)
+	src.SetRGBA(1, 0, green)
+
+	tests := []struct {
+		orientation int
+		size        image.Point
+		red, green  image.Point
+	}{
+		{1, image.Pt(3, 2), image.Pt(0, 0), image.Pt(1, 0)}, // row 0 top, column 0 left
+		{2, image.Pt(3, 2), image.Pt(2, 0), image.Pt(1, 0)}, // top, right
+		{3, image.Pt(3, 2), image.Pt(2, 1), image.Pt(1, 1)}, // bottom, right
+		{4, image.Pt(3, 2), image.Pt(0, 1), image.Pt(1, 1)}, // bottom, left
+		{5, image.Pt(2, 3), image.Pt(0, 0), image.Pt(0, 1)}, // left, top
+		{6, image.Pt(2, 3), image.Pt(1, 0), image.Pt(1, 1)}, // right, top
+		{7, image.Pt(2, 3), image.Pt(1, 2), image.Pt(1, 1)}, // right, bottom
+		{8, image.Pt(2, 3), image.Pt(0, 2), image.Pt(0, 1)}, // left, bottom
+	}
+	for _, tt := range tests {
+		m := orient(src, tt.orientation)
+		if m.Bounds().Size() != tt.size {
+			t.Errorf("orientation %d: size %v, want %v", tt.orientation, m.Bounds().Size(), tt.size)
+			continue
+		}
+		if c := color.RGBAModel.Convert(m.At(tt.red.X, tt.red.Y)); c != red {
+			t.Errorf("orientation %d: %v is %v, want red", tt.orientation, tt.red, c)
+		}
+		if c := color.RGBAModel.Convert(m.At(tt.green.X, tt.green.Y)); c != green {
+			t.Errorf("orientation %d: %v is %v, want green", tt.orientation, tt.green, c)
+		}
+	}
+
+	// Uploads are turned upright.
+	out, _, err := sanitizeImage(withEXIF(t, noise(32, 16), 6, binary.BigEndian), testMaxPixels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 16 || cfg.Height != 32 {
+		t.Errorf("32×16 upload turned 90°: %d×%d, want 16×32", cfg.Width, cfg.Height)
+	}
+}
+
+func TestSanitizeImageRejects(t *testing.T) {
+	html := []byte(`<!DOCTYPE html><html><body><script>alert(document.cookie)</script></body></html>`)
+	validPNG := encodePNG(t, noise(64, 64))
+	tests := []struct {
+		name   string
+		data   []byte
+		status int
+	}{
+		{"html", html, http.StatusUnsupportedMediaType},
+		{"svg", []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"/>`), http.StatusUnsupportedMediaType},
+		{"bare svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`), http.StatusUnsupportedMediaType},
+		{"bmp", append([]byte("BM"), make([]byte, 64)...), http.StatusUnsupportedMediaType},
+		{"html after a GIF header", append([]byte("GIF89a"), html...), 400},
+		{"html after a PNG signature", append([]byte("\x89PNG\r\n\x1a\n"), html...), 400},
+		{"truncated png", validPNG[:len(validPNG)/2], 400},
+		{"empty", nil, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		_, _, err := sanitizeImage(tt.data, testMaxPixels)
+		var rejected *uploadError
+		if !errors.As(err, &rejected) {
+			t.Errorf("%s: %v, want the upload rejected", tt.name, err)
+			continue
+		}
+		if rejected.status != tt.status {
+			t.Errorf("%s: status %d (%s), want %d", tt.name, rejected.status, rejected.msg, tt.status)
+		}
+	}
+}
+
+func TestSanitizeImageDropsPolyglotPayload(t *testing.T) {
+	payload := []byte("<html><script>alert(document.cookie)</script>PK\x03\x04polyglot.zip")
+
+	var gifBuf bytes.Buffer
+	pal := image.NewPaletted(image.Rect(0, 0, 16, 16), color.Palette{color.Black, color.White})
+	if err := gif.Encode(&gifBuf, pal, nil); err != nil {
+		t.Fatal(err)
+	}
+	// A JPEG with the payload in a comment segment as well as after it.
+	var jpgBuf bytes.Buffer
+	if err := jpeg.Encode(&jpgBuf, noise(16, 16), nil); err != nil {
+		t.Fatal(err)
+	}
+	jpg := append([]byte{0xFF, 0xD8, 0xFF, 0xFE}, binary.BigEndian.AppendUint16(nil, uint16(len(payload)+2))...)
+	jpg = append(jpg, payload...)
+	jpg = append(jpg, jpgBuf.Bytes()[2:]...)
+
+	tests := []struct {
+		name string
+		data []byte
+		ext  string
+	}{
+		{"png", encodePNG(t, noise(16, 16)), ".png"},
+		{"jpeg", jpg, ".jpg"},
+		{"gif", gifBuf.Bytes(), ".png"},
+	}
+	for _, tt := range tests {
+		data := append(bytes.Clone(tt.data), payload...)
+		out, ext, err := sanitizeImage(data, testMaxPixels)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if ext != tt.ext {
+			t.Errorf("%s: extension %q, want %q", tt.name, ext, tt.ext)
+		}
+		if bytes.Contains(out, []byte("<script>")) || bytes.Contains(out, []byte("PK\x03\x04")) {
+			t.Errorf("%s: payload kept in the output", tt.name)
+		}
+		if _, _, err := image.Decode(bytes.NewReader(out)); err != nil {
+			t.Errorf("%s: output doesn't decode: %v", tt.name, err)
+		}
+	}
+}
+
+func TestSanitizeImageLimits(t *testing.T) {
+	// Too long a side, however few pixels.
+	_, _, err := sanitizeImage(encodePNG(t, image.NewGray(image.Rect(0, 0, maxUploadSide+1, 1))), testMaxPixels)
+	if !errors.As(err, new(*uploadError)) {
+		t.Errorf("%d×1 image: %v, want it rejected", maxUploadSide+1, err)
+	}
+
+	data := encodePNG(t, noise(100, 100))
+	if _, _, err := sanitizeImage(data, 100*100-1); !errors.As(err, new(*uploadError)) {
+		t.Errorf("100×100 image over the limit: %v, want it rejected", err)
+	}
+	if _, _, err := sanitizeImage(data, 100*100); err != nil {
+		t.Errorf("100×100 image at the limit: %v", err)
+	}
+
+	// A small file whose header claims 5000×5000 pixels is refused before
+	// anything is decoded.
+	bomb := bytes.Clone(encodePNG(t, noise(4, 4)))
+	binary.BigEndian.PutUint32(bomb[16:], 5000)
+	binary.BigEndian.PutUint32(bomb[20:], 5000)
+	binary.BigEndian.PutUint32(bomb[29:], crc32.ChecksumIEEE(bomb[12:29]))
+	if cfg, err := png.DecodeConfig(bytes.NewReader(bomb)); err != nil || cfg.Width != 5000 {
+		t.Fatalf("test PNG header: %v, %+v", err, cfg)
+	}
+	_, _, err = sanitizeImage(bomb, testMaxPixels)
+	var rejected *uploadError
+	if !errors.As(err, &rejected) || !regexp.MustCompile(`megapixels`).MatchString(rejected.msg) {
+		t.Errorf("5000×5000 header: %v, want it rejected for its pixels", err)
+	}
+}
+
+func TestSanitizeImageWebP(t *testing.T) {
+	// Opaque lossy WebPs stay WebP, in their full range.
+	var buf bytes.Buffer
+	if err := encodeWebP(&buf, blackAndWhite(64, 32), 90); err != nil {
+		t.Fatal(err)
+	}
+	out, ext, err := sanitizeImage(buf.Bytes(), testMaxPixels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext != ".webp" {
+		t.Errorf("lossy WebP saved as %q, want .webp", ext)
+	}
+	m, _, err := decodeImage(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBlackAndWhite(t, "lossy WebP upload", m, 4)
+
+	// Lossless ones become PNG, pixel for pixel. The file is from
+	// golang.org/x/image's test data.
+	data, err := os.ReadFile("testdata/gopher.lossless.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !webpLossless(data) || webpLossless(buf.Bytes()) {
+		t.Fatal("webpLossless can't tell the test files apart")
+	}
+	out, ext, err = sanitizeImage(data, testMaxPixels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext != ".png" {
+		t.Errorf("lossless WebP saved as %q, want .png", ext)
+	}
+	want, _, _ := decodeImage(data)
+	got, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := psnr(want, got); p < 100 {
+		t.Errorf("lossless WebP changed: PSNR %.1f dB", p)
+	}
+}
+
+// upload posts an image to /api/upload and returns the response.
+func (c *testClient) upload(csrf string, data []byte) (status int, url string, duplicate bool) {
+	c.t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "photo.png")
+	fw.Write(data)
+	mw.Close()
+	req, err := http.NewRequest("POST", c.base+"/api/upload", &body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set(csrfHeader, csrf)
+	resp, respBody := c.do(req)
+	var res struct {
+		URL       string `json:"url"`
+		Duplicate bool   `json:"duplicate"`
+	}
+	json.Unmarshal([]byte(respBody), &res)
+	return resp.StatusCode, res.URL, res.Duplicate
+}
+
+func TestUploadSameImageSameName(t *testing.T) {
+	s := newTestServer(t)
+	c := newTestClient(t, s)
+	csrf := c.login()
+
+	data := encodePNG(t, noise(20, 20))
+	status, first, dup := c.upload(csrf, data)
+	if status != 200 || dup {
+		t.Fatalf("first upload: %d, duplicate %v", status, dup)
+	}
+	if !regexp.MustCompile(`^/uploads/[0-9a-f]{64}\.png$`).MatchString(first) {
+		t.Errorf("url %q isn't named by a hash", first)
+	}
+	status, second, dup := c.upload(csrf, bytes.Clone(data))
+	if status != 200 || !dup || second != first {
+		t.Errorf("same bytes again: %d, %q, duplicate %v; want %q, duplicate", status, second, dup, first)
+	}
+	if _, other, _ := c.upload(csrf, encodePNG(t, noise(21, 20))); other == first {
+		t.Error("a different image got the same name")
+	}
+
+	files, _ := filepath.Glob(filepath.Join(s.UploadsDir, "*.png"))
+	if len(files) != 2 {
+		t.Errorf("uploads dir has %d images, want 2", len(files))
+	}
+}
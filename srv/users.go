@@ -0,0 +1,258 @@
+package srv
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// apiAdminUser is the JSON shape of a staff account; it leaves out the
+// password hash.
+type apiAdminUser struct {
+	ID          int64        `json:"id"`
+	Username    string       `json:"username"`
+	Name        string       `json:"name"`
+	Role        string       `json:"role"`
+	Disabled    bool         `json:"disabled"`
+	TOTPEnabled bool         `json:"totp_enabled"`
+	CreatedAt   time.Time    `json:"created_at"`
+	LastLoginAt *time.Time   `json:"last_login_at"`
+	Sessions    []apiSession `json:"sessions"`
+}
+
+type apiSession struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+// handleListUsers returns every staff account with its live sessions.
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	q := dbgen.New(s.DB)
+	users, err := q.ListAdminUsers(r.Context())
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	current := ""
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		current = sessionID(c.Value)
+	}
+	now := time.Now()
+	out := make([]apiAdminUser, 0, len(users))
+	for _, u := range users {
+		au := apiAdminUser{
+			ID:          u.ID,
+			Username:    u.Username,
+			Name:        u.Name,
+			Role:        u.Role,
+			Disabled:    u.Disabled != 0,
+			TOTPEnabled: u.TotpEnabled != 0,
+			CreatedAt:   u.CreatedAt,
+			LastLoginAt: u.LastLoginAt,
+			Sessions:    []apiSession{},
+		}
+		sessions, _ := q.ListUserSessions(r.Context(), u.ID)
+		for _, ss := range sessions {
+			if now.After(ss.ExpiresAt) {
+				continue
+			}
+			au.Sessions = append(au.Sessions, apiSession{
+				ID:         ss.ID,
+				UserAgent:  ss.UserAgent,
+				IP:         ss.Ip,
+				CreatedAt:  ss.CreatedAt,
+				LastSeenAt: ss.LastSeenAt,
+				Current:    ss.ID == current,
+			})
+		}
+		out = append(out, au)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// handleAddUser creates a staff account from the username, name, role and
+// password form fields.
+func (s *Server) handleAddUser(w http.ResponseWriter, r *http.Request) {
+	username := strings.TrimSpace(r.FormValue("username"))
+	role := r.FormValue("role")
+	if username == "" {
+		jsonError(w, "Username is required", 400)
+		return
+	}
+	if !validRole(role) {
+		jsonError(w, "Role must be owner, editor or analyst", 400)
+		return
+	}
+	hash, err := hashPassword(r.FormValue("password"))
+	if err != nil {
+		jsonError(w, err.Error(), 400)
+		return
+	}
+	q := dbgen.New(s.DB)
+	if _, err := q.GetAdminUserByUsername(r.Context(), username); err == nil {
+		jsonError(w, "That username is taken", 400)
+		return
+	}
+	u, err := q.InsertAdminUser(r.Context(), dbgen.InsertAdminUserParams{
+		Username:     username,
+		Name:         strings.TrimSpace(r.FormValue("name")),
+		PasswordHash: hash,
+		Role:         role,
+	})
+	if err != nil {
+		jsonError(w, "Failed to add user: "+err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true, "id": u.ID})
+}
+
+// handleUpdateUser changes a staff account's name, role, disabled flag and,
+// if the password field is set, its password; reset_totp=1 turns off its
+// two-factor authentication for someone who lost their phone. Disabling an
+// account or changing its password signs it out everywhere. The last active owner can't
+// be demoted or disabled.
+func (s *Server) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid ID", 400)
+		return
+	}
+	tx, err := s.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	q := dbgen.New(tx)
+	u, err := q.GetAdminUser(r.Context(), id)
+	if err != nil {
+		jsonError(w, "User not found", 404)
+		return
+	}
+	name, role, disabled := u.Name, u.Role, u.Disabled
+	if v := r.FormValue("name"); r.Form.Has("name") {
+		name = strings.TrimSpace(v)
+	}
+	if v := r.FormValue("role"); v != "" {
+		if !validRole(v) {
+			jsonError(w, "Role must be owner, editor or analyst", 400)
+			return
+		}
+		role = v
+	}
+	if v := r.FormValue("disabled"); v != "" {
+		disabled = boolInt(v == "1" || v == "true")
+	}
+	if u.Role == RoleOwner && u.Disabled == 0 && (role != RoleOwner || disabled != 0) {
+		n, err := q.CountActiveOwners(r.Context())
+		if err != nil {
+			jsonError(w, err.Error(), 500)
+			return
+		}
+		if n <= 1 {
+			jsonError(w, "Can't demote or disable the last owner", 400)
+			return
+		}
+	}
+	err = q.UpdateAdminUser(r.Context(), dbgen.UpdateAdminUserParams{Name: name, Role: role, Disabled: disabled, ID: id})
+	if err != nil {
+		jsonError(w, "Failed to update user: "+err.Error(), 500)
+		return
+	}
+	signOut := disabled != 0 && u.Disabled == 0
+	if password := r.FormValue("password"); password != "" {
+		hash, err := hashPassword(password)
+		if err != nil {
+			jsonError(w, err.Error(), 400)
+			return
+		}
+		if err := q.SetAdminUserPassword(r.Context(), dbgen.SetAdminUserPasswordParams{PasswordHash: hash, ID: id}); err != nil {
+			jsonError(w, "Failed to set password: "+err.Error(), 500)
+			return
+		}
+		signOut = true
+	}
+	if r.FormValue("reset_totp") == "1" {
+		if err := resetTOTP(r.Context(), q, id); err != nil {
+			jsonError(w, err.Error(), 500)
+			return
+		}
+	}
+	if signOut {
+		if err := q.RevokeUserSessions(r.Context(), id); err != nil {
+			jsonError(w, err.Error(), 500)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true})
+}
+
+// handleDeleteUser removes a staff account and its sessions.
+func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid ID", 400)
+		return
+	}
+	if me := adminUser(r.Context()); me != nil && me.ID == id {
+		jsonError(w, "You can't delete your own account", 400)
+		return
+	}
+	tx, err := s.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	defer tx.Rollback()
+	q := dbgen.New(tx)
+	u, err := q.GetAdminUser(r.Context(), id)
+	if err != nil {
+		jsonError(w, "User not found", 404)
+		return
+	}
+	if u.Role == RoleOwner && u.Disabled == 0 {
+		if n, _ := q.CountActiveOwners(r.Context()); n <= 1 {
+			jsonError(w, "Can't delete the last owner", 400)
+			return
+		}
+	}
+	if err := q.DeleteUserSessions(r.Context(), id); err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	if err := q.DeleteAdminUser(r.Context(), id); err != nil {
+		jsonError(w, "Failed to delete user: "+err.Error(), 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true})
+}
+
+// handleRevokeSession signs one session out.
+func (s *Server) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	if err := dbgen.New(s.DB).RevokeSession(r.Context(), r.PathValue("id")); err != nil {
+		jsonError(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"ok": true})
+}
@@ -0,0 +1,150 @@
+package srv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"srv.exe.dev/db/dbgen"
+)
+
+// variantInput is one entry of the "variants" form field sent to /api/add and
+// /api/update/{id}: a JSON array such as
+//
+//	[{"id":3,"size":"M","colour":"Black","price":"₹399"},{"size":"L","price":449}]
+//
+// Entries with an id update that variant, entries without one are inserted,
+// and existing variants left out of the array are deleted.
+type variantInput struct {
+	ID            int64  `json:"id"`
+	Size          string `json:"size"`
+	Colour        string `json:"colour"`
+	Pack          string `json:"pack"`
+	Price         Money  `json:"price"`
+	OriginalPrice Money  `json:"original_price"`
+	ImageURL      string `json:"image_url"`
+}
+
+// apiVariant is the JSON shape of a variant returned by the /api endpoints.
+type apiVariant struct {
+	dbgen.ProductVariant
+	Label         string `json:"label"`
+	Price         Money  `json:"price"`
+	OriginalPrice Money  `json:"original_price"`
+}
+
+func toAPIVariants(vs []dbgen.ProductVariant) []apiVariant {
+	out := make([]apiVariant, 0, len(vs))
+	for _, v := range vs {
+		out = append(out, apiVariant{
+			ProductVariant: v,
+			Label:          variantLabel(v),
+			Price:          Money(v.PricePaise),
+			OriginalPrice:  Money(v.OriginalPricePaise),
+		})
+	}
+	return out
+}
+
+// variantLabel joins the non-empty options, e.g. "M · Black · Pack of 2".
+func variantLabel(v dbgen.ProductVariant) string {
+	var parts []string
+	for _, s := range []string{v.Size, v.Colour, v.Pack} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, " · ")
+}
+
+// parseVariants reads the "variants" form field. ok is false when the field
+// was not sent at all, so updates that don't touch variants leave them alone;
+// an empty string or "[]" removes every variant.
+func parseVariants(r *http.Request) (vs []variantInput, ok bool, err error) {
+	raw := r.FormValue("variants")
+	if _, ok = r.Form["variants"]; !ok {
+		return nil, false, nil
+	}
+	if strings.TrimSpace(raw) == "" {
+		return nil, true, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &vs); err != nil {
+		return nil, true, fmt.Errorf("invalid variants: %w", err)
+	}
+	for i := range vs {
+		v := &vs[i]
+		v.Size = strings.TrimSpace(v.Size)
+		v.Colour = strings.TrimSpace(v.Colour)
+		v.Pack = strings.TrimSpace(v.Pack)
+		v.ImageURL = strings.TrimSpace(v.ImageURL)
+		if v.Size == "" && v.Colour == "" && v.Pack == "" {
+			return nil, true, fmt.Errorf("variant %d needs a size, colour or pack", i+1)
+		}
+	}
+	return vs, true, nil
+}
+
+// saveVariants makes the product's variants match vs. Call it with a
+// transaction-bound q so a bad row doesn't leave a half-applied list.
+func saveVariants(ctx context.Context, q *dbgen.Queries, productID int64, vs []variantInput) error {
+	existing, err := q.ListProductVariants(ctx, productID)
+	if err != nil {
+		return err
+	}
+	keep := map[int64]bool{}
+	for i, v := range vs {
+		if v.ID != 0 {
+			found := false
+			for _, e := range existing {
+				if e.ID == v.ID {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("variant %d does not belong to this product", v.ID)
+			}
+			keep[v.ID] = true
+			err = q.UpdateProductVariant(ctx, dbgen.UpdateProductVariantParams{
+				Size:               v.Size,
+				Colour:             v.Colour,
+				Pack:               v.Pack,
+				PricePaise:         v.Price.Paise(),
+				OriginalPricePaise: v.OriginalPrice.Paise(),
+				ImageUrl:           v.ImageURL,
+				SortOrder:          int64(i),
+				ID:                 v.ID,
+				ProductID:          productID,
+			})
+		} else {
+			_, err = q.InsertProductVariant(ctx, dbgen.InsertProductVariantParams{
+				ProductID:          productID,
+				Size:               v.Size,
+				Colour:             v.Colour,
+				Pack:               v.Pack,
+				PricePaise:         v.Price.Paise(),
+				OriginalPricePaise: v.OriginalPrice.Paise(),
+				ImageUrl:           v.ImageURL,
+				SortOrder:          int64(i),
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range existing {
+		if !keep[e.ID] {
+			if err := q.DeleteProductVariant(ctx, dbgen.DeleteProductVariantParams{ID: e.ID, ProductID: productID}); err != nil {
+				return err
+			}
+		}
+	}
+	// Products with variants take their stock from them; leave a product
+	// that never had variants with its own count.
+	if len(existing) > 0 || len(vs) > 0 {
+		return q.SyncProductStockFromVariants(ctx, productID)
+	}
+	return nil
+}
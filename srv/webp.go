@@ -0,0 +1,817 @@
+package srv
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"math"
+)
+
+// A lossy WebP encoder, so /img can send browsers smaller thumbnails than
+// JPEG without cgo. It writes one VP8 key frame (RFC 6386) predicting each
+// macroblock whole, as 16×16 luma and 8×8 chroma blocks, which is the
+// simplest part of the format to search and already well ahead of JPEG at
+// the sizes cards use. There's no alpha; transparent images stay PNG.
+
+// vp8TokenProbs are coefficient token probabilities, by plane, band,
+// context and tree node.
+type vp8TokenProbs [4][8][3][11]uint8
+
+// Coefficient planes, as indexed in vp8TokenProbs.
+const (
+	vp8PlaneY  = 0 // luma, with the DCs in the Y2 block
+	vp8PlaneY2 = 1
+	vp8PlaneUV = 2
+)
+
+// Prediction modes for 16×16 luma and 8×8 chroma blocks.
+const (
+	vp8PredDC = iota
+	vp8PredV
+	vp8PredH
+	vp8PredTM
+)
+
+var (
+	// vp8Zigzag is the order coefficients are coded in.
+	vp8Zigzag = [16]int{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+	// vp8Bands maps a coefficient's position in that order to its band,
+	// with a 17th entry for the position past the last.
+	vp8Bands = [17]int{0, 1, 2, 3, 6, 4, 5, 6, 6, 6, 6, 6, 6, 6, 6, 7, 0}
+	// vp8CatProbs are the probabilities of the extra bits of token
+	// categories 3 to 6.
+	vp8CatProbs = [4][]uint8{
+		{173, 148, 140},
+		{176, 155, 140, 135},
+		{180, 157, 141, 134, 130},
+		{254, 254, 243, 230, 196, 177, 153, 140, 133, 130, 129},
+	}
+)
+
+// vp8MaxLevel is the largest coefficient a token can hold.
+const vp8MaxLevel = 2048
+
+// encodeWebP writes an opaque image as a lossy WebP. quality runs from 0
+// to 100 like JPEG's, though the two scales don't line up exactly.
+func encodeWebP(w io.Writer, img image.Image, quality int) error {
+	b := img.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 || b.Dx() > 16383 || b.Dy() > 16383 {
+		return errors.New("webp: image size out of range")
+	}
+	e := newVP8Encoder(img, quality)
+	e.analyze()
+	frame, err := e.frame(b.Dx(), b.Dy())
+	if err != nil {
+		return err
+	}
+	size := len(frame)
+	var hdr [20]byte
+	copy(hdr[0:], "RIFF")
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(4+8+size+size&1))
+	copy(hdr[8:], "WEBPVP8 ")
+	binary.LittleEndian.PutUint32(hdr[16:], uint32(size))
+	if size&1 != 0 {
+		frame = append(frame, 0)
+	}
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(frame)
+	return err
+}
+
+// vp8Macroblock is the coded form of one macroblock.
+type vp8Macroblock struct {
+	ymode, uvmode int
+	skip          bool // every coefficient is zero
+	// levels are quantized coefficients in zigzag order: 16 luma blocks in
+	// raster order, then 4 U, 4 V, and the Y2 block of luma DCs.
+	levels [25][16]int16
+}
+
+// vp8Encoder holds a frame being encoded.
+type vp8Encoder struct {
+	mbw, mbh int
+	// Source and reconstructed YCbCr planes, padded to whole macroblocks.
+	// Prediction works from the reconstruction, as the decoder sees it.
+	y, u, v          []uint8
+	ry, ru, rv       []uint8
+	yStride, cStride int
+
+	qi          int      // quantizer index
+	y1, y2, uv  [2]int32 // DC and AC quantizer steps
+	filterLevel int
+	mbs         []vp8Macroblock
+	probs       vp8TokenProbs
+	counts      [4][8][3][11][2]uint32
+}
+
+func newVP8Encoder(img image.Image, quality int) *vp8Encoder {
+	b := img.Bounds()
+	e := &vp8Encoder{mbw: (b.Dx() + 15) / 16, mbh: (b.Dy() + 15) / 16}
+	e.yStride, e.cStride = e.mbw*16, e.mbw*8
+	e.y = make([]uint8, e.yStride*e.mbh*16)
+	e.u = make([]uint8, e.cStride*e.mbh*8)
+	e.v = make([]uint8, e.cStride*e.mbh*8)
+	e.ry = make([]uint8, len(e.y))
+	e.ru = make([]uint8, len(e.u))
+	e.rv = make([]uint8, len(e.v))
+	e.mbs = make([]vp8Macroblock, e.mbw*e.mbh)
+	e.probs = vp8DefaultProbs
+	e.importImage(img)
+
+	// Quality 100 is the finest quantizer, 0 the coarsest; the curve keeps
+	// the useful range (roughly 50 to 90) spread out.
+	quality = max(0, min(quality, 100))
+	e.qi = int(127*math.Pow(1-float64(quality)/100, 1.3) + 0.5)
+	e.y1 = [2]int32{vp8DCSteps[e.qi], vp8ACSteps[e.qi]}
+	e.y2 = [2]int32{vp8DCSteps[e.qi] * 2, max(vp8ACSteps[e.qi]*155/100, 8)}
+	e.uv = [2]int32{vp8DCSteps[min(e.qi, 117)], vp8ACSteps[e.qi]}
+	// Smooth block edges more as the quantizer gets coarser.
+	e.filterLevel = e.qi / 2
+	return e
+}
+
+// importImage converts the image to YCbCr with 4:2:0 chroma, using the
+// BT.601 studio-swing coefficients browsers decode WebP with, and pads it
+// by repeating the last row and column.
+func (e *vp8Encoder) importImage(img image.Image) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	rgba, _ := img.(*image.RGBA)
+	at := func(x, y int) (r, g, bl int32) {
+		x, y = min(x, w-1), min(y, h-1)
+		if rgba != nil {
+			p := rgba.Pix[y*rgba.Stride+x*4:]
+			return int32(p[0]), int32(p[1]), int32(p[2])
+		}
+		r32, g32, b32, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+		return int32(r32 >> 8), int32(g32 >> 8), int32(b32 >> 8)
+	}
+	for y := 0; y < e.mbh*16; y++ {
+		for x := 0; x < e.mbw*16; x++ {
+			r, g, bl := at(x, y)
+			e.y[y*e.yStride+x] = vp8Clamp((16839*r + 33059*g + 6420*bl + 16<<16 + 1<<15) >> 16)
+		}
+	}
+	for y := 0; y < e.mbh*8; y++ {
+		for x := 0; x < e.mbw*8; x++ {
+			var r, g, bl int32
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb := at(2*x+d[0], 2*y+d[1])
+				r, g, bl = r+pr, g+pg, bl+pb
+			}
+			e.u[y*e.cStride+x] = vp8Clamp((-9719*r - 19081*g + 28800*bl + 128<<18 + 1<<17) >> 18)
+			e.v[y*e.cStride+x] = vp8Clamp((28800*r - 24116*g - 4684*bl + 128<<18 + 1<<17) >> 18)
+		}
+	}
+}
+
+func vp8Clamp(v int32) uint8 {
+	return uint8(max(0, min(v, 255)))
+}
+
+// analyze picks each macroblock's prediction modes and quantizes its
+// residuals, reconstructing it as the decoder will for the next ones.
+func (e *vp8Encoder) analyze() {
+	for mby := 0; mby < e.mbh; mby++ {
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			mb := &e.mbs[mby*e.mbw+mbx]
+			mb.ymode = e.encodeLuma(mb, mbx, mby)
+			mb.uvmode = e.encodeChroma(mb, mbx, mby)
+			mb.skip = true
+			for i := range mb.levels {
+				if mb.levels[i] != [16]int16{} {
+					mb.skip = false
+					break
+				}
+			}
+		}
+	}
+}
+
+// vp8Edges are the reconstructed pixels above and left of a block, with
+// the values the format substitutes at the frame's top and left edges.
+type vp8Edges struct {
+	top, left       [16]int32
+	corner          int32
+	hasTop, hasLeft bool
+}
+
+func vp8EdgesAt(plane []uint8, stride, x, y, n int) vp8Edges {
+	var ed vp8Edges
+	ed.hasTop, ed.hasLeft = y > 0, x > 0
+	for i := 0; i < n; i++ {
+		ed.top[i], ed.left[i] = 127, 129
+		if ed.hasTop {
+			ed.top[i] = int32(plane[(y-1)*stride+x+i])
+		}
+		if ed.hasLeft {
+			ed.left[i] = int32(plane[(y+i)*stride+x-1])
+		}
+	}
+	switch {
+	case !ed.hasTop:
+		ed.corner = 127
+	case !ed.hasLeft:
+		ed.corner = 129
+	default:
+		ed.corner = int32(plane[(y-1)*stride+x-1])
+	}
+	return ed
+}
+
+// predict fills an n×n block for mode from its edges.
+func (ed *vp8Edges) predict(mode, n int, out []int32) {
+	switch mode {
+	case vp8PredDC:
+		shift := 3
+		if n == 16 {
+			shift = 4
+		}
+		var sum int32
+		dc := int32(128)
+		switch {
+		case ed.hasTop && ed.hasLeft:
+			for i := 0; i < n; i++ {
+				sum += ed.top[i] + ed.left[i]
+			}
+			dc = (sum + int32(n)) >> (shift + 1)
+		case ed.hasTop:
+			for i := 0; i < n; i++ {
+				sum += ed.top[i]
+			}
+			dc = (sum + int32(n/2)) >> shift
+		case ed.hasLeft:
+			for i := 0; i < n; i++ {
+				sum += ed.left[i]
+			}
+			dc = (sum + int32(n/2)) >> shift
+		}
+		for i := range out[:n*n] {
+			out[i] = dc
+		}
+	case vp8PredV:
+		for j := 0; j < n; j++ {
+			copy(out[j*n:j*n+n], ed.top[:n])
+		}
+	case vp8PredH:
+		for j := 0; j < n; j++ {
+			for i := 0; i < n; i++ {
+				out[j*n+i] = ed.left[j]
+			}
+		}
+	case vp8PredTM:
+		for j := 0; j < n; j++ {
+			for i := 0; i < n; i++ {
+				out[j*n+i] = int32(vp8Clamp(ed.left[j] + ed.top[i] - ed.corner))
+			}
+		}
+	}
+}
+
+// vp8BestMode returns the mode whose predictions are closest to the
+// sources, each block predicted from its own edges.
+func vp8BestMode(n, stride, x, y int, eds []*vp8Edges, srcs [][]uint8) int {
+	var pred [256]int32
+	best, bestErr := vp8PredDC, int64(math.MaxInt64)
+	for mode := vp8PredDC; mode <= vp8PredTM; mode++ {
+		var sse int64
+		for k, ed := range eds {
+			ed.predict(mode, n, pred[:])
+			for j := 0; j < n; j++ {
+				for i := 0; i < n; i++ {
+					d := int64(srcs[k][(y+j)*stride+x+i]) - int64(pred[j*n+i])
+					sse += d * d
+				}
+			}
+		}
+		if sse < bestErr {
+			best, bestErr = mode, sse
+		}
+	}
+	return best
+}
+
+// encodeLuma codes a macroblock's luma: sixteen 4×4 blocks whose DCs go
+// through a second transform in the Y2 block.
+func (e *vp8Encoder) encodeLuma(mb *vp8Macroblock, mbx, mby int) int {
+	x0, y0 := mbx*16, mby*16
+	ed := vp8EdgesAt(e.ry, e.yStride, x0, y0, 16)
+	mode := vp8BestMode(16, e.yStride, x0, y0, []*vp8Edges{&ed}, [][]uint8{e.y})
+	var pred [256]int32
+	ed.predict(mode, 16, pred[:])
+
+	var coeffs [16][16]int32
+	var dcs, y2 [16]int32
+	for b := 0; b < 16; b++ {
+		bx, by := b%4*4, b/4*4
+		var res [16]int32
+		for j := 0; j < 4; j++ {
+			for i := 0; i < 4; i++ {
+				res[j*4+i] = int32(e.y[(y0+by+j)*e.yStride+x0+bx+i]) - pred[(by+j)*16+bx+i]
+			}
+		}
+		vp8FDCT(&res, &coeffs[b])
+		dcs[b] = coeffs[b][0]
+		for n := 1; n < 16; n++ {
+			z := vp8Zigzag[n]
+			mb.levels[b][n] = vp8Quantize(coeffs[b][z], e.y1[1], true)
+			coeffs[b][z] = int32(mb.levels[b][n]) * e.y1[1]
+		}
+	}
+	vp8FWHT(&dcs, &y2)
+	for n := 0; n < 16; n++ {
+		z := vp8Zigzag[n]
+		step := e.y2[min(n, 1)]
+		mb.levels[24][n] = vp8Quantize(y2[z], step, n > 0)
+		y2[z] = int32(mb.levels[24][n]) * step
+	}
+	vp8IWHT(&y2, &dcs)
+	for b := 0; b < 16; b++ {
+		bx, by := b%4*4, b/4*4
+		coeffs[b][0] = dcs[b]
+		vp8Reconstruct(e.ry, e.yStride, x0+bx, y0+by, &coeffs[b], pred[by*16+bx:], 16)
+	}
+	return mode
+}
+
+// encodeChroma codes a macroblock's U and V blocks, which share a mode.
+func (e *vp8Encoder) encodeChroma(mb *vp8Macroblock, mbx, mby int) int {
+	x0, y0 := mbx*8, mby*8
+	edU := vp8EdgesAt(e.ru, e.cStride, x0, y0, 8)
+	edV := vp8EdgesAt(e.rv, e.cStride, x0, y0, 8)
+	mode := vp8BestMode(8, e.cStride, x0, y0, []*vp8Edges{&edU, &edV}, [][]uint8{e.u, e.v})
+	var pred [64]int32
+	for plane, p := range []struct {
+		ed       *vp8Edges
+		src, rec []uint8
+	}{{&edU, e.u, e.ru}, {&edV, e.v, e.rv}} {
+		p.ed.predict(mode, 8, pred[:])
+		for b := 0; b < 4; b++ {
+			bx, by := b%2*4, b/2*4
+			var res, coeffs [16]int32
+			for j := 0; j < 4; j++ {
+				for i := 0; i < 4; i++ {
+					res[j*4+i] = int32(p.src[(y0+by+j)*e.cStride+x0+bx+i]) - pred[(by+j)*8+bx+i]
+				}
+			}
+			vp8FDCT(&res, &coeffs)
+			lv := &mb.levels[16+plane*4+b]
+			for n := 0; n < 16; n++ {
+				z := vp8Zigzag[n]
+				step := e.uv[min(n, 1)]
+				lv[n] = vp8Quantize(coeffs[z], step, n > 0)
+				coeffs[z] = int32(lv[n]) * step
+			}
+			vp8Reconstruct(p.rec, e.cStride, x0+bx, y0+by, &coeffs, pred[by*8+bx:], 8)
+		}
+	}
+	return mode
+}
+
+// vp8Quantize rounds a coefficient to a multiple of step. AC coefficients
+// round a little towards zero, as small ones cost more bits than they're
+// worth.
+func vp8Quantize(c, step int32, ac bool) int16 {
+	bias := step / 2
+	if ac {
+		bias = step * 3 / 8
+	}
+	level := min((max(c, -c)+bias)/step, vp8MaxLevel)
+	if c < 0 {
+		level = -level
+	}
+	return int16(level)
+}
+
+// vp8Reconstruct adds the inverse transform of dequantized coefficients to a
+// 4×4 prediction and stores the result, exactly as the decoder does.
+func vp8Reconstruct(plane []uint8, stride, x, y int, c *[16]int32, pred []int32, predStride int) {
+	const (
+		c1 = 85627 // 65536 * cos(pi/8) * sqrt(2)
+		c2 = 35468 // 65536 * sin(pi/8) * sqrt(2)
+	)
+	var m [4][4]int32
+	for i := 0; i < 4; i++ {
+		a := c[i] + c[8+i]
+		b := c[i] - c[8+i]
+		cc := (c[4+i]*c2)>>16 - (c[12+i]*c1)>>16
+		d := (c[4+i]*c1)>>16 + (c[12+i]*c2)>>16
+		m[i] = [4]int32{a + d, b + cc, b - cc, a - d}
+	}
+	for j := 0; j < 4; j++ {
+		dc := m[0][j] + 4
+		a := dc + m[2][j]
+		b := dc - m[2][j]
+		cc := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		row := plane[(y+j)*stride+x:]
+		p := pred[j*predStride:]
+		row[0] = vp8Clamp(p[0] + (a+d)>>3)
+		row[1] = vp8Clamp(p[1] + (b+cc)>>3)
+		row[2] = vp8Clamp(p[2] + (b-cc)>>3)
+		row[3] = vp8Clamp(p[3] + (a-d)>>3)
+	}
+}
+
+// vp8FDCT is the forward 4×4 transform whose inverse is the format's.
+func vp8FDCT(in, out *[16]int32) {
+	var tmp [16]int32
+	for i := 0; i < 4; i++ {
+		d := in[i*4 : i*4+4]
+		a0, a1 := d[0]+d[3], d[1]+d[2]
+		a2, a3 := d[1]-d[2], d[0]-d[3]
+		tmp[i*4+0] = (a0 + a1) * 8
+		tmp[i*4+1] = (a2*2217 + a3*5352 + 1812) >> 9
+		tmp[i*4+2] = (a0 - a1) * 8
+		tmp[i*4+3] = (a3*2217 - a2*5352 + 937) >> 9
+	}
+	for i := 0; i < 4; i++ {
+		a0, a1 := tmp[i]+tmp[12+i], tmp[4+i]+tmp[8+i]
+		a2, a3 := tmp[4+i]-tmp[8+i], tmp[i]-tmp[12+i]
+		out[i] = (a0 + a1 + 7) >> 4
+		out[4+i] = (a2*2217+a3*5352+12000)>>16 + int32(vp8Bool(a3 != 0))
+		out[8+i] = (a0 - a1 + 7) >> 4
+		out[12+i] = (a3*2217 - a2*5352 + 51000) >> 16
+	}
+}
+
+// vp8FWHT is the forward Walsh-Hadamard transform of the luma DCs.
+func vp8FWHT(in, out *[16]int32) {
+	var tmp [16]int32
+	for i := 0; i < 4; i++ {
+		d := in[i*4 : i*4+4]
+		a0, a1 := d[0]+d[2], d[1]+d[3]
+		a2, a3 := d[1]-d[3], d[0]-d[2]
+		tmp[i*4+0] = a0 + a1
+		tmp[i*4+1] = a3 + a2
+		tmp[i*4+2] = a3 - a2
+		tmp[i*4+3] = a0 - a1
+	}
+	for i := 0; i < 4; i++ {
+		a0, a1 := tmp[i]+tmp[8+i], tmp[4+i]+tmp[12+i]
+		a2, a3 := tmp[4+i]-tmp[12+i], tmp[i]-tmp[8+i]
+		out[i] = (a0 + a1) >> 1
+		out[4+i] = (a3 + a2) >> 1
+		out[8+i] = (a3 - a2) >> 1
+		out[12+i] = (a0 - a1) >> 1
+	}
+}
+
+// vp8IWHT is the decoder's inverse of vp8FWHT.
+func vp8IWHT(in, out *[16]int32) {
+	var m [16]int32
+	for i := 0; i < 4; i++ {
+		a0, a1 := in[i]+in[12+i], in[4+i]+in[8+i]
+		a2, a3 := in[4+i]-in[8+i], in[i]-in[12+i]
+		m[i] = a0 + a1
+		m[8+i] = a0 - a1
+		m[4+i] = a3 + a2
+		m[12+i] = a3 - a2
+	}
+	for i := 0; i < 4; i++ {
+		dc := m[i*4] + 3
+		a0, a1 := dc+m[i*4+3], m[i*4+1]+m[i*4+2]
+		a2, a3 := m[i*4+1]-m[i*4+2], dc-m[i*4+3]
+		out[i*4+0] = (a0 + a1) >> 3
+		out[i*4+1] = (a3 + a2) >> 3
+		out[i*4+2] = (a0 - a1) >> 3
+		out[i*4+3] = (a3 - a2) >> 3
+	}
+}
+
+func vp8Bool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// vp8Contexts track which neighbouring blocks had coefficients, for
+// choosing token probabilities: four luma blocks, two U, two V and the Y2
+// block along one edge of a macroblock.
+type vp8Contexts struct {
+	y    [4]int
+	u, v [2]int
+	y2   int
+}
+
+// frame writes the VP8 key frame: the frame header and modes in the first
+// partition, then every coefficient in the second.
+func (e *vp8Encoder) frame(width, height int) ([]byte, error) {
+	// Count the tokens first to fit the probabilities to this image.
+	e.tokens(nil)
+	updates := e.updateProbs()
+
+	var skipped int
+	for i := range e.mbs {
+		if e.mbs[i].skip {
+			skipped++
+		}
+	}
+	// The probability of a macroblock having coefficients.
+	skipProb := 0
+	if skipped > 0 {
+		skipProb = max(1, min(254, 255*(len(e.mbs)-skipped)/len(e.mbs)))
+	}
+
+	var fp vp8BoolEncoder
+	fp.init()
+	fp.putLiteral(0, 1) // color space
+	fp.putLiteral(0, 1) // clamping required
+	fp.putLiteral(0, 1) // no segmentation
+	fp.putLiteral(0, 1) // normal loop filter
+	fp.putLiteral(e.filterLevel, 6)
+	fp.putLiteral(0, 3) // sharpness
+	fp.putLiteral(0, 1) // no loop filter adjustments
+	fp.putLiteral(0, 2) // one token partition
+	fp.putLiteral(e.qi, 7)
+	fp.putLiteral(0, 5) // no quantizer deltas
+	fp.putLiteral(0, 1) // refresh entropy probabilities
+	for i := range vp8ProbUpdateProbs {
+		for j := range vp8ProbUpdateProbs[i] {
+			for k := range vp8ProbUpdateProbs[i][j] {
+				for l, p := range vp8ProbUpdateProbs[i][j][k] {
+					update := updates[i][j][k][l]
+					fp.putBit(update, p)
+					if update {
+						fp.putLiteral(int(e.probs[i][j][k][l]), 8)
+					}
+				}
+			}
+		}
+	}
+	fp.putLiteral(vp8Bool(skipProb > 0), 1)
+	if skipProb > 0 {
+		fp.putLiteral(skipProb, 8)
+	}
+	for i := range e.mbs {
+		mb := &e.mbs[i]
+		if skipProb > 0 {
+			fp.putBit(mb.skip, uint8(skipProb))
+		}
+		fp.putBit(true, 145) // 16×16 luma prediction
+		switch mb.ymode {
+		case vp8PredDC:
+			fp.putBit(false, 156)
+			fp.putBit(false, 163)
+		case vp8PredV:
+			fp.putBit(false, 156)
+			fp.putBit(true, 163)
+		case vp8PredH:
+			fp.putBit(true, 156)
+			fp.putBit(false, 128)
+		case vp8PredTM:
+			fp.putBit(true, 156)
+			fp.putBit(true, 128)
+		}
+		fp.putBit(mb.uvmode != vp8PredDC, 142)
+		if mb.uvmode != vp8PredDC {
+			fp.putBit(mb.uvmode != vp8PredV, 114)
+			if mb.uvmode != vp8PredV {
+				fp.putBit(mb.uvmode == vp8PredTM, 183)
+			}
+		}
+	}
+	first := fp.flush()
+	if len(first) >= 1<<19 {
+		return nil, errors.New("webp: image too large to encode")
+	}
+
+	var tp vp8BoolEncoder
+	tp.init()
+	e.tokens(&tp)
+	tokens := tp.flush()
+
+	out := make([]byte, 10, 10+len(first)+len(tokens))
+	tag := 1<<4 | len(first)<<5 // key frame, version 0, shown
+	out[0], out[1], out[2] = byte(tag), byte(tag>>8), byte(tag>>16)
+	out[3], out[4], out[5] = 0x9d, 0x01, 0x2a
+	binary.LittleEndian.PutUint16(out[6:], uint16(width))
+	binary.LittleEndian.PutUint16(out[8:], uint16(height))
+	out = append(out, first...)
+	return append(out, tokens...), nil
+}
+
+// tokens codes every macroblock's coefficients to w, or only counts the
+// tokens when w is nil.
+func (e *vp8Encoder) tokens(w *vp8BoolEncoder) {
+	above := make([]vp8Contexts, e.mbw)
+	for mby := 0; mby < e.mbh; mby++ {
+		var left vp8Contexts
+		for mbx := 0; mbx < e.mbw; mbx++ {
+			mb := &e.mbs[mby*e.mbw+mbx]
+			up := &above[mbx]
+			if mb.skip {
+				// Skipped macroblocks have no tokens, and count as
+				// having no coefficients.
+				*up, left = vp8Contexts{}, vp8Contexts{}
+				continue
+			}
+			nz := e.putBlock(w, vp8PlaneY2, left.y2+up.y2, 0, &mb.levels[24])
+			left.y2, up.y2 = nz, nz
+			for y := 0; y < 4; y++ {
+				for x := 0; x < 4; x++ {
+					nz := e.putBlock(w, vp8PlaneY, left.y[y]+up.y[x], 1, &mb.levels[y*4+x])
+					left.y[y], up.y[x] = nz, nz
+				}
+			}
+			for c, ctx := range []struct{ left, up *[2]int }{{&left.u, &up.u}, {&left.v, &up.v}} {
+				for y := 0; y < 2; y++ {
+					for x := 0; x < 2; x++ {
+						nz := e.putBlock(w, vp8PlaneUV, ctx.left[y]+ctx.up[x], 0, &mb.levels[16+c*4+y*2+x])
+						ctx.left[y], ctx.up[x] = nz, nz
+					}
+				}
+			}
+		}
+	}
+}
+
+// putBlock codes one block's coefficients from position first, returning
+// 1 if any were non-zero.
+func (e *vp8Encoder) putBlock(w *vp8BoolEncoder, plane, ctx, first int, lv *[16]int16) int {
+	band := vp8Bands[first]
+	// node codes one step down the token tree.
+	node := func(i int, bit bool) {
+		if w == nil {
+			e.counts[plane][band][ctx][i][vp8Bool(bit)]++
+		} else {
+			w.putBit(bit, e.probs[plane][band][ctx][i])
+		}
+	}
+	// extra codes bits with fixed probabilities.
+	extra := func(bit bool, prob uint8) {
+		if w != nil {
+			w.putBit(bit, prob)
+		}
+	}
+
+	last := -1
+	for n := 15; n >= first; n-- {
+		if lv[n] != 0 {
+			last = n
+			break
+		}
+	}
+	if last < 0 {
+		node(0, false) // end of block
+		return 0
+	}
+	node(0, true)
+	for n := first; n <= last; {
+		v := int32(lv[n])
+		n++
+		if v == 0 {
+			node(1, false)
+			// A zero can't be followed by the end of the block, so the
+			// next token skips that branch.
+			band, ctx = vp8Bands[n], 0
+			continue
+		}
+		node(1, true)
+		abs := max(v, -v)
+		switch {
+		case abs == 1:
+			node(2, false)
+		case abs <= 4:
+			node(2, true)
+			node(3, false)
+			node(4, abs != 2)
+			if abs != 2 {
+				node(5, abs == 4)
+			}
+		case abs <= 10:
+			node(2, true)
+			node(3, true)
+			node(6, false)
+			if abs <= 6 {
+				node(7, false)
+				extra(abs == 6, 159)
+			} else {
+				node(7, true)
+				extra((abs-7)&2 != 0, 165)
+				extra((abs-7)&1 != 0, 145)
+			}
+		default:
+			node(2, true)
+			node(3, true)
+			node(6, true)
+			cat := 3
+			switch {
+			case abs < 19:
+				cat = 0
+			case abs < 35:
+				cat = 1
+			case abs < 67:
+				cat = 2
+			}
+			node(8, cat >= 2)
+			node(9+cat/2, cat&1 != 0)
+			rest := abs - (3 + 8<<cat)
+			probs := vp8CatProbs[cat]
+			for i, p := range probs {
+				extra(rest>>(len(probs)-1-i)&1 != 0, p)
+			}
+		}
+		extra(v < 0, 128)
+		band, ctx = vp8Bands[n], min(int(abs), 2)
+		if n == 16 {
+			break
+		}
+		node(0, n <= last) // more to come, or the end of the block
+	}
+	return 1
+}
+
+// updateProbs replaces default token probabilities with ones fitted to
+// the counted tokens wherever that saves more than the update costs,
+// returning which were replaced.
+func (e *vp8Encoder) updateProbs() (updates [4][8][3][11]bool) {
+	// cost is the number of bits to code n0 zeros and n1 ones with prob.
+	cost := func(n0, n1 uint32, prob uint8) float64 {
+		p := float64(prob) / 256
+		return -float64(n0)*math.Log2(p) - float64(n1)*math.Log2(1-p)
+	}
+	for i := range e.probs {
+		for j := range e.probs[i] {
+			for k := range e.probs[i][j] {
+				for l, old := range e.probs[i][j][k] {
+					n0, n1 := e.counts[i][j][k][l][0], e.counts[i][j][k][l][1]
+					if n0+n1 == 0 {
+						continue
+					}
+					p := uint8(max(1, min(255, (256*uint64(n0)+uint64(n0+n1)/2)/uint64(n0+n1))))
+					u := vp8ProbUpdateProbs[i][j][k][l]
+					keep := cost(n0, n1, old) + cost(1, 0, u)
+					change := cost(n0, n1, p) + cost(0, 1, u) + 8
+					if change < keep {
+						e.probs[i][j][k][l] = p
+						updates[i][j][k][l] = true
+					}
+				}
+			}
+		}
+	}
+	return updates
+}
+
+// vp8BoolEncoder is the boolean entropy coder of RFC 6386 section 7.
+type vp8BoolEncoder struct {
+	buf      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+func (e *vp8BoolEncoder) init() {
+	e.rng, e.bitCount = 255, 24
+}
+
+// putBit codes bit, which is false with probability prob/256.
+func (e *vp8BoolEncoder) putBit(bit bool, prob uint8) {
+	split := 1 + (e.rng-1)*uint32(prob)>>8
+	if bit {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			// Carry into the bytes already written.
+			for i := len(e.buf) - 1; i >= 0; i-- {
+				e.buf[i]++
+				if e.buf[i] != 0 {
+					break
+				}
+			}
+		}
+		e.bottom <<= 1
+		e.bitCount--
+		if e.bitCount == 0 {
+			e.buf = append(e.buf, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bitCount = 8
+		}
+	}
+}
+
+// putLiteral codes the n low bits of v, most significant first, at even
+// odds.
+func (e *vp8BoolEncoder) putLiteral(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.putBit(v>>i&1 != 0, 128)
+	}
+}
+
+// flush writes out the bits still pending and returns the partition.
+func (e *vp8BoolEncoder) flush() []byte {
+	for i := 0; i < 32; i++ {
+		e.putBit(false, 128)
+	}
+	return e.buf
+}
@@ -0,0 +1,147 @@
+package srv
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// psnr is the peak signal-to-noise ratio between two images' RGB, in dB.
+func psnr(a, b image.Image) float64 {
+	var sse float64
+	r := a.Bounds()
+	for y := range r.Dy() {
+		for x := range r.Dx() {
+			r1, g1, b1, _ := a.At(r.Min.X+x, r.Min.Y+y).RGBA()
+			r2, g2, b2, _ := b.At(b.Bounds().Min.X+x, b.Bounds().Min.Y+y).RGBA()
+			for _, d := range []float64{
+				float64(r1>>8) - float64(r2>>8),
+				float64(g1>>8) - float64(g2>>8),
+				float64(b1>>8) - float64(b2>>8),
+			} {
+				sse += d * d
+			}
+		}
+	}
+	if sse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255*3*float64(r.Dx()*r.Dy())/sse)
+}
+
+func fillImage(w, h int, f func(x, y int) color.RGBA) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			m.SetRGBA(x, y, f(x, y))
+		}
+	}
+	return m
+}
+
+func TestEncodeWebP(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	tests := []struct {
+		name string
+		img  image.Image
+		// minPSNR is the lowest acceptable PSNR at quality 90, in dB.
+		minPSNR float64
+	}{
+		{"solid", fillImage(64, 48, func(x, y int) color.RGBA { return color.RGBA{230, 120, 170, 255} }), 48},
+		{"gradient", fillImage(96, 64, func(x, y int) color.RGBA {
+			return color.RGBA{uint8(x * 255 / 95), uint8(y * 255 / 63), uint8((x + y) * 255 / 158), 255}
+		}), 40},
+		{"1x1", fillImage(1, 1, func(x, y int) color.RGBA { return color.RGBA{20, 200, 90, 255} }), 48},
+		{"17x33", fillImage(17, 33, func(x, y int) color.RGBA {
+			return color.RGBA{uint8(x * 15), uint8(y * 7), 128, 255}
+		}), 33},
+		{"grey noise", fillImage(48, 40, func(x, y int) color.RGBA {
+			v := uint8(rnd.IntN(256))
+			return color.RGBA{v, v, v, 255}
+		}), 38},
+		// Sharing chroma between 2×2 pixels alone leaves colour noise at
+		// about 13 dB.
+		{"colour noise", fillImage(48, 40, func(x, y int) color.RGBA {
+			return color.RGBA{uint8(rnd.IntN(256)), uint8(rnd.IntN(256)), uint8(rnd.IntN(256)), 255}
+		}), 12.5},
+		{"offset bounds", fillImage(40, 40, func(x, y int) color.RGBA {
+			return color.RGBA{uint8(x * 6), 80, uint8(y * 6), 255}
+		}).SubImage(image.Rect(5, 7, 35, 29)), 36},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeWebP(&buf, tt.img, 90); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := webp.DecodeConfig(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			dec, err := webp.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			size := tt.img.Bounds().Size()
+			if cfg.Width != size.X || cfg.Height != size.Y || dec.Bounds().Size() != size {
+				t.Fatalf("decoded %d×%d (header %d×%d), want %d×%d",
+					dec.Bounds().Dx(), dec.Bounds().Dy(), cfg.Width, cfg.Height, size.X, size.Y)
+			}
+			if p := psnr(tt.img, webpRGB(dec)); p < tt.minPSNR {
+				t.Errorf("PSNR %.1f dB, want at least %.0f", p, tt.minPSNR)
+			}
+		})
+	}
+}
+
+func TestEncodeWebPQuality(t *testing.T) {
+	img := fillImage(64, 64, func(x, y int) color.RGBA {
+		return color.RGBA{uint8(x * 4), uint8((x ^ y) * 4), uint8(y * 4), 255}
+	})
+	var prevSize int
+	prevPSNR := 0.0
+	for _, q := range []int{0, 30, 60, 90, 100} {
+		var buf bytes.Buffer
+		if err := encodeWebP(&buf, img, q); err != nil {
+			t.Fatal(err)
+		}
+		size := buf.Len()
+		dec, err := webp.Decode(&buf)
+		if err != nil {
+			t.Fatalf("quality %d: %v", q, err)
+		}
+		p := psnr(img, webpRGB(dec))
+		if p < prevPSNR || size < prevSize {
+			t.Errorf("quality %d: %d bytes at %.1f dB, less than the %d bytes at %.1f dB of a lower quality",
+				q, size, p, prevSize, prevPSNR)
+		}
+		prevSize, prevPSNR = size, p
+	}
+}
+
+// TestResizeWebPGenerations resizes a WebP to smaller and smaller WebPs, as
+// /img does for a Meesho image, and checks black and white survive it.
+func TestResizeWebPGenerations(t *testing.T) {
+	var buf bytes.Buffer
+	if err := encodeWebP(&buf, blackAndWhite(256, 128), 90); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	for _, w := range []int{192, 128, 96, 64, 48} {
+		out, contentType, ok, err := resizeImage(data, imageVariant{W: w, H: w / 2, Fit: fitCover, Format: formatWebP}, 1<<20)
+		if err != nil || !ok || contentType != "image/webp" {
+			t.Fatalf("resize to %d wide: %s, %v, %v", w, contentType, ok, err)
+		}
+		m, _, err := decodeImage(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkBlackAndWhite(t, "after resizing to "+m.Bounds().Size().String(), m, 6)
+		data = out
+	}
+}
@@ -0,0 +1,310 @@
+package srv
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Just enough of the XLSX format to export the catalogue as a spreadsheet
+// and read back the first sheet of one: cell values only, no styles or
+// formulas beyond their cached results.
+
+// Limits on reading a workbook, which is a zip and can unpack to far more
+// than was uploaded. Rows and columns are Excel's own limits, and cells
+// bounds the rows and the empty cells padding them out together.
+const (
+	xlsxMaxPartBytes = 32 << 20 // unpacked size of any one part
+	xlsxMaxRows      = 1 << 20
+	xlsxMaxColumns   = 1 << 14
+	xlsxMaxCells     = 2 << 20
+)
+
+// writeXLSX writes rows as the only sheet of a workbook. Cells that look
+// like plain numbers are stored as numbers so spreadsheets can sum them.
+func writeXLSX(w io.Writer, sheet string, rows [][]string) error {
+	zw := zip.NewWriter(w)
+	files := []struct{ name, body string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="` + xmlEscape(sheet) + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.body); err != nil {
+			return err
+		}
+	}
+
+	fw, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, v := range row {
+			if v == "" {
+				continue
+			}
+			ref := xlsxColumn(j) + strconv.Itoa(i+1)
+			if xlsxNumber(v) {
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, v)
+			} else {
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(v))
+			}
+		}
+		b.WriteString(`</row>`)
+		// Flush as we go; a big catalogue needn't sit in memory twice.
+		if b.Len() > 64<<10 {
+			if _, err := io.WriteString(fw, b.String()); err != nil {
+				return err
+			}
+			b.Reset()
+		}
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	if _, err := io.WriteString(fw, b.String()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// xlsxNumber reports whether v can be stored as a number cell and read
+// back unchanged. Leading zeros, as in "007", keep a value text.
+func xlsxNumber(v string) bool {
+	if len(v) > 15 || (len(v) > 1 && v[0] == '0' && v[1] != '.') {
+		return false
+	}
+	_, err := strconv.ParseFloat(v, 64)
+	return err == nil && strings.Trim(v, "0123456789.-") == ""
+}
+
+// xlsxColumn returns the letters of the zero-based column i: A, B, ... Z, AA.
+func xlsxColumn(i int) string {
+	s := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		s = string(rune('A'+(i-1)%26)) + s
+	}
+	return s
+}
+
+// xmlEscape escapes s for element text or an attribute, dropping
+// characters XML can't hold.
+func xmlEscape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// readXLSX returns the rows of the first sheet in a workbook, with empty
+// cells as "" so every row lines up with the header.
+func readXLSX(r io.ReaderAt, size int64) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.New("not an XLSX file")
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	decode := func(name string, v any) error {
+		f, ok := files[name]
+		if !ok {
+			return fmt.Errorf("XLSX file has no %s", name)
+		}
+		if f.UncompressedSize64 > xlsxMaxPartBytes {
+			return fmt.Errorf("XLSX file's %s is too large", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		// Held to the limit whatever the zip's directory says.
+		lr := &io.LimitedReader{R: rc, N: xlsxMaxPartBytes}
+		if err := xml.NewDecoder(lr).Decode(v); err != nil {
+			if lr.N == 0 {
+				return fmt.Errorf("XLSX file's %s is too large", name)
+			}
+			return err
+		}
+		return nil
+	}
+
+	// The first sheet is whichever the workbook lists first.
+	var workbook struct {
+		Sheets []struct {
+			RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decode("xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, errors.New("XLSX file has no sheets")
+	}
+	var rels struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	sheetPath := ""
+	for _, rel := range rels.Rels {
+		if rel.ID == workbook.Sheets[0].RID {
+			sheetPath = rel.Target
+			if strings.HasPrefix(sheetPath, "/") {
+				sheetPath = strings.TrimPrefix(sheetPath, "/")
+			} else {
+				sheetPath = path.Join("xl", sheetPath)
+			}
+		}
+	}
+
+	// Most writers keep text in a shared table that cells index into.
+	type richText struct {
+		T string `xml:"t"`
+		R []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	}
+	text := func(rt richText) string {
+		s := rt.T
+		for _, r := range rt.R {
+			s += r.T
+		}
+		return s
+	}
+	var shared []string
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			SI []richText `xml:"si"`
+		}
+		if err := decode("xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+		for _, si := range sst.SI {
+			shared = append(shared, text(si))
+		}
+	}
+
+	var ws struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R  string   `xml:"r,attr"`
+				T  string   `xml:"t,attr"`
+				V  string   `xml:"v"`
+				Is richText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decode(sheetPath, &ws); err != nil {
+		return nil, err
+	}
+	var rows [][]string
+	cells := 0
+	for _, row := range ws.Rows {
+		// Rows and cells may be left out when empty.
+		n := row.R
+		if n == 0 {
+			n = len(rows) + 1
+		}
+		if n < len(rows)+1 || n > xlsxMaxRows {
+			return nil, fmt.Errorf("row %d: bad row number", n)
+		}
+		cells += n - len(rows)
+		if cells > xlsxMaxCells {
+			return nil, errors.New("XLSX sheet has too many cells")
+		}
+		for len(rows) < n-1 {
+			rows = append(rows, nil)
+		}
+		var out []string
+		for _, c := range row.Cells {
+			col := len(out)
+			if c.R != "" {
+				col = xlsxColumnIndex(c.R)
+			}
+			if col < len(out) || col >= xlsxMaxColumns {
+				return nil, fmt.Errorf("cell %s: bad cell reference", c.R)
+			}
+			cells += col + 1 - len(out)
+			if cells > xlsxMaxCells {
+				return nil, errors.New("XLSX sheet has too many cells")
+			}
+			v := c.V
+			switch c.T {
+			case "s":
+				i, err := strconv.Atoi(c.V)
+				if err != nil || i < 0 || i >= len(shared) {
+					return nil, fmt.Errorf("cell %s: bad shared string %q", c.R, c.V)
+				}
+				v = shared[i]
+			case "inlineStr":
+				v = text(c.Is)
+			case "b":
+				v = map[string]string{"1": "TRUE", "0": "FALSE"}[c.V]
+			case "", "n":
+				// Binary floats such as 299.99000000000001 read back as
+				// typed.
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					v = strconv.FormatFloat(f, 'f', -1, 64)
+				}
+			}
+			for len(out) < col {
+				out = append(out, "")
+			}
+			out = append(out, v)
+		}
+		rows = append(rows, out)
+	}
+	return rows, nil
+}
+
+// xlsxColumnIndex returns the zero-based column of a cell reference such
+// as "AB12", or xlsxMaxColumns for one past Excel's last column.
+func xlsxColumnIndex(ref string) int {
+	n := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		n = n*26 + int(c-'A'+1)
+		if n > xlsxMaxColumns {
+			return xlsxMaxColumns
+		}
+	}
+	return n - 1
+}
@@ -0,0 +1,84 @@
+package srv
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// xlsxWithSheet returns a workbook whose first sheet's XML is sheetData.
+func xlsxWithSheet(t *testing.T, sheetData string) []byte {
+	t.Helper()
+	var orig bytes.Buffer
+	if err := writeXLSX(&orig, "Products", [][]string{{"title"}}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(orig.Bytes()), int64(orig.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	zw := zip.NewWriter(&out)
+	for _, f := range zr.File {
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			io.WriteString(w, `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`+
+				sheetData+`</sheetData></worksheet>`)
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(w, rc)
+		rc.Close()
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestReadXLSX(t *testing.T) {
+	data := xlsxWithSheet(t, `<row r="1"><c r="A1" t="inlineStr"><is><t>title</t></is></c><c r="C1" t="inlineStr"><is><t>price</t></is></c></row>`+
+		`<row r="3"><c r="A3" t="inlineStr"><is><t>=1+1</t></is></c><c r="C3"><v>299.99000000000001</v></c></row>`)
+	rows, err := readSheet(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"title", "", "price"}, nil, {"=1+1", "", "299.99"}}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Errorf("rows %q, want %q", rows, want)
+	}
+}
+
+func TestReadXLSXLimits(t *testing.T) {
+	var wide strings.Builder
+	for r := 1; r <= 200; r++ {
+		fmt.Fprintf(&wide, `<row r="%d"><c r="XFD%d"><v>1</v></c></row>`, r, r)
+	}
+	tests := []struct {
+		name  string
+		sheet string
+	}{
+		{"row past Excel's last", `<row r="2000000000"><c><v>1</v></c></row>`},
+		{"rows out of order", `<row r="5"><c><v>1</v></c></row><row r="2"><c><v>1</v></c></row>`},
+		{"column past Excel's last", `<row r="1"><c r="ZZZZZ1"><v>1</v></c></row>`},
+		{"column letters overflowing", `<row r="1"><c r="` + strings.Repeat("Z", 40) + `1"><v>1</v></c></row>`},
+		{"cells out of order", `<row r="1"><c r="C1"><v>1</v></c><c r="A1"><v>1</v></c></row>`},
+		{"too many padded cells", wide.String()},
+		// Compresses to a few kilobytes.
+		{"part too large unpacked", `<row r="1"><c><v>1</v></c></row>` + strings.Repeat(" ", xlsxMaxPartBytes)},
+	}
+	for _, tt := range tests {
+		if rows, err := readSheet(xlsxWithSheet(t, tt.sheet)); err == nil {
+			t.Errorf("%s: read %d rows, want an error", tt.name, len(rows))
+		}
+	}
+}